@@ -0,0 +1,38 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImportPathStaysUnderRoot(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "imports")
+	outside := filepath.Join(dir, "secret")
+	for _, d := range []string{filepath.Join(root, "build"), outside} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{}
+	if _, err := s.importPath(filepath.Join(root, "build")); err == nil {
+		t.Errorf("server path accepted without an import root")
+	}
+
+	s.SetImportRoot(root)
+	for _, path := range []string{"build", filepath.Join(root, "build")} {
+		if _, err := s.importPath(path); err != nil {
+			t.Errorf("%s: %v", path, err)
+		}
+	}
+	for _, path := range []string{outside, "../secret", filepath.Join(root, "..", "secret"), "escape", filepath.Join(root, "missing")} {
+		if _, err := s.importPath(path); err == nil {
+			t.Errorf("%s was accepted", path)
+		}
+	}
+}
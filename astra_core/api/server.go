@@ -1,21 +1,39 @@
 package api
 
 import (
+	"astra_core/database"
+	"astra_core/depot"
 	"astra_core/diff"
+	"astra_core/extractor"
+	"astra_core/items"
+	"astra_core/localization"
 	"astra_core/monitor"
+	"astra_core/rules"
 	"astra_core/steam"
 	"compress/gzip"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// DefaultMaxImportUpload caps the size of an archive uploaded to /import.
+const DefaultMaxImportUpload = 4 << 30
+
 type Server struct {
 	mon         *monitor.Monitor
 	steamClient *steam.SteamWebClient
 	startTime   time.Time
+	importRoot  string // server directory /import may read paths from; empty for uploads only
+	maxUpload   int64
 }
 
 func NewServer(mon *monitor.Monitor) *Server {
@@ -23,6 +41,20 @@ func NewServer(mon *monitor.Monitor) *Server {
 		mon:         mon,
 		steamClient: steam.NewSteamWebClient(),
 		startTime:   time.Now(),
+		maxUpload:   DefaultMaxImportUpload,
+	}
+}
+
+// SetImportRoot lets /import read builds and manifests from paths under dir.
+// Without it only uploads are accepted.
+func (s *Server) SetImportRoot(dir string) {
+	s.importRoot = dir
+}
+
+// SetMaxImportUpload sets the size limit of an archive uploaded to /import.
+func (s *Server) SetMaxImportUpload(bytes int64) {
+	if bytes > 0 {
+		s.maxUpload = bytes
 	}
 }
 
@@ -32,10 +64,20 @@ func (s *Server) Start(addr string) {
 	http.HandleFunc("/health", s.handleHealth) // Health check usually small, no gzip needed
 	http.HandleFunc("/diff", withGzip(s.handleDiff))
 	http.HandleFunc("/diff/details", withGzip(s.handleDiffDetails))
+	http.HandleFunc("/diff/localization", withGzip(s.handleDiffLocalization))
 	http.HandleFunc("/news", withGzip(s.handleNews))
 	http.HandleFunc("/players", s.handlePlayers)
 	http.HandleFunc("/depots", withGzip(s.handleDepots))
 	http.HandleFunc("/servers", s.handleServers)
+	http.HandleFunc("/search", withGzip(s.handleSearch))
+	http.HandleFunc("/rules", withGzip(s.handleRules))
+	http.HandleFunc("/rules/test", s.handleRulesTest)
+	http.HandleFunc("/noise", withGzip(s.handleNoise))
+	http.HandleFunc("/builds", withGzip(s.handleBuilds))
+	http.HandleFunc("/cache", withGzip(s.handleCache))
+	http.HandleFunc("/jobs", withGzip(s.handleJobs))
+	http.HandleFunc("/import", withGzip(s.handleImport))
+	http.HandleFunc("/verify", withGzip(s.handleVerify))
 
 	http.HandleFunc("/steam", withGzip(s.handleStatus))
 	http.HandleFunc("/steam/", withGzip(s.handleStatus))
@@ -43,10 +85,20 @@ func (s *Server) Start(addr string) {
 	http.HandleFunc("/steam/health", s.handleHealth)
 	http.HandleFunc("/steam/diff", withGzip(s.handleDiff))
 	http.HandleFunc("/steam/diff/details", withGzip(s.handleDiffDetails))
+	http.HandleFunc("/steam/diff/localization", withGzip(s.handleDiffLocalization))
 	http.HandleFunc("/steam/news", withGzip(s.handleNews))
 	http.HandleFunc("/steam/players", s.handlePlayers)
 	http.HandleFunc("/steam/depots", withGzip(s.handleDepots))
 	http.HandleFunc("/steam/servers", s.handleServers)
+	http.HandleFunc("/steam/search", withGzip(s.handleSearch))
+	http.HandleFunc("/steam/rules", withGzip(s.handleRules))
+	http.HandleFunc("/steam/rules/test", s.handleRulesTest)
+	http.HandleFunc("/steam/noise", withGzip(s.handleNoise))
+	http.HandleFunc("/steam/builds", withGzip(s.handleBuilds))
+	http.HandleFunc("/steam/cache", withGzip(s.handleCache))
+	http.HandleFunc("/steam/jobs", withGzip(s.handleJobs))
+	http.HandleFunc("/steam/import", withGzip(s.handleImport))
+	http.HandleFunc("/steam/verify", withGzip(s.handleVerify))
 
 	// Webhook Management
 	http.HandleFunc("/api/webhooks", s.handleWebhooks)
@@ -74,27 +126,47 @@ func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 	uptime := time.Since(s.startTime)
 	playerCount, _ := s.steamClient.GetPlayerCount(730)
 
+	status := "monitoring"
+	if state.Extraction != nil {
+		status = "extracting"
+	} else if len(state.Jobs) > 0 {
+		status = "downloading"
+	}
+
 	response := StatusResponse{
 		AppID:         730,
 		AppName:       "Counter-Strike 2",
 		ChangeNumber:  state.ChangeNumber,
 		BuildID:       state.BuildID,
 		PlayerCount:   playerCount,
-		Status:        "monitoring",
+		Status:        status,
 		UptimeSeconds: int64(uptime.Seconds()),
 		HasUpdate:     state.LastDiff != nil,
 		LastCheck:     time.Now().Unix(),
+		Extraction:    state.Extraction,
+	}
+	for _, job := range state.Jobs {
+		response.Jobs = append(response.Jobs, jobToAPI(job))
 	}
 
 	if state.LastDiff != nil {
+		top, _ := state.LastDiff.Classification.Top()
 		response.LastUpdate = &UpdateInfo{
-			OldVersion:    state.LastDiff.OldVersion,
-			NewVersion:    state.LastDiff.NewVersion,
-			Type:          string(state.LastDiff.Type),
-			TypeReason:    state.LastDiff.TypeReason,
-			DepotsChanged: len(state.LastDiff.ChangedDepots),
-			NewProtobufs:  len(state.LastDiff.NewProtobufs),
-			NewStrings:    len(state.LastDiff.NewStrings),
+			OldVersion:        state.LastDiff.OldVersion,
+			NewVersion:        state.LastDiff.NewVersion,
+			Type:              string(state.LastDiff.Type),
+			TypeReason:        state.LastDiff.TypeReason,
+			Confidence:        top.Confidence,
+			DepotsChanged:     len(state.LastDiff.ChangedDepots),
+			FilesChanged:      len(state.LastDiff.NewFiles) + len(state.LastDiff.ChangedFiles) + len(state.LastDiff.RemovedFiles),
+			NewProtobufs:      len(state.LastDiff.NewProtobufs),
+			NewStrings:        len(state.LastDiff.NewStrings),
+			RemovedProtobufs:  len(state.LastDiff.RemovedProtobufs),
+			RemovedStrings:    len(state.LastDiff.RemovedStrings),
+			ModifiedStrings:   len(state.LastDiff.ModifiedStrings),
+			SuppressedStrings: state.LastDiff.Suppressed.Total(),
+			RebuiltBinaries:   len(state.LastDiff.RebuiltOnly()),
+			ChangedFunctions:  state.LastDiff.ChangedFunctions(),
 		}
 	}
 
@@ -133,15 +205,25 @@ func (s *Server) handleDiff(w http.ResponseWriter, r *http.Request) {
 	}
 
 	json.NewEncoder(w).Encode(DiffResponse{
-		HasDiff:      true,
-		OldVersion:   state.LastDiff.OldVersion,
-		NewVersion:   state.LastDiff.NewVersion,
-		Type:         string(state.LastDiff.Type),
-		TypeReason:   state.LastDiff.TypeReason,
-		Depots:       depots,
-		NewProtobufs: state.LastDiff.NewProtobufs,
-		NewStrings:   state.LastDiff.NewStrings,
-		Analysis:     state.LastDiff.Analysis,
+		HasDiff:          true,
+		OldVersion:       state.LastDiff.OldVersion,
+		NewVersion:       state.LastDiff.NewVersion,
+		Type:             string(state.LastDiff.Type),
+		TypeReason:       state.LastDiff.TypeReason,
+		Classification:   state.LastDiff.Classification,
+		Depots:           depots,
+		NewFiles:         state.LastDiff.NewFiles,
+		ChangedFiles:     state.LastDiff.ChangedFiles,
+		RemovedFiles:     state.LastDiff.RemovedFiles,
+		NewProtobufs:     state.LastDiff.NewProtobufs,
+		NewStrings:       state.LastDiff.NewStrings,
+		RemovedProtobufs: state.LastDiff.RemovedProtobufs,
+		RemovedStrings:   state.LastDiff.RemovedStrings,
+		ModifiedStrings:  state.LastDiff.ModifiedStrings,
+		Suppressed:       state.LastDiff.Suppressed,
+		Builds:           state.LastDiff.Builds,
+		FunctionDiffs:    state.LastDiff.FunctionDiffs,
+		Analysis:         state.LastDiff.Analysis,
 	})
 }
 
@@ -237,26 +319,36 @@ func (s *Server) handleDepots(w http.ResponseWriter, r *http.Request) {
 }
 
 type StatusResponse struct {
-	AppID         int         `json:"app_id"`
-	AppName       string      `json:"app_name"`
-	ChangeNumber  string      `json:"change_number"`
-	BuildID       string      `json:"build_id"`
-	PlayerCount   int         `json:"player_count"`
-	Status        string      `json:"status"`
-	UptimeSeconds int64       `json:"uptime_seconds"`
-	HasUpdate     bool        `json:"has_update"`
-	LastCheck     int64       `json:"last_check"`
-	LastUpdate    *UpdateInfo `json:"last_update,omitempty"`
+	AppID         int                         `json:"app_id"`
+	AppName       string                      `json:"app_name"`
+	ChangeNumber  string                      `json:"change_number"`
+	BuildID       string                      `json:"build_id"`
+	PlayerCount   int                         `json:"player_count"`
+	Status        string                      `json:"status"`
+	UptimeSeconds int64                       `json:"uptime_seconds"`
+	HasUpdate     bool                        `json:"has_update"`
+	LastCheck     int64                       `json:"last_check"`
+	LastUpdate    *UpdateInfo                 `json:"last_update,omitempty"`
+	Extraction    *monitor.ExtractionProgress `json:"extraction,omitempty"`
+	Jobs          []JobAPI                    `json:"jobs,omitempty"` // queued and running
 }
 
 type UpdateInfo struct {
-	OldVersion    string `json:"old_version"`
-	NewVersion    string `json:"new_version"`
-	Type          string `json:"type"`
-	TypeReason    string `json:"type_reason"`
-	DepotsChanged int    `json:"depots_changed"`
-	NewProtobufs  int    `json:"new_protobufs"`
-	NewStrings    int    `json:"new_strings"`
+	OldVersion        string  `json:"old_version"`
+	NewVersion        string  `json:"new_version"`
+	Type              string  `json:"type"`
+	TypeReason        string  `json:"type_reason"`
+	Confidence        float64 `json:"confidence"`
+	DepotsChanged     int     `json:"depots_changed"`
+	FilesChanged      int     `json:"files_changed"`
+	NewProtobufs      int     `json:"new_protobufs"`
+	NewStrings        int     `json:"new_strings"`
+	RemovedProtobufs  int     `json:"removed_protobufs"`
+	RemovedStrings    int     `json:"removed_strings"`
+	ModifiedStrings   int     `json:"modified_strings"`
+	SuppressedStrings int     `json:"suppressed_strings"`
+	RebuiltBinaries   int     `json:"rebuilt_binaries"`
+	ChangedFunctions  int     `json:"changed_functions"`
 }
 
 type HealthResponse struct {
@@ -265,15 +357,25 @@ type HealthResponse struct {
 }
 
 type DiffResponse struct {
-	HasDiff      bool             `json:"has_diff"`
-	OldVersion   string           `json:"old_version,omitempty"`
-	NewVersion   string           `json:"new_version,omitempty"`
-	Type         string           `json:"type,omitempty"`
-	TypeReason   string           `json:"type_reason,omitempty"`
-	Depots       []DepotChangeAPI `json:"depots,omitempty"`
-	NewProtobufs []string         `json:"new_protobufs,omitempty"`
-	NewStrings   []string         `json:"new_strings,omitempty"`
-	Analysis     string           `json:"analysis,omitempty"`
+	HasDiff          bool                           `json:"has_diff"`
+	OldVersion       string                         `json:"old_version,omitempty"`
+	NewVersion       string                         `json:"new_version,omitempty"`
+	Type             string                         `json:"type,omitempty"`
+	TypeReason       string                         `json:"type_reason,omitempty"`
+	Classification   diff.Classification            `json:"classification,omitempty"`
+	Depots           []DepotChangeAPI               `json:"depots,omitempty"`
+	NewFiles         []string                       `json:"new_files,omitempty"`
+	ChangedFiles     []string                       `json:"changed_files,omitempty"`
+	RemovedFiles     []string                       `json:"removed_files,omitempty"`
+	NewProtobufs     []string                       `json:"new_protobufs,omitempty"`
+	NewStrings       []string                       `json:"new_strings,omitempty"`
+	RemovedProtobufs []string                       `json:"removed_protobufs,omitempty"`
+	RemovedStrings   []string                       `json:"removed_strings,omitempty"`
+	ModifiedStrings  []extractor.StringModification `json:"modified_strings,omitempty"`
+	Suppressed       diff.Suppression               `json:"suppressed,omitempty"`
+	Builds           []extractor.BuildInfoChange    `json:"builds,omitempty"`
+	FunctionDiffs    []extractor.FunctionDiff       `json:"function_diffs,omitempty"`
+	Analysis         string                         `json:"analysis,omitempty"`
 }
 
 type DepotChangeAPI struct {
@@ -334,16 +436,27 @@ func (s *Server) handleServers(w http.ResponseWriter, r *http.Request) {
 }
 
 type DiffDetailsResponse struct {
-	HasData      bool            `json:"has_data"`
-	OldVersion   string          `json:"old_version"`
-	NewVersion   string          `json:"new_version"`
-	Type         string          `json:"type"`
-	TypeReason   string          `json:"type_reason"`
-	Analysis     string          `json:"analysis"`
-	StringBlocks []StringBlock   `json:"string_blocks"`
-	ProtobufList []string        `json:"protobuf_list"`
-	DepotBlocks  []DepotBlockAPI `json:"depot_blocks"`
-	Timestamp    int64           `json:"timestamp"`
+	HasData             bool                        `json:"has_data"`
+	OldVersion          string                      `json:"old_version"`
+	NewVersion          string                      `json:"new_version"`
+	Type                string                      `json:"type"`
+	TypeReason          string                      `json:"type_reason"`
+	Classification      diff.Classification         `json:"classification,omitempty"`
+	Analysis            string                      `json:"analysis"`
+	StringBlocks        []StringBlock               `json:"string_blocks"`
+	ProtobufList        []string                    `json:"protobuf_list"`
+	RemovedProtobufList []string                    `json:"removed_protobuf_list,omitempty"`
+	RemovedStringBlocks []StringBlock               `json:"removed_string_blocks,omitempty"`
+	StringChanges       []diff.FileStringChanges    `json:"string_changes,omitempty"`
+	Suppressed          diff.Suppression            `json:"suppressed,omitempty"`
+	DepotBlocks         []DepotBlockAPI             `json:"depot_blocks"`
+	ItemSchema          *items.SchemaDiff           `json:"item_schema,omitempty"`
+	Panorama            *diff.PanoramaDiff          `json:"panorama,omitempty"`
+	SymbolDiffs         []extractor.SymbolDiff      `json:"symbol_diffs,omitempty"`
+	ClassDiffs          []extractor.ClassDiff       `json:"class_diffs,omitempty"`
+	FunctionDiffs       []extractor.FunctionDiff    `json:"function_diffs,omitempty"`
+	Builds              []extractor.BuildInfoChange `json:"builds,omitempty"`
+	Timestamp           int64                       `json:"timestamp"`
 }
 
 type StringBlock struct {
@@ -404,6 +517,20 @@ func (s *Server) handleDiffDetails(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 
+	var removedBlocks []StringBlock
+	removedSource := diffData.CategorizedRemoved
+	if len(removedSource) == 0 && len(diffData.RemovedStrings) > 0 {
+		removedSource = diff.CategorizeStrings(diffData.RemovedStrings)
+	}
+	for _, cat := range removedSource {
+		removedBlocks = append(removedBlocks, StringBlock{
+			Category: cat.Category,
+			Icon:     cat.Icon,
+			Count:    cat.Count,
+			Strings:  cat.Strings,
+		})
+	}
+
 	depotBlocks := make([]DepotBlockAPI, 0, len(diffData.ChangedDepots))
 	for _, d := range diffData.ChangedDepots {
 		depotBlocks = append(depotBlocks, DepotBlockAPI{
@@ -416,21 +543,592 @@ func (s *Server) handleDiffDetails(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response := DiffDetailsResponse{
-		HasData:      true,
-		OldVersion:   diffData.OldVersion,
-		NewVersion:   diffData.NewVersion,
-		Type:         string(diffData.Type),
-		TypeReason:   diffData.TypeReason,
-		Analysis:     diffData.Analysis,
-		StringBlocks: stringBlocks,
-		ProtobufList: diffData.NewProtobufs,
-		DepotBlocks:  depotBlocks,
-		Timestamp:    time.Now().Unix(),
+		HasData:             true,
+		OldVersion:          diffData.OldVersion,
+		NewVersion:          diffData.NewVersion,
+		Type:                string(diffData.Type),
+		TypeReason:          diffData.TypeReason,
+		Classification:      diffData.Classification,
+		Analysis:            diffData.Analysis,
+		StringBlocks:        stringBlocks,
+		ProtobufList:        diffData.NewProtobufs,
+		RemovedProtobufList: diffData.RemovedProtobufs,
+		RemovedStringBlocks: removedBlocks,
+		StringChanges:       diffData.StringChanges,
+		Suppressed:          diffData.Suppressed,
+		DepotBlocks:         depotBlocks,
+		ItemSchema:          diffData.ItemSchema,
+		Panorama:            diffData.Panorama,
+		SymbolDiffs:         diffData.SymbolDiffs,
+		ClassDiffs:          diffData.ClassDiffs,
+		FunctionDiffs:       diffData.FunctionDiffs,
+		Builds:              diffData.Builds,
+		Timestamp:           time.Now().Unix(),
 	}
 
 	json.NewEncoder(w).Encode(response)
 }
 
+type LocalizationResponse struct {
+	HasData    bool                        `json:"has_data"`
+	OldVersion string                      `json:"old_version,omitempty"`
+	NewVersion string                      `json:"new_version,omitempty"`
+	Languages  []localization.LanguageDiff `json:"languages"`
+}
+
+// handleDiffLocalization serves the token diff of the last update, optionally
+// restricted to one language with ?lang=english.
+func (s *Server) handleDiffLocalization(w http.ResponseWriter, r *http.Request) {
+	setCORS(w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	state := s.mon.GetState()
+	if state.LastDiff == nil || state.LastDiff.Localization.IsEmpty() {
+		json.NewEncoder(w).Encode(LocalizationResponse{HasData: false, Languages: []localization.LanguageDiff{}})
+		return
+	}
+
+	languages := state.LastDiff.Localization.Languages
+	if lang := strings.ToLower(r.URL.Query().Get("lang")); lang != "" {
+		languages = []localization.LanguageDiff{}
+		if ld := state.LastDiff.Localization.Language(lang); ld != nil {
+			languages = append(languages, *ld)
+		}
+	}
+
+	json.NewEncoder(w).Encode(LocalizationResponse{
+		HasData:    true,
+		OldVersion: state.LastDiff.OldVersion,
+		NewVersion: state.LastDiff.NewVersion,
+		Languages:  languages,
+	})
+}
+
+type SearchResponse struct {
+	Query    string         `json:"query"`
+	Mode     string         `json:"mode"`
+	Category string         `json:"category,omitempty"`
+	Total    int            `json:"total"`
+	Limit    int            `json:"limit"`
+	Offset   int            `json:"offset"`
+	Results  []SearchHitAPI `json:"results"`
+}
+
+type SearchHitAPI struct {
+	Value     string         `json:"value"`
+	Category  string         `json:"category"`
+	Files     int            `json:"files"`
+	FirstSeen StringBuildAPI `json:"first_seen"`
+	LastSeen  StringBuildAPI `json:"last_seen"`
+}
+
+type StringBuildAPI struct {
+	ChangeNumber int64  `json:"change_number"`
+	DepotID      int    `json:"depot_id"`
+	ManifestID   string `json:"manifest_id"`
+	File         string `json:"file"`
+	IndexedAt    string `json:"indexed_at"`
+}
+
+type BuildsResponse struct {
+	DepotID    int                             `json:"depot_id"`
+	ManifestID string                          `json:"manifest_id"`
+	Files      map[string]*extractor.BuildInfo `json:"files"`
+}
+
+// handleBuilds returns the stored version and build metadata of a build's
+// binaries: /builds?depot=2347779&manifest=123
+func (s *Server) handleBuilds(w http.ResponseWriter, r *http.Request) {
+	setCORS(w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	depotID, err := strconv.Atoi(r.URL.Query().Get("depot"))
+	manifestID := r.URL.Query().Get("manifest")
+	if err != nil || manifestID == "" {
+		http.Error(w, "depot and manifest are required", http.StatusBadRequest)
+		return
+	}
+
+	files, err := s.mon.GetBuildInfo(depotID, manifestID)
+	if err != nil {
+		http.Error(w, "Failed to load build info: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(BuildsResponse{
+		DepotID:    depotID,
+		ManifestID: manifestID,
+		Files:      files,
+	})
+}
+
+// handleCache shows the depot cache usage on GET and evicts an entry on
+// DELETE /cache?entry=2347779_123. Pinned builds cannot be evicted.
+func (s *Server) handleCache(w http.ResponseWriter, r *http.Request) {
+	setCORS(w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		json.NewEncoder(w).Encode(s.mon.GetCacheUsage())
+
+	case "DELETE":
+		entry := r.URL.Query().Get("entry")
+		if entry == "" {
+			http.Error(w, "entry is required", http.StatusBadRequest)
+			return
+		}
+		freed, err := s.mon.EvictCacheEntry(entry)
+		switch {
+		case errors.Is(err, depot.ErrNotCached):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.Is(err, depot.ErrPinned):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "evicted", "entry": entry, "freed": freed})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleVerify re-checks cached builds against their manifests on
+// POST /verify, or one of them on POST /verify?entry=2347779_123. Corrupt
+// builds are quarantined and dropped from the cache.
+func (s *Server) handleVerify(w http.ResponseWriter, r *http.Request) {
+	setCORS(w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	results, err := s.mon.VerifyCache(r.URL.Query().Get("entry"))
+	switch {
+	case errors.Is(err, depot.ErrNotCached):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	quarantined := 0
+	for _, result := range results {
+		if result.Quarantined != "" {
+			quarantined++
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"checked": len(results), "quarantined": quarantined, "results": results})
+}
+
+type JobAPI struct {
+	ID           int64   `json:"id"`
+	ChangeNumber string  `json:"change_number"`
+	DepotID      int     `json:"depot_id"`
+	DepotName    string  `json:"depot_name"`
+	OldManifest  string  `json:"old_manifest"`
+	NewManifest  string  `json:"new_manifest"`
+	Analyze      bool    `json:"analyze"`
+	Status       string  `json:"status"`
+	Stage        string  `json:"stage,omitempty"`
+	Progress     float64 `json:"progress"`
+	BytesDone    int64   `json:"bytes_done"`
+	BytesTotal   int64   `json:"bytes_total"`
+	Error        string  `json:"error,omitempty"`
+	CreatedAt    int64   `json:"created_at"`
+	StartedAt    int64   `json:"started_at,omitempty"`
+	FinishedAt   int64   `json:"finished_at,omitempty"`
+}
+
+func jobToAPI(j database.Job) JobAPI {
+	api := JobAPI{
+		ID:           j.ID,
+		ChangeNumber: j.ChangeNumber,
+		DepotID:      j.DepotID,
+		DepotName:    j.DepotName,
+		OldManifest:  j.OldManifest,
+		NewManifest:  j.NewManifest,
+		Analyze:      j.Analyze,
+		Status:       j.Status,
+		Stage:        j.Stage,
+		Progress:     j.Progress,
+		BytesDone:    j.BytesDone,
+		BytesTotal:   j.BytesTotal,
+		Error:        j.Error,
+		CreatedAt:    j.CreatedAt.Unix(),
+	}
+	if !j.StartedAt.IsZero() {
+		api.StartedAt = j.StartedAt.Unix()
+	}
+	if !j.FinishedAt.IsZero() {
+		api.FinishedAt = j.FinishedAt.Unix()
+	}
+	return api
+}
+
+// handleJobs lists the download and analysis jobs on GET (/jobs?status=running,
+// /jobs?id=12) and cancels a queued or running job on DELETE /jobs?id=12.
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	setCORS(w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	var id int64
+	if v := r.URL.Query().Get("id"); v != "" {
+		var err error
+		if id, err = strconv.ParseInt(v, 10, 64); err != nil {
+			http.Error(w, "invalid id", http.StatusBadRequest)
+			return
+		}
+	}
+
+	switch r.Method {
+	case "GET":
+		if id != 0 {
+			job, err := s.mon.GetJob(id)
+			if errors.Is(err, monitor.ErrJobNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			json.NewEncoder(w).Encode(jobToAPI(*job))
+			return
+		}
+
+		limit := 50
+		if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 && v <= 500 {
+			limit = v
+		}
+		jobs, err := s.mon.GetJobs(r.URL.Query().Get("status"), limit)
+		if err != nil {
+			http.Error(w, "Failed to load jobs: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		list := make([]JobAPI, 0, len(jobs))
+		for _, job := range jobs {
+			list = append(list, jobToAPI(job))
+		}
+		json.NewEncoder(w).Encode(list)
+
+	case "DELETE":
+		if id == 0 {
+			http.Error(w, "id is required", http.StatusBadRequest)
+			return
+		}
+		err := s.mon.CancelJob(id)
+		switch {
+		case errors.Is(err, monitor.ErrJobNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.Is(err, monitor.ErrJobFinished):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "canceled", "id": id})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+type ImportRequest struct {
+	AppID        int    `json:"app_id"`
+	DepotID      int    `json:"depot_id"`
+	ManifestID   string `json:"manifest_id"`
+	Path         string `json:"path"`          // directory or archive on the server
+	ManifestPath string `json:"manifest_path"` // depot manifest to check the content against
+	Replace      bool   `json:"replace"`
+	Analyze      bool   `json:"analyze"`
+	Compare      string `json:"compare"` // older build to analyze against
+	Change       string `json:"change"`
+	OldChange    string `json:"old_change"`
+}
+
+// importPath resolves a server path named by an import request. It has to
+// lie under the import root, also after following symlinks.
+func (s *Server) importPath(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	if s.importRoot == "" {
+		return "", errors.New("importing server paths is disabled; upload the archive instead")
+	}
+	root, err := filepath.EvalSymlinks(s.importRoot)
+	if err != nil {
+		return "", fmt.Errorf("import root: %w", err)
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", fmt.Errorf("%s is not a file under the import root", path)
+	}
+	if rel, err := filepath.Rel(root, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is not a file under the import root", path)
+	}
+	return resolved, nil
+}
+
+type ImportResponse struct {
+	Entry *depot.CacheEntry `json:"entry,omitempty"`
+	JobID int64             `json:"job_id,omitempty"`
+}
+
+// handleImport registers local content as a build of a depot. With a JSON
+// body it names a directory or archive under the import root; any other body
+// is the archive itself, with the fields as query parameters:
+// POST /import?depot_id=2347779&manifest_id=123&analyze=1 < build.tar.gz
+// With analyze, an analysis job is queued for the build.
+func (s *Server) handleImport(w http.ResponseWriter, r *http.Request) {
+	setCORS(w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxUpload)
+	var req ImportRequest
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		path, err := s.importPath(req.Path)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		req.Path = path
+	} else {
+		q := r.URL.Query()
+		req.AppID, _ = strconv.Atoi(q.Get("app_id"))
+		req.DepotID, _ = strconv.Atoi(q.Get("depot_id"))
+		req.ManifestID = q.Get("manifest_id")
+		req.ManifestPath = q.Get("manifest_path")
+		req.Replace = q.Get("replace") == "1" || q.Get("replace") == "true"
+		req.Analyze = q.Get("analyze") == "1" || q.Get("analyze") == "true"
+		req.Compare = q.Get("compare")
+		req.Change = q.Get("change")
+		req.OldChange = q.Get("old_change")
+
+		upload, err := os.CreateTemp("", "astranet-import-*")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer os.Remove(upload.Name())
+		_, err = io.Copy(upload, r.Body)
+		upload.Close()
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("upload exceeds %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to read upload: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Path = upload.Name()
+	}
+	if req.ManifestPath != "" {
+		path, err := s.importPath(req.ManifestPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		req.ManifestPath = path
+	}
+
+	if req.AppID != 0 && req.AppID != s.mon.AppID() {
+		http.Error(w, fmt.Sprintf("this server monitors app %d", s.mon.AppID()), http.StatusBadRequest)
+		return
+	}
+	if req.DepotID == 0 || req.ManifestID == "" || req.Path == "" {
+		http.Error(w, "depot_id, manifest_id and path or an uploaded archive are required", http.StatusBadRequest)
+		return
+	}
+
+	var resp ImportResponse
+	entry, err := s.mon.ImportBuild(req.DepotID, req.ManifestID, req.Path, depot.ImportOptions{Manifest: req.ManifestPath, Replace: req.Replace})
+	switch {
+	case errors.Is(err, depot.ErrAlreadyCached) && req.Analyze:
+		// Analyze the build that is already there.
+	case errors.Is(err, depot.ErrAlreadyCached), errors.Is(err, monitor.ErrDepotBusy):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp.Entry = entry
+
+	if req.Analyze {
+		resp.JobID, err = s.mon.QueueAnalysis(monitor.AnalyzeRequest{
+			DepotID:     req.DepotID,
+			OldManifest: req.Compare,
+			NewManifest: req.ManifestID,
+			OldChange:   req.OldChange,
+			NewChange:   req.Change,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+type NoiseResponse struct {
+	MaxEntropy        float64       `json:"max_entropy"`
+	MinEntropyLength  int           `json:"min_entropy_length"`
+	MaxSymbolRatio    float64       `json:"max_symbol_ratio"`
+	VolatileRatio     float64       `json:"volatile_ratio"`
+	VolatileMinBuilds int           `json:"volatile_min_builds"`
+	Volatile          []VolatileAPI `json:"volatile"`
+}
+
+type VolatileAPI struct {
+	DepotID    int    `json:"depot_id"`
+	File       string `json:"file"`
+	Shape      string `json:"shape"`
+	Churned    int    `json:"churned"`
+	Builds     int    `json:"builds"`
+	LastChange int64  `json:"last_change"`
+}
+
+// handleNoise shows the noise filter thresholds and the learned volatile strings.
+func (s *Server) handleNoise(w http.ResponseWriter, r *http.Request) {
+	setCORS(w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	list, err := s.mon.GetVolatileStrings()
+	if err != nil {
+		http.Error(w, "Failed to load volatile strings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	volatile := make([]VolatileAPI, 0, len(list))
+	for _, v := range list {
+		volatile = append(volatile, VolatileAPI(v))
+	}
+
+	c := s.mon.GetNoiseConfig()
+	json.NewEncoder(w).Encode(NoiseResponse{
+		MaxEntropy:        c.MaxEntropy,
+		MinEntropyLength:  c.MinEntropyLength,
+		MaxSymbolRatio:    c.MaxSymbolRatio,
+		VolatileRatio:     c.VolatileRatio,
+		VolatileMinBuilds: c.VolatileMinBuilds,
+		Volatile:          volatile,
+	})
+}
+
+// handleSearch looks up indexed strings across all builds:
+// /search?q=weapon_taser&mode=text|prefix|regex&category=weapons&limit=50&offset=0
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	setCORS(w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	params := r.URL.Query()
+	q := database.StringSearch{
+		Query:    params.Get("q"),
+		Mode:     params.Get("mode"),
+		Category: params.Get("category"),
+		Limit:    50,
+	}
+	if q.Query == "" {
+		http.Error(w, "Missing q", http.StatusBadRequest)
+		return
+	}
+
+	// Shorthands: q=foo* for prefix, regex=1 for regex mode.
+	if q.Mode == "" {
+		switch {
+		case params.Get("regex") == "1" || params.Get("regex") == "true":
+			q.Mode = database.SearchRegex
+		case strings.HasSuffix(q.Query, "*"):
+			q.Mode = database.SearchPrefix
+			q.Query = strings.TrimSuffix(q.Query, "*")
+		default:
+			q.Mode = database.SearchText
+		}
+	}
+	switch q.Mode {
+	case database.SearchText, database.SearchPrefix:
+	case database.SearchRegex:
+		if _, err := regexp.Compile(q.Query); err != nil {
+			http.Error(w, "Invalid regex: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Invalid mode", http.StatusBadRequest)
+		return
+	}
+
+	if v, err := strconv.Atoi(params.Get("limit")); err == nil && v > 0 {
+		q.Limit = min(v, 500)
+	}
+	if v, err := strconv.Atoi(params.Get("offset")); err == nil && v > 0 {
+		q.Offset = v
+	}
+
+	hits, total, err := s.mon.SearchStrings(q)
+	if err != nil {
+		http.Error(w, "Search failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	results := make([]SearchHitAPI, 0, len(hits))
+	for _, h := range hits {
+		results = append(results, SearchHitAPI{
+			Value:     h.Value,
+			Category:  h.Category,
+			Files:     h.Files,
+			FirstSeen: StringBuildAPI(h.FirstSeen),
+			LastSeen:  StringBuildAPI(h.LastSeen),
+		})
+	}
+
+	json.NewEncoder(w).Encode(SearchResponse{
+		Query:    q.Query,
+		Mode:     q.Mode,
+		Category: q.Category,
+		Total:    total,
+		Limit:    q.Limit,
+		Offset:   q.Offset,
+		Results:  results,
+	})
+}
+
 func getDepotPlatform(depotID string) string {
 	platforms := map[string]string{
 		"731":     "Windows",
@@ -559,3 +1257,49 @@ func (s *Server) handleWebhooks(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
+
+func (s *Server) handleRules(w http.ResponseWriter, r *http.Request) {
+	setCORS(w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	engine := rules.Active()
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"source":   engine.Source(),
+		"rule_set": engine.RuleSet(),
+	})
+}
+
+// handleRulesTest runs the active rules against a posted corpus
+// ({"strings": [...]} or {"cases": [{"expected", "value"}]}), or the built-in sample on GET.
+func (s *Server) handleRulesTest(w http.ResponseWriter, r *http.Request) {
+	setCORS(w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	var cases []rules.CorpusCase
+	switch r.Method {
+	case "GET":
+		cases = rules.ParseCorpus(rules.DefaultCorpus)
+	case "POST":
+		var req struct {
+			Strings []string           `json:"strings"`
+			Cases   []rules.CorpusCase `json:"cases"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		cases = req.Cases
+		for _, str := range req.Strings {
+			cases = append(cases, rules.CorpusCase{Value: str})
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	json.NewEncoder(w).Encode(rules.Active().Test(cases))
+}
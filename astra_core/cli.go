@@ -0,0 +1,239 @@
+package main
+
+import (
+	"astra_core/database"
+	"astra_core/depot"
+	"astra_core/monitor"
+	"astra_core/rules"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// runCommand handles one-shot subcommands (astranet <command> ...) and
+// returns the process exit code.
+func runCommand(args []string) int {
+	switch args[0] {
+	case "rules":
+		return runRulesCommand(args[1:])
+	case "import":
+		return runImportCommand(args[1:])
+	case "verify":
+		return runVerifyCommand(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+		printUsage()
+		return 2
+	}
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "usage: astranet [command]")
+	fmt.Fprintln(os.Stderr, "  (no command)              run the monitor and API server")
+	fmt.Fprintln(os.Stderr, "  rules show                print the active classification rules")
+	fmt.Fprintln(os.Stderr, "  rules test [corpus.txt]   run the rules against a string corpus (default: built-in sample)")
+	fmt.Fprintln(os.Stderr, "  import [flags] <depot> <manifest> <dir|archive>")
+	fmt.Fprintln(os.Stderr, "                            register local content as a build; -h lists the flags")
+	fmt.Fprintln(os.Stderr, "  verify [entry...]         re-check cached builds (default: all) and quarantine corrupt ones")
+}
+
+func runRulesCommand(args []string) int {
+	if len(args) == 0 {
+		printUsage()
+		return 2
+	}
+	engine := rules.Active()
+
+	switch args[0] {
+	case "show":
+		out, _ := json.MarshalIndent(engine.RuleSet(), "", "  ")
+		fmt.Println(string(out))
+		return 0
+
+	case "test":
+		corpus := rules.DefaultCorpus
+		if len(args) > 1 {
+			data, err := os.ReadFile(args[1])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to read corpus: %v\n", err)
+				return 1
+			}
+			corpus = data
+		}
+
+		report := engine.Test(rules.ParseCorpus(corpus))
+		for _, r := range report.Results {
+			status := "ok  "
+			if !r.Pass {
+				status = "FAIL"
+			}
+			fmt.Printf("%s %-10s %-20s %s\n", status, r.Category, r.Rule, r.Value)
+			if !r.Pass {
+				fmt.Printf("     expected %s\n", r.Expected)
+			}
+		}
+		fmt.Printf("\n%d strings, %d failed (rules: %s)\n", report.Total, report.Failed, report.Source)
+		if len(report.UnusedRule) > 0 {
+			fmt.Printf("rules with no hits: %v\n", report.UnusedRule)
+		}
+		if report.Failed > 0 {
+			return 1
+		}
+		return 0
+
+	default:
+		printUsage()
+		return 2
+	}
+}
+
+// lockCache takes the depot cache for a command. While the server runs it
+// owns the cache, and the command has to go through its API instead.
+func lockCache(endpoint string) bool {
+	err := depot.LockCache()
+	switch {
+	case errors.Is(err, depot.ErrCacheInUse):
+		fmt.Fprintf(os.Stderr, "the depot cache is in use, most likely by the running server; use its %s instead\n", endpoint)
+		return false
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "failed to lock the depot cache: %v\n", err)
+		return false
+	}
+	return true
+}
+
+// runImportCommand registers a directory or archive as a build in the depot
+// cache and optionally analyzes it, without Steam access.
+func runImportCommand(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	appID := fs.Int("app", 0, "app id (default: APP_ID or 730)")
+	manifest := fs.String("manifest", "", "depot manifest of the build, to check the content against")
+	replace := fs.Bool("replace", false, "replace the build if it is already cached")
+	analyze := fs.Bool("analyze", false, "analyze the build after importing it")
+	compare := fs.String("compare", "", "manifest id of an older cached or indexed build to compare against (with -analyze)")
+	change := fs.String("change", "", "change number of the build, for the string index history")
+	oldChange := fs.String("old-change", "", "change number of the -compare build")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 3 {
+		fmt.Fprintln(os.Stderr, "usage: astranet import [flags] <depot> <manifest> <dir|archive>")
+		fs.PrintDefaults()
+		return 2
+	}
+	depotID, err := strconv.Atoi(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid depot id %q\n", fs.Arg(0))
+		return 2
+	}
+	manifestID, source := fs.Arg(1), fs.Arg(2)
+	if *appID == 0 {
+		if *appID, err = strconv.Atoi(getEnv("APP_ID", "730")); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid APP_ID: %v\n", err)
+			return 2
+		}
+	}
+	opts := depot.ImportOptions{Manifest: *manifest, Replace: *replace}
+	if !lockCache("POST /import") {
+		return 1
+	}
+
+	if !*analyze {
+		entry, err := depot.NewDownloader(*appID).Import(depotID, manifestID, source, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "import failed: %v\n", err)
+			return 1
+		}
+		fmt.Printf("imported %s: %d files, %d bytes\n", entry.Name, entry.Files, entry.Size)
+		return 0
+	}
+
+	db, err := database.NewDB(getEnv("DB_PATH", "astranet.db"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open database: %v\n", err)
+		return 1
+	}
+	mon := monitor.NewMonitor(*appID, db)
+	entry, err := mon.ImportBuild(depotID, manifestID, source, opts)
+	if err != nil && !errors.Is(err, depot.ErrAlreadyCached) {
+		fmt.Fprintf(os.Stderr, "import failed: %v\n", err)
+		return 1
+	}
+	if entry != nil {
+		fmt.Printf("imported %s: %d files, %d bytes\n", entry.Name, entry.Files, entry.Size)
+	} else {
+		fmt.Printf("build %d_%s is already cached, analyzing it\n", depotID, manifestID)
+	}
+
+	result, err := mon.RunAnalysis(monitor.AnalyzeRequest{
+		DepotID:     depotID,
+		OldManifest: *compare,
+		NewManifest: manifestID,
+		OldChange:   *oldChange,
+		NewChange:   *change,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	fmt.Println(result.Analysis)
+	fmt.Printf("%d new strings, %d removed, %d modified\n", len(result.NewStrings), len(result.RemovedStrings), len(result.ModifiedStrings))
+	return 0
+}
+
+// runVerifyCommand re-checks cached builds against their manifests. It exits
+// with 1 when any build was corrupt.
+func runVerifyCommand(args []string) int {
+	appID, err := strconv.Atoi(getEnv("APP_ID", "730"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid APP_ID: %v\n", err)
+		return 2
+	}
+	if !lockCache("POST /verify") {
+		return 1
+	}
+	d := depot.NewDownloader(appID)
+
+	var results []depot.VerifyResult
+	if len(args) == 0 {
+		results = d.VerifyAll()
+	}
+	for _, name := range args {
+		result, err := d.Verify(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			if result == nil {
+				return 1
+			}
+		}
+		results = append(results, *result)
+	}
+
+	corrupt := 0
+	for _, r := range results {
+		switch {
+		case r.Against == "":
+			fmt.Printf("skip %s: no manifest or tree index to check against\n", r.Name)
+		case len(r.Problems) == 0:
+			fmt.Printf("ok   %s: %d files match the %s\n", r.Name, r.Files, r.Against)
+		default:
+			corrupt++
+			where := "not quarantined"
+			if r.Quarantined != "" {
+				where = "quarantined in " + r.Quarantined
+			}
+			fmt.Printf("BAD  %s: %d problem(s), %s\n", r.Name, len(r.Problems), where)
+			for _, p := range r.Problems {
+				fmt.Printf("     %s\n", p)
+			}
+		}
+	}
+	fmt.Printf("\n%d builds checked, %d corrupt\n", len(results), corrupt)
+	if corrupt > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,279 @@
+// Command fakesteamcmd stands in for steamcmd.sh so the monitor pipeline can
+// run without network access. Point STEAMCMD_PATH at the binary and
+// FAKESTEAMCMD_FIXTURES at a fixture directory:
+//
+//	app_info/<app>/*.txt                    recorded app_info_print outputs, replayed
+//	                                        one per call in name order; the last repeats
+//	depots/<depot>/<manifest>/...           the files of a build
+//	manifests/<depot>_<manifest>.manifest   its manifest; downloads are checked against it
+//
+// +download_depot copies the build into <install dir>/steamapps/content/
+// app_<app>/depot_<depot>, where the install dir is +force_install_dir or the
+// binary's directory, and puts the manifest into the binary's depotcache
+// directory, as steamcmd does. FAKESTEAMCMD_FILE_DELAY slows each file down,
+// e.g. to exercise cancellation.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func main() {
+	fixtures := os.Getenv("FAKESTEAMCMD_FIXTURES")
+	if fixtures == "" {
+		fmt.Println("FAKESTEAMCMD_FIXTURES is not set")
+		os.Exit(1)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	s := &session{fixtures: fixtures, home: filepath.Dir(exe), installDir: filepath.Dir(exe)}
+	if v, err := time.ParseDuration(os.Getenv("FAKESTEAMCMD_FILE_DELAY")); err == nil {
+		s.delay = v
+	}
+
+	fmt.Println("Redirecting stderr to 'logs/stderr.txt'")
+	fmt.Println("Loading Steam API...OK")
+	if err := s.run(os.Args[1:]); err != nil {
+		fmt.Printf("ERROR! %v\n", err)
+	}
+}
+
+type session struct {
+	fixtures   string
+	home       string // the directory steamcmd lives in
+	installDir string
+	delay      time.Duration
+}
+
+// run executes the +commands in order, each with the arguments up to the
+// next +command.
+func (s *session) run(args []string) error {
+	for len(args) > 0 {
+		cmd := args[0]
+		if !strings.HasPrefix(cmd, "+") {
+			return fmt.Errorf("unexpected argument %q", cmd)
+		}
+		n := 1
+		for n < len(args) && !strings.HasPrefix(args[n], "+") {
+			n++
+		}
+		params := args[1:n]
+		args = args[n:]
+
+		switch strings.TrimPrefix(cmd, "+") {
+		case "login":
+			user := "anonymous"
+			if len(params) > 0 {
+				user = params[0]
+			}
+			fmt.Printf("Logging in user '%s' to Steam Public...OK\n", user)
+			fmt.Println("Waiting for user info...OK")
+		case "force_install_dir":
+			if len(params) != 1 {
+				return fmt.Errorf("force_install_dir needs a directory")
+			}
+			dir, err := filepath.Abs(params[0])
+			if err != nil {
+				return err
+			}
+			s.installDir = dir
+		case "app_info_update":
+		case "app_info_print":
+			if len(params) != 1 {
+				return fmt.Errorf("app_info_print needs an app id")
+			}
+			if err := s.appInfoPrint(params[0]); err != nil {
+				return err
+			}
+		case "download_depot":
+			if len(params) < 3 {
+				return fmt.Errorf("download_depot needs app, depot and manifest")
+			}
+			var filelist string
+			if len(params) > 3 {
+				filelist = params[3]
+			}
+			if err := s.downloadDepot(params[0], params[1], params[2], filelist); err != nil {
+				return err
+			}
+		case "quit":
+			return nil
+		default:
+			if !strings.HasPrefix(cmd, "+@") {
+				return fmt.Errorf("unknown command %q", cmd)
+			}
+		}
+	}
+	return nil
+}
+
+// appInfoPrint replays the next recorded output of the app. The position is
+// kept in a .state directory of the fixtures.
+func (s *session) appInfoPrint(appID string) error {
+	recordings, _ := filepath.Glob(filepath.Join(s.fixtures, "app_info", appID, "*.txt"))
+	if len(recordings) == 0 {
+		return fmt.Errorf("no app info recorded for app %s", appID)
+	}
+	sort.Strings(recordings)
+
+	stateDir := filepath.Join(s.fixtures, ".state")
+	stateFile := filepath.Join(stateDir, "app_info_"+appID)
+	calls := 0
+	if data, err := os.ReadFile(stateFile); err == nil {
+		calls, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+	}
+	i := min(calls, len(recordings)-1)
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(stateFile, []byte(strconv.Itoa(calls+1)), 0644); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(recordings[i])
+	if err != nil {
+		return err
+	}
+	os.Stdout.Write(data)
+	return nil
+}
+
+func (s *session) downloadDepot(appID, depotID, manifestID, filelist string) error {
+	src := filepath.Join(s.fixtures, "depots", depotID, manifestID)
+	if info, err := os.Stat(src); err != nil || !info.IsDir() {
+		return fmt.Errorf("Download item 0 failed (Manifest not available)")
+	}
+	match, err := readFilelist(filelist)
+	if err != nil {
+		return err
+	}
+
+	manifest := filepath.Join(s.fixtures, "manifests", depotID+"_"+manifestID+".manifest")
+	if _, err := os.Stat(manifest); err == nil {
+		cache := filepath.Join(s.home, "depotcache")
+		if err := os.MkdirAll(cache, 0755); err != nil {
+			return err
+		}
+		if err := copyFile(manifest, filepath.Join(cache, filepath.Base(manifest))); err != nil {
+			return err
+		}
+	}
+
+	type file struct {
+		rel  string
+		size int64
+	}
+	var files []file
+	var total int64
+	err = filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		rel, _ := filepath.Rel(src, path)
+		rel = filepath.ToSlash(rel)
+		if match(rel) {
+			files = append(files, file{rel, info.Size()})
+			total += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	dst := filepath.Join(s.installDir, "steamapps", "content", "app_"+appID, "depot_"+depotID)
+	fmt.Printf("Downloading depot %s (%d MB) ...\n", depotID, total>>20)
+	var done int64
+	for _, f := range files {
+		if s.delay > 0 {
+			time.Sleep(s.delay)
+		}
+		target := filepath.Join(dst, filepath.FromSlash(f.rel))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := copyFile(filepath.Join(src, filepath.FromSlash(f.rel)), target); err != nil {
+			return err
+		}
+		done += f.size
+		percent := 100.0
+		if total > 0 {
+			percent = float64(done) * 100 / float64(total)
+		}
+		fmt.Printf(" Update state (0x61) downloading, progress: %.2f (%d / %d)\r", percent, done, total)
+	}
+	fmt.Printf("\nDepot download complete : \"%s\" (%d files, manifest %s)\n", dst, len(files), manifestID)
+	return nil
+}
+
+// readFilelist returns the filter of a steamcmd filelist: depot paths, one
+// per line, or regex: patterns. No filelist matches everything.
+func readFilelist(path string) (func(string) bool, error) {
+	if path == "" {
+		return func(string) bool { return true }, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	names := make(map[string]bool)
+	var patterns []*regexp.Regexp
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if expr, ok := strings.CutPrefix(line, "regex:"); ok {
+			re, err := regexp.Compile("(?i)" + expr)
+			if err != nil {
+				return nil, err
+			}
+			patterns = append(patterns, re)
+			continue
+		}
+		names[strings.ToLower(strings.ReplaceAll(line, `\`, "/"))] = true
+	}
+	return func(rel string) bool {
+		if names[strings.ToLower(rel)] {
+			return true
+		}
+		for _, re := range patterns {
+			if re.MatchString(rel) {
+				return true
+			}
+		}
+		return false
+	}, scanner.Err()
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,86 @@
+package database
+
+// VolatileString is a string shape (digits collapsed, see extractor.StringShape)
+// that changed in most build diffs of a file.
+type VolatileString struct {
+	DepotID    int
+	File       string
+	Shape      string
+	Churned    int // build diffs the shape changed in
+	Builds     int // build diffs of the file
+	LastChange int64
+}
+
+// RecordStringChurn counts one build diff of a file and the shapes that changed
+// in it. A change number is only counted once per file, so re-analyzing an
+// update does not inflate the counts.
+func (db *DB) RecordStringChurn(appID, depotID int, file string, changeNumber int64, shapes []string) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+	INSERT INTO string_churn_files (app_id, depot_id, file, builds, last_change)
+	VALUES (?, ?, ?, 1, ?)
+	ON CONFLICT(app_id, depot_id, file) DO UPDATE
+	SET builds = builds + 1,
+		last_change = excluded.last_change
+	WHERE excluded.last_change > last_change;
+	`, appID, depotID, file, changeNumber)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+
+	stmt, err := tx.Prepare(`
+	INSERT INTO string_churn (app_id, depot_id, file, shape, churned, last_change)
+	VALUES (?, ?, ?, ?, 1, ?)
+	ON CONFLICT(app_id, depot_id, file, shape) DO UPDATE
+	SET churned = churned + 1,
+		last_change = excluded.last_change;
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, shape := range shapes {
+		if _, err := stmt.Exec(appID, depotID, file, shape, changeNumber); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetVolatileStrings returns the shapes that churned in at least ratio of a
+// file's build diffs, once the file has minBuilds diffs. An empty file matches
+// every file of the depot; depotID 0 matches every depot.
+func (db *DB) GetVolatileStrings(appID, depotID int, file string, ratio float64, minBuilds int) ([]VolatileString, error) {
+	query := `
+	SELECT c.depot_id, c.file, c.shape, c.churned, f.builds, c.last_change
+	FROM string_churn c
+	JOIN string_churn_files f ON f.app_id = c.app_id AND f.depot_id = c.depot_id AND f.file = c.file
+	WHERE c.app_id = ? AND (? = 0 OR c.depot_id = ?) AND (? = '' OR c.file = ?)
+		AND f.builds >= ? AND c.churned >= ? * f.builds
+	ORDER BY c.depot_id, c.file, c.shape
+	`
+	rows, err := db.conn.Query(query, appID, depotID, depotID, file, file, minBuilds, ratio)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []VolatileString
+	for rows.Next() {
+		var v VolatileString
+		if err := rows.Scan(&v.DepotID, &v.File, &v.Shape, &v.Churned, &v.Builds, &v.LastChange); err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,44 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestStringChurnCountsEachChangeOnce(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const file = "game/csgo/bin/win64/server.dll"
+	record := func(change int64, shapes ...string) {
+		t.Helper()
+		if err := db.RecordStringChurn(730, 2347779, file, change, shapes); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	record(1000, "build 0", "date 0")
+	record(1001, "build 0")
+	// Analyzing change 1001 again must not count it twice.
+	record(1001, "build 0", "date 0")
+	record(1002, "build 0")
+
+	list, err := db.GetVolatileStrings(730, 2347779, file, 0.6, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("volatile strings %+v, want only the build shape", list)
+	}
+	if v := list[0]; v.Shape != "build 0" || v.Churned != 3 || v.Builds != 3 || v.LastChange != 1002 {
+		t.Errorf("volatile string %+v, want build 0 churned in 3 of 3 builds up to 1002", v)
+	}
+
+	if list, err := db.GetVolatileStrings(730, 2347779, file, 0.6, 4); err != nil || len(list) != 0 {
+		t.Errorf("volatile strings before enough builds: %+v, %v; want none", list, err)
+	}
+	if list, err := db.GetVolatileStrings(730, 0, "", 0.3, 3); err != nil || len(list) != 2 {
+		t.Errorf("volatile strings of every depot at a lower ratio: %+v, %v; want both shapes", list, err)
+	}
+}
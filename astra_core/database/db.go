@@ -6,16 +6,15 @@ import (
 	"database/sql"
 	"encoding/base64"
 	"io"
-
-	_ "github.com/mattn/go-sqlite3"
 )
 
 type DB struct {
 	conn *sql.DB
+	fts  bool // FTS5 string search available
 }
 
 func NewDB(connStr string) (*DB, error) {
-	conn, err := sql.Open("sqlite3", connStr)
+	conn, err := sql.Open(driverName, connStr)
 	if err != nil {
 		return nil, err
 	}
@@ -23,11 +22,14 @@ func NewDB(connStr string) (*DB, error) {
 	if err := conn.Ping(); err != nil {
 		return nil, err
 	}
+	// SQLite allows one writer; extraction workers store artifacts concurrently.
+	conn.SetMaxOpenConns(1)
 
 	db := &DB{conn: conn}
 	if err := db.migrate(); err != nil {
 		return nil, err
 	}
+	db.migrateSearch()
 
 	return db, nil
 }
@@ -47,6 +49,95 @@ func (db *DB) migrate() error {
 		url TEXT PRIMARY KEY,
 		added_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
+	CREATE TABLE IF NOT EXISTS binary_artifacts (
+		app_id INTEGER,
+		depot_id INTEGER,
+		manifest_id TEXT,
+		file TEXT,
+		kind TEXT,
+		data_gz BLOB,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (app_id, depot_id, manifest_id, file, kind)
+	);
+	CREATE TABLE IF NOT EXISTS string_values (
+		id INTEGER PRIMARY KEY,
+		value TEXT NOT NULL UNIQUE,
+		category TEXT,
+		first_change INTEGER,
+		first_file INTEGER,
+		last_change INTEGER,
+		last_file INTEGER
+	);
+	CREATE TABLE IF NOT EXISTS string_files (
+		id INTEGER PRIMARY KEY,
+		app_id INTEGER NOT NULL,
+		depot_id INTEGER NOT NULL,
+		manifest_id TEXT NOT NULL,
+		file TEXT NOT NULL,
+		change_number INTEGER,
+		string_count INTEGER,
+		indexed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (app_id, depot_id, manifest_id, file)
+	);
+	CREATE TABLE IF NOT EXISTS string_membership (
+		file_id INTEGER NOT NULL,
+		string_id INTEGER NOT NULL,
+		PRIMARY KEY (file_id, string_id)
+	) WITHOUT ROWID;
+	CREATE INDEX IF NOT EXISTS idx_string_membership_string ON string_membership (string_id);
+	CREATE TABLE IF NOT EXISTS string_builds (
+		app_id INTEGER,
+		depot_id INTEGER,
+		manifest_id TEXT,
+		change_number INTEGER,
+		file_count INTEGER,
+		indexed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (app_id, depot_id, manifest_id)
+	);
+	CREATE TABLE IF NOT EXISTS string_churn_files (
+		app_id INTEGER,
+		depot_id INTEGER,
+		file TEXT,
+		builds INTEGER,
+		last_change INTEGER,
+		PRIMARY KEY (app_id, depot_id, file)
+	);
+	CREATE TABLE IF NOT EXISTS string_churn (
+		app_id INTEGER,
+		depot_id INTEGER,
+		file TEXT,
+		shape TEXT,
+		churned INTEGER,
+		last_change INTEGER,
+		PRIMARY KEY (app_id, depot_id, file, shape)
+	);
+	CREATE TABLE IF NOT EXISTS jobs (
+		id INTEGER PRIMARY KEY,
+		app_id INTEGER NOT NULL,
+		change_number TEXT,
+		depot_id INTEGER NOT NULL,
+		depot_name TEXT,
+		old_manifest TEXT,
+		new_manifest TEXT,
+		analysis INTEGER,
+		status TEXT NOT NULL,
+		stage TEXT,
+		progress REAL DEFAULT 0,
+		bytes_done INTEGER DEFAULT 0,
+		bytes_total INTEGER DEFAULT 0,
+		error TEXT,
+		created_at INTEGER,
+		started_at INTEGER,
+		finished_at INTEGER
+	);
+	CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs (app_id, status);
+	CREATE TABLE IF NOT EXISTS pending_updates (
+		app_id INTEGER NOT NULL,
+		change_number TEXT NOT NULL,
+		diff_gz BLOB,
+		created_at INTEGER,
+		PRIMARY KEY (app_id, change_number)
+	);
 	`
 	_, err := db.conn.Exec(query)
 	return err
@@ -109,6 +200,64 @@ func (db *DB) GetLastDiff(appID int) ([]byte, error) {
 	return decompressGzip(compressed)
 }
 
+// SaveBinaryArtifact stores a JSON-encoded analysis result (symbols, classes, ...)
+// for one file of a build, so later diffs don't need the old download.
+func (db *DB) SaveBinaryArtifact(appID, depotID int, manifestID, file, kind string, dataJSON []byte) error {
+	compressed, err := compressGzip(dataJSON)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO binary_artifacts (app_id, depot_id, manifest_id, file, kind, data_gz)
+	VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT(app_id, depot_id, manifest_id, file, kind) DO UPDATE
+	SET data_gz = excluded.data_gz,
+		created_at = CURRENT_TIMESTAMP;
+	`
+	_, err = db.conn.Exec(query, appID, depotID, manifestID, file, kind, compressed)
+	return err
+}
+
+// GetBinaryArtifact returns the stored JSON, or nil if the file was never analyzed for that build.
+func (db *DB) GetBinaryArtifact(appID, depotID int, manifestID, file, kind string) ([]byte, error) {
+	var compressed []byte
+	query := `SELECT data_gz FROM binary_artifacts WHERE app_id = ? AND depot_id = ? AND manifest_id = ? AND file = ? AND kind = ?`
+	err := db.conn.QueryRow(query, appID, depotID, manifestID, file, kind).Scan(&compressed)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decompressGzip(compressed)
+}
+
+// GetBinaryArtifacts returns the stored JSON of one kind for every file of a build, by file.
+func (db *DB) GetBinaryArtifacts(appID, depotID int, manifestID, kind string) (map[string][]byte, error) {
+	query := `SELECT file, data_gz FROM binary_artifacts WHERE app_id = ? AND depot_id = ? AND manifest_id = ? AND kind = ? ORDER BY file`
+	rows, err := db.conn.Query(query, appID, depotID, manifestID, kind)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	artifacts := make(map[string][]byte)
+	for rows.Next() {
+		var file string
+		var compressed []byte
+		if err := rows.Scan(&file, &compressed); err != nil {
+			return nil, err
+		}
+		data, err := decompressGzip(compressed)
+		if err != nil {
+			return nil, err
+		}
+		artifacts[file] = data
+	}
+	return artifacts, rows.Err()
+}
+
 func compressGzip(data []byte) ([]byte, error) {
 	var buf bytes.Buffer
 	w, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
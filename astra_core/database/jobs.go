@@ -0,0 +1,178 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Job statuses.
+const (
+	JobQueued   = "queued"
+	JobRunning  = "running"
+	JobDone     = "done"
+	JobFailed   = "failed"
+	JobCanceled = "canceled"
+)
+
+// Job is the persisted record of one depot download and analysis. Times are
+// zero until the job reaches them.
+type Job struct {
+	ID           int64
+	AppID        int
+	ChangeNumber string
+	DepotID      int
+	DepotName    string
+	OldManifest  string
+	NewManifest  string
+	Analyze      bool
+	Status       string
+	Stage        string
+	Progress     float64 // percent of the current stage
+	BytesDone    int64
+	BytesTotal   int64
+	Error        string
+	CreatedAt    time.Time
+	StartedAt    time.Time
+	FinishedAt   time.Time
+}
+
+// Finished reports whether the job reached a final status.
+func (j *Job) Finished() bool {
+	return j.Status == JobDone || j.Status == JobFailed || j.Status == JobCanceled
+}
+
+// CreateJob stores a new job and sets its ID.
+func (db *DB) CreateJob(j *Job) error {
+	if j.CreatedAt.IsZero() {
+		j.CreatedAt = time.Now()
+	}
+	res, err := db.conn.Exec(`
+	INSERT INTO jobs (app_id, change_number, depot_id, depot_name, old_manifest, new_manifest, analysis, status, stage, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, j.AppID, j.ChangeNumber, j.DepotID, j.DepotName, j.OldManifest, j.NewManifest, j.Analyze, j.Status, j.Stage, j.CreatedAt.Unix())
+	if err != nil {
+		return err
+	}
+	j.ID, err = res.LastInsertId()
+	return err
+}
+
+// UpdateJob saves a job's status, progress and times.
+func (db *DB) UpdateJob(j *Job) error {
+	_, err := db.conn.Exec(`
+	UPDATE jobs SET status = ?, stage = ?, progress = ?, bytes_done = ?, bytes_total = ?, error = ?, started_at = ?, finished_at = ?
+	WHERE id = ?
+	`, j.Status, j.Stage, j.Progress, j.BytesDone, j.BytesTotal, j.Error, unixOrNull(j.StartedAt), unixOrNull(j.FinishedAt), j.ID)
+	return err
+}
+
+// GetJob returns a job, or nil if there is none with the ID.
+func (db *DB) GetJob(id int64) (*Job, error) {
+	jobs, err := db.queryJobs(`WHERE id = ?`, id)
+	if err != nil || len(jobs) == 0 {
+		return nil, err
+	}
+	return &jobs[0], nil
+}
+
+// GetJobs returns the newest jobs of an app, optionally of one status.
+func (db *DB) GetJobs(appID int, status string, limit int) ([]Job, error) {
+	return db.queryJobs(`WHERE app_id = ? AND (? = '' OR status = ?) ORDER BY id DESC LIMIT ?`, appID, status, status, limit)
+}
+
+// FailUnfinishedJobs marks the jobs a previous run left queued or running as
+// failed, and returns how many there were.
+func (db *DB) FailUnfinishedJobs(appID int, reason string) (int64, error) {
+	res, err := db.conn.Exec(`
+	UPDATE jobs SET status = ?, error = ?, finished_at = ?
+	WHERE app_id = ? AND status IN (?, ?)
+	`, JobFailed, reason, time.Now().Unix(), appID, JobQueued, JobRunning)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (db *DB) queryJobs(where string, args ...any) ([]Job, error) {
+	rows, err := db.conn.Query(`
+	SELECT id, app_id, change_number, depot_id, depot_name, old_manifest, new_manifest, analysis, status,
+		stage, progress, bytes_done, bytes_total, error, created_at, started_at, finished_at
+	FROM jobs `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []Job
+	for rows.Next() {
+		var j Job
+		var stage, errMsg sql.NullString
+		var created, started, finished sql.NullInt64
+		if err := rows.Scan(&j.ID, &j.AppID, &j.ChangeNumber, &j.DepotID, &j.DepotName, &j.OldManifest, &j.NewManifest, &j.Analyze, &j.Status,
+			&stage, &j.Progress, &j.BytesDone, &j.BytesTotal, &errMsg, &created, &started, &finished); err != nil {
+			return nil, err
+		}
+		j.Stage, j.Error = stage.String, errMsg.String
+		j.CreatedAt, j.StartedAt, j.FinishedAt = fromUnix(created), fromUnix(started), fromUnix(finished)
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+func unixOrNull(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.Unix()
+}
+
+func fromUnix(v sql.NullInt64) time.Time {
+	if !v.Valid {
+		return time.Time{}
+	}
+	return time.Unix(v.Int64, 0)
+}
+
+// SavePendingUpdate stores the diff of an update whose depot jobs were
+// queued, as it was before any of them ran, so a restart can queue them again.
+func (db *DB) SavePendingUpdate(appID int, changeNumber string, diffJSON []byte) error {
+	compressed, err := compressGzip(diffJSON)
+	if err != nil {
+		return err
+	}
+	_, err = db.conn.Exec(`
+	INSERT INTO pending_updates (app_id, change_number, diff_gz, created_at) VALUES (?, ?, ?, ?)
+	ON CONFLICT (app_id, change_number) DO UPDATE SET diff_gz = excluded.diff_gz, created_at = excluded.created_at
+	`, appID, changeNumber, compressed, time.Now().Unix())
+	return err
+}
+
+// PendingUpdates returns the stored diffs of updates whose jobs have not all
+// finished, oldest first.
+func (db *DB) PendingUpdates(appID int) ([][]byte, error) {
+	rows, err := db.conn.Query(`SELECT diff_gz FROM pending_updates WHERE app_id = ? ORDER BY CAST(change_number AS INTEGER)`, appID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var diffs [][]byte
+	for rows.Next() {
+		var compressed []byte
+		if err := rows.Scan(&compressed); err != nil {
+			return nil, err
+		}
+		data, err := decompressGzip(compressed)
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, data)
+	}
+	return diffs, rows.Err()
+}
+
+// DeletePendingUpdate forgets an update once its diff is finished.
+func (db *DB) DeletePendingUpdate(appID int, changeNumber string) error {
+	_, err := db.conn.Exec(`DELETE FROM pending_updates WHERE app_id = ? AND change_number = ?`, appID, changeNumber)
+	return err
+}
@@ -0,0 +1,171 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// driverName is go-sqlite3 with a REGEXP function, so "value REGEXP ?" works in queries.
+const driverName = "sqlite3_astra"
+
+var regexCache sync.Map // pattern -> *regexp.Regexp
+
+func init() {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("regexp", func(pattern, s string) (bool, error) {
+				re, ok := regexCache.Load(pattern)
+				if !ok {
+					compiled, err := regexp.Compile(pattern)
+					if err != nil {
+						return false, err
+					}
+					re, _ = regexCache.LoadOrStore(pattern, compiled)
+				}
+				return re.(*regexp.Regexp).MatchString(s), nil
+			}, true)
+		},
+	})
+}
+
+// migrateSearch creates the FTS5 index over string_values. FTS5 is only compiled
+// into go-sqlite3 with the sqlite_fts5 build tag; without it search falls back
+// to LIKE scans.
+func (db *DB) migrateSearch() {
+	var exists int
+	db.conn.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'string_search'`).Scan(&exists)
+
+	query := `
+	CREATE VIRTUAL TABLE IF NOT EXISTS string_search USING fts5(
+		value, content='string_values', content_rowid='id', tokenize='trigram'
+	);
+	CREATE TRIGGER IF NOT EXISTS string_values_ai AFTER INSERT ON string_values BEGIN
+		INSERT INTO string_search (rowid, value) VALUES (new.id, new.value);
+	END;
+	CREATE TRIGGER IF NOT EXISTS string_values_ad AFTER DELETE ON string_values BEGIN
+		INSERT INTO string_search (string_search, rowid, value) VALUES ('delete', old.id, old.value);
+	END;
+	CREATE TRIGGER IF NOT EXISTS string_values_au AFTER UPDATE OF value ON string_values BEGIN
+		INSERT INTO string_search (string_search, rowid, value) VALUES ('delete', old.id, old.value);
+		INSERT INTO string_search (rowid, value) VALUES (new.id, new.value);
+	END;
+	`
+	if _, err := db.conn.Exec(query); err != nil {
+		log.Printf("Full-text string search unavailable (build with -tags sqlite_fts5): %v", err)
+		return
+	}
+	db.fts = true
+
+	// Strings indexed before the FTS table existed.
+	if exists == 0 {
+		if _, err := db.conn.Exec(`INSERT INTO string_search (string_search) VALUES ('rebuild')`); err != nil {
+			log.Printf("Failed to build string search index: %v", err)
+		}
+	}
+}
+
+const (
+	SearchText   = "text"   // substring
+	SearchPrefix = "prefix" // value starts with the query
+	SearchRegex  = "regex"  // Go regexp syntax
+)
+
+type StringSearch struct {
+	Query    string
+	Mode     string
+	Category string
+	Limit    int
+	Offset   int
+}
+
+// StringSighting is one (build, file) a string was found in.
+type StringSighting struct {
+	ChangeNumber int64
+	DepotID      int
+	ManifestID   string
+	File         string
+	IndexedAt    string
+}
+
+type StringHit struct {
+	Value     string
+	Category  string
+	Files     int // (build, file) pairs containing the string
+	FirstSeen StringSighting
+	LastSeen  StringSighting
+}
+
+// SearchStrings finds indexed strings, newest first, and returns one page of
+// hits together with the total number of matches.
+func (db *DB) SearchStrings(q StringSearch) ([]StringHit, int, error) {
+	from := `string_values v`
+	var where []string
+	var args []any
+
+	switch q.Mode {
+	case SearchPrefix:
+		where = append(where, `v.value LIKE ? ESCAPE '\'`)
+		args = append(args, escapeLike(q.Query)+"%")
+	case SearchRegex:
+		where = append(where, `v.value REGEXP ?`)
+		args = append(args, q.Query)
+	default:
+		// The trigram tokenizer needs at least three characters to match.
+		if db.fts && len(q.Query) >= 3 {
+			from = `string_search s JOIN string_values v ON v.id = s.rowid`
+			where = append(where, `s.string_search MATCH ?`)
+			args = append(args, `"`+strings.ReplaceAll(q.Query, `"`, `""`)+`"`)
+		} else {
+			where = append(where, `v.value LIKE ? ESCAPE '\'`)
+			args = append(args, "%"+escapeLike(q.Query)+"%")
+		}
+	}
+	if q.Category != "" {
+		where = append(where, `v.category = ?`)
+		args = append(args, q.Category)
+	}
+	cond := strings.Join(where, " AND ")
+
+	var total int
+	if err := db.conn.QueryRow(`SELECT COUNT(*) FROM `+from+` WHERE `+cond, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+	SELECT v.value, COALESCE(v.category, ''),
+		(SELECT COUNT(*) FROM string_membership m WHERE m.string_id = v.id),
+		COALESCE(f1.change_number, 0), COALESCE(f1.depot_id, 0), COALESCE(f1.manifest_id, ''), COALESCE(f1.file, ''), COALESCE(f1.indexed_at, ''),
+		COALESCE(f2.change_number, 0), COALESCE(f2.depot_id, 0), COALESCE(f2.manifest_id, ''), COALESCE(f2.file, ''), COALESCE(f2.indexed_at, '')
+	FROM ` + from + `
+	LEFT JOIN string_files f1 ON f1.id = v.first_file
+	LEFT JOIN string_files f2 ON f2.id = v.last_file
+	WHERE ` + cond + `
+	ORDER BY v.first_change DESC, v.value
+	LIMIT ? OFFSET ?`
+	rows, err := db.conn.Query(query, append(args, q.Limit, q.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var hits []StringHit
+	for rows.Next() {
+		var h StringHit
+		if err := rows.Scan(&h.Value, &h.Category, &h.Files,
+			&h.FirstSeen.ChangeNumber, &h.FirstSeen.DepotID, &h.FirstSeen.ManifestID, &h.FirstSeen.File, &h.FirstSeen.IndexedAt,
+			&h.LastSeen.ChangeNumber, &h.LastSeen.DepotID, &h.LastSeen.ManifestID, &h.LastSeen.File, &h.LastSeen.IndexedAt); err != nil {
+			return nil, 0, err
+		}
+		hits = append(hits, h)
+	}
+	return hits, total, rows.Err()
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
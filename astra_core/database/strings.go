@@ -0,0 +1,213 @@
+package database
+
+import (
+	"database/sql"
+)
+
+// IndexedString is one extracted string of a file.
+type IndexedString struct {
+	Value    string
+	Category string
+}
+
+// SaveStringSet replaces the string set of one file of a build. Values are stored
+// once in string_values; a file only keeps (file, string) id pairs. The first and
+// last change number each value was seen in are kept up to date, so indexing an
+// older build after a newer one still yields the right first-seen build.
+func (db *DB) SaveStringSet(appID, depotID int, manifestID, file string, changeNumber int64, strs []IndexedString) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var fileID int64
+	err = tx.QueryRow(`
+	INSERT INTO string_files (app_id, depot_id, manifest_id, file, change_number, string_count)
+	VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT(app_id, depot_id, manifest_id, file) DO UPDATE
+	SET change_number = excluded.change_number,
+		string_count = excluded.string_count,
+		indexed_at = CURRENT_TIMESTAMP
+	RETURNING id;
+	`, appID, depotID, manifestID, file, changeNumber, len(strs)).Scan(&fileID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM string_membership WHERE file_id = ?`, fileID); err != nil {
+		return err
+	}
+
+	// Column references in the SET clause see the row before the update.
+	upsert, err := tx.Prepare(`
+	INSERT INTO string_values (value, category, first_change, first_file, last_change, last_file)
+	VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT(value) DO UPDATE
+	SET category = excluded.category,
+		first_file = CASE WHEN excluded.first_change < first_change THEN excluded.first_file ELSE first_file END,
+		first_change = MIN(first_change, excluded.first_change),
+		last_file = CASE WHEN excluded.last_change >= last_change THEN excluded.last_file ELSE last_file END,
+		last_change = MAX(last_change, excluded.last_change)
+	RETURNING id;
+	`)
+	if err != nil {
+		return err
+	}
+	defer upsert.Close()
+
+	member, err := tx.Prepare(`INSERT OR IGNORE INTO string_membership (file_id, string_id) VALUES (?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer member.Close()
+
+	for _, s := range strs {
+		var stringID int64
+		if err := upsert.QueryRow(s.Value, s.Category, changeNumber, fileID, changeNumber, fileID).Scan(&stringID); err != nil {
+			return err
+		}
+		if _, err := member.Exec(fileID, stringID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetStringSet returns the stored strings of one file of a build.
+// found is false if that file was never indexed for the build.
+func (db *DB) GetStringSet(appID, depotID int, manifestID, file string) (values []string, found bool, err error) {
+	var fileID int64
+	err = db.conn.QueryRow(`SELECT id FROM string_files WHERE app_id = ? AND depot_id = ? AND manifest_id = ? AND file = ?`,
+		appID, depotID, manifestID, file).Scan(&fileID)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	rows, err := db.conn.Query(`
+	SELECT v.value FROM string_membership m
+	JOIN string_values v ON v.id = m.string_id
+	WHERE m.file_id = ?`, fileID)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, false, err
+		}
+		values = append(values, v)
+	}
+	return values, true, rows.Err()
+}
+
+// MarkStringBuild records that every binary of a build has been indexed.
+func (db *DB) MarkStringBuild(appID, depotID int, manifestID string, changeNumber int64, fileCount int) error {
+	query := `
+	INSERT INTO string_builds (app_id, depot_id, manifest_id, change_number, file_count)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT(app_id, depot_id, manifest_id) DO UPDATE
+	SET change_number = excluded.change_number,
+		file_count = excluded.file_count,
+		indexed_at = CURRENT_TIMESTAMP;
+	`
+	_, err := db.conn.Exec(query, appID, depotID, manifestID, changeNumber, fileCount)
+	return err
+}
+
+// HasStringBuild reports whether a build was fully indexed by MarkStringBuild.
+func (db *DB) HasStringBuild(appID, depotID int, manifestID string) (bool, error) {
+	var n int
+	err := db.conn.QueryRow(`SELECT COUNT(*) FROM string_builds WHERE app_id = ? AND depot_id = ? AND manifest_id = ?`,
+		appID, depotID, manifestID).Scan(&n)
+	return n > 0, err
+}
+
+// StringFiles returns the files of a build that have a string set.
+func (db *DB) StringFiles(appID, depotID int, manifestID string) (map[string]bool, error) {
+	rows, err := db.conn.Query(`SELECT file FROM string_files WHERE app_id = ? AND depot_id = ? AND manifest_id = ?`,
+		appID, depotID, manifestID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := make(map[string]bool)
+	for rows.Next() {
+		var file string
+		if err := rows.Scan(&file); err != nil {
+			return nil, err
+		}
+		files[file] = true
+	}
+	return files, rows.Err()
+}
+
+// CopyFileIndex gives one file of a build the string set and binary artifacts
+// the same file has in another build, for a file that did not change between
+// them. The strings count as seen in changeNumber. It reports whether there
+// was a string set to copy.
+func (db *DB) CopyFileIndex(appID, depotID int, fromManifest, toManifest, file string, changeNumber int64) (bool, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+	INSERT INTO binary_artifacts (app_id, depot_id, manifest_id, file, kind, data_gz)
+	SELECT app_id, depot_id, ?, file, kind, data_gz FROM binary_artifacts
+	WHERE app_id = ? AND depot_id = ? AND manifest_id = ? AND file = ?
+	ON CONFLICT(app_id, depot_id, manifest_id, file, kind) DO UPDATE
+	SET data_gz = excluded.data_gz,
+		created_at = CURRENT_TIMESTAMP;
+	`, toManifest, appID, depotID, fromManifest, file)
+	if err != nil {
+		return false, err
+	}
+
+	var fromID int64
+	err = tx.QueryRow(`SELECT id FROM string_files WHERE app_id = ? AND depot_id = ? AND manifest_id = ? AND file = ?`,
+		appID, depotID, fromManifest, file).Scan(&fromID)
+	if err == sql.ErrNoRows {
+		return false, tx.Commit()
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var toID int64
+	err = tx.QueryRow(`
+	INSERT INTO string_files (app_id, depot_id, manifest_id, file, change_number, string_count)
+	SELECT app_id, depot_id, ?, file, ?, string_count FROM string_files WHERE id = ?
+	ON CONFLICT(app_id, depot_id, manifest_id, file) DO UPDATE
+	SET change_number = excluded.change_number,
+		string_count = excluded.string_count,
+		indexed_at = CURRENT_TIMESTAMP
+	RETURNING id;
+	`, toManifest, changeNumber, fromID).Scan(&toID)
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM string_membership WHERE file_id = ?`, toID); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(`INSERT INTO string_membership (file_id, string_id) SELECT ?, string_id FROM string_membership WHERE file_id = ?`, toID, fromID); err != nil {
+		return false, err
+	}
+	_, err = tx.Exec(`
+	UPDATE string_values SET last_change = ?, last_file = ?
+	WHERE last_change <= ? AND id IN (SELECT string_id FROM string_membership WHERE file_id = ?);
+	`, changeNumber, toID, changeNumber, toID)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
@@ -0,0 +1,408 @@
+package depot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cacheIndexFile persists the cache entries with their sizes, access times
+// and pins, so cleanup does not have to walk the cache.
+const cacheIndexFile = "index.json"
+
+// cacheLockFile is locked by the process that owns the cache.
+const cacheLockFile = "cache.lock"
+
+var (
+	ErrNotCached  = errors.New("cache entry not found")
+	ErrPinned     = errors.New("cache entry is pinned")
+	ErrCacheInUse = errors.New("depot cache is in use by another process")
+)
+
+// cacheLock is held open for the life of the process: closing it would
+// release the lock.
+var cacheLock *os.File
+
+// LockCache makes this process the owner of the depot cache until it exits,
+// or returns ErrCacheInUse when another process owns it. The index and the
+// object reference counts are kept in memory and saved whole, so a second
+// process writing the cache would lose its changes or the owner's. Call it
+// before the first NewDownloader.
+func LockCache() error {
+	if cacheLock != nil {
+		return nil
+	}
+	dir := cacheDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, cacheLockFile), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return err
+	}
+	cacheLock = f
+	return nil
+}
+
+// CacheEntry is one cached build, full or sparse.
+type CacheEntry struct {
+	Name       string    `json:"name"`
+	DepotID    int       `json:"depot_id"`
+	ManifestID string    `json:"manifest_id"`
+	Sparse     bool      `json:"sparse"`
+	Files      int       `json:"files"`
+	Size       int64     `json:"size"`     // bytes of the build's files
+	OwnSize    int64     `json:"own_size"` // bytes no other entry shares: what evicting it frees
+	Legacy     bool      `json:"legacy"`   // cached before deduplication, holds its own copies
+	Created    time.Time `json:"created"`
+	LastAccess time.Time `json:"last_access"`
+	Pinned     bool      `json:"pinned"`
+}
+
+// CacheUsage is the state of the depot cache.
+type CacheUsage struct {
+	Path    string       `json:"path"`
+	Total   int64        `json:"total"` // bytes on disk: objects plus legacy entries
+	Limit   int64        `json:"limit"`
+	Objects int          `json:"objects"`
+	Entries []CacheEntry `json:"entries"` // least recently used first
+}
+
+type cacheIndex struct {
+	Entries map[string]*CacheEntry `json:"entries"`
+	Pins    map[string][]string    `json:"pins"` // depot id -> pinned manifest ids
+}
+
+// cacheState is the in-memory accounting of the cache. Object reference
+// counts are rebuilt from the tree indexes at startup.
+type cacheState struct {
+	mu       sync.Mutex
+	index    cacheIndex
+	refs     map[string]int      // object sha -> trees linking it
+	objSizes map[string]int64    // object sha -> size
+	trees    map[string][]string // entry -> object shas
+}
+
+func parseEntryName(name string) (depotID int, manifestID string, sparse bool, ok bool) {
+	base, sparse := strings.CutSuffix(name, ".sparse")
+	depot, manifest, found := strings.Cut(base, "_")
+	if !found {
+		return 0, "", false, false
+	}
+	id, err := strconv.Atoi(depot)
+	if err != nil {
+		return 0, "", false, false
+	}
+	if _, err := strconv.ParseUint(manifest, 10, 64); err != nil {
+		return 0, "", false, false
+	}
+	return id, manifest, sparse, true
+}
+
+// loadCache reads the persistent index and reconciles it with the entries
+// on disk: new directories are added, vanished ones dropped.
+func (d *Downloader) loadCache() {
+	c := &d.cache
+	c.index = cacheIndex{Entries: make(map[string]*CacheEntry), Pins: make(map[string][]string)}
+	c.refs = make(map[string]int)
+	c.objSizes = make(map[string]int64)
+	c.trees = make(map[string][]string)
+
+	data, err := os.ReadFile(filepath.Join(d.cachePath, cacheIndexFile))
+	if err == nil {
+		if err := json.Unmarshal(data, &c.index); err != nil {
+			log.Printf("Ignoring unreadable cache index: %v", err)
+		}
+		if c.index.Entries == nil {
+			c.index.Entries = make(map[string]*CacheEntry)
+		}
+		if c.index.Pins == nil {
+			c.index.Pins = make(map[string][]string)
+		}
+	}
+
+	dirs, _ := os.ReadDir(d.cachePath)
+	onDisk := make(map[string]bool)
+	for _, dir := range dirs {
+		if !dir.IsDir() || isStoreDir(dir.Name()) {
+			continue
+		}
+		onDisk[dir.Name()] = true
+		if c.index.Entries[dir.Name()] == nil {
+			d.indexEntry(dir.Name())
+		} else {
+			d.loadTreeRefs(dir.Name())
+		}
+	}
+	for name := range c.index.Entries {
+		if !onDisk[name] {
+			delete(c.index.Entries, name)
+		}
+	}
+	if data == nil {
+		// A fresh index cannot know about objects left by removed entries.
+		d.collectGarbage()
+	}
+	d.saveCache()
+}
+
+// indexEntry (re)computes an entry's size from its tree index, or by walking
+// it when it predates deduplication. The caller holds the lock or is loadCache.
+func (d *Downloader) indexEntry(name string) {
+	c := &d.cache
+	depotID, manifestID, sparse, ok := parseEntryName(name)
+	if !ok {
+		return
+	}
+	e := c.index.Entries[name]
+	if e == nil {
+		now := time.Now()
+		e = &CacheEntry{Name: name, DepotID: depotID, ManifestID: manifestID, Sparse: sparse, Created: now, LastAccess: now}
+		c.index.Entries[name] = e
+	}
+
+	orphans := d.dropTreeRefs(name)
+	if tree, err := d.readTree(name); err == nil {
+		e.Legacy = false
+		e.Files, e.Size = len(tree), 0
+		for _, t := range tree {
+			e.Size += t.Size
+		}
+		d.addTreeRefs(name, tree)
+		// Files replaced in a growing entry leave their old objects behind.
+		for _, sha := range orphans {
+			if c.refs[sha] == 0 {
+				os.Remove(d.objectPath(sha))
+				delete(c.objSizes, sha)
+			}
+		}
+		return
+	}
+	e.Legacy = true
+	e.Size, e.Files = dirStats(filepath.Join(d.cachePath, name))
+}
+
+func dirStats(path string) (size int64, files int) {
+	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+			files++
+		}
+		return nil
+	})
+	return size, files
+}
+
+func (d *Downloader) loadTreeRefs(name string) {
+	if tree, err := d.readTree(name); err == nil {
+		d.addTreeRefs(name, tree)
+	}
+}
+
+func (d *Downloader) addTreeRefs(name string, tree []TreeEntry) {
+	c := &d.cache
+	shas := make([]string, 0, len(tree))
+	seen := make(map[string]bool)
+	for _, t := range tree {
+		if seen[t.SHA1] {
+			continue
+		}
+		seen[t.SHA1] = true
+		shas = append(shas, t.SHA1)
+		c.refs[t.SHA1]++
+		c.objSizes[t.SHA1] = t.Size
+	}
+	c.trees[name] = shas
+}
+
+// dropTreeRefs releases an entry's objects and returns those no longer
+// referenced by any entry.
+func (d *Downloader) dropTreeRefs(name string) (orphans []string) {
+	c := &d.cache
+	for _, sha := range c.trees[name] {
+		c.refs[sha]--
+		if c.refs[sha] <= 0 {
+			delete(c.refs, sha)
+			orphans = append(orphans, sha)
+		}
+	}
+	delete(c.trees, name)
+	return orphans
+}
+
+func (d *Downloader) saveCache() {
+	data, err := json.Marshal(d.cache.index)
+	if err != nil {
+		return
+	}
+	path := filepath.Join(d.cachePath, cacheIndexFile)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		log.Printf("Failed to save cache index: %v", err)
+		return
+	}
+	os.Rename(path+".tmp", path)
+}
+
+// recordEntry updates the index after an entry was written or grew.
+func (d *Downloader) recordEntry(name string) {
+	d.cache.mu.Lock()
+	defer d.cache.mu.Unlock()
+	d.indexEntry(name)
+	if e := d.cache.index.Entries[name]; e != nil {
+		e.LastAccess = time.Now()
+	}
+	d.saveCache()
+}
+
+// touch marks an entry as used now.
+func (d *Downloader) touch(name string) {
+	d.cache.mu.Lock()
+	defer d.cache.mu.Unlock()
+	if e := d.cache.index.Entries[name]; e != nil {
+		e.LastAccess = time.Now()
+		d.saveCache()
+	}
+}
+
+// PinBuilds protects the given manifests of a depot, typically the current
+// and the previous build, from eviction. It replaces the depot's earlier pins.
+func (d *Downloader) PinBuilds(depotID int, manifestIDs ...string) {
+	d.cache.mu.Lock()
+	defer d.cache.mu.Unlock()
+	var pins []string
+	for _, id := range manifestIDs {
+		if id != "" {
+			pins = append(pins, id)
+		}
+	}
+	d.cache.index.Pins[strconv.Itoa(depotID)] = pins
+	d.saveCache()
+}
+
+func (d *Downloader) isPinned(e *CacheEntry) bool {
+	for _, id := range d.cache.index.Pins[strconv.Itoa(e.DepotID)] {
+		if id == e.ManifestID {
+			return true
+		}
+	}
+	return false
+}
+
+// ownSize is what evicting an entry frees: its objects no other entry links.
+func (d *Downloader) ownSize(e *CacheEntry) int64 {
+	if e.Legacy {
+		return e.Size
+	}
+	var size int64
+	for _, sha := range d.cache.trees[e.Name] {
+		if d.cache.refs[sha] == 1 {
+			size += d.cache.objSizes[sha]
+		}
+	}
+	return size
+}
+
+func (d *Downloader) totalSize() int64 {
+	var total int64
+	for _, size := range d.cache.objSizes {
+		total += size
+	}
+	for _, e := range d.cache.index.Entries {
+		if e.Legacy {
+			total += e.Size
+		}
+	}
+	return total
+}
+
+// Usage reports the cache size and its entries, least recently used first.
+func (d *Downloader) Usage() CacheUsage {
+	d.cache.mu.Lock()
+	defer d.cache.mu.Unlock()
+	u := CacheUsage{Path: d.cachePath, Total: d.totalSize(), Limit: MaxCacheSize, Objects: len(d.cache.objSizes)}
+	for _, e := range d.cache.index.Entries {
+		entry := *e
+		entry.OwnSize = d.ownSize(e)
+		entry.Pinned = d.isPinned(e)
+		u.Entries = append(u.Entries, entry)
+	}
+	sort.Slice(u.Entries, func(i, j int) bool { return u.Entries[i].LastAccess.Before(u.Entries[j].LastAccess) })
+	return u
+}
+
+// Evict removes a cache entry by name. Pinned entries are refused.
+func (d *Downloader) Evict(name string) (int64, error) {
+	d.cache.mu.Lock()
+	defer d.cache.mu.Unlock()
+	e := d.cache.index.Entries[name]
+	if e == nil {
+		return 0, ErrNotCached
+	}
+	if d.isPinned(e) {
+		return 0, ErrPinned
+	}
+	freed := d.evict(e)
+	d.saveCache()
+	return freed, nil
+}
+
+// evict deletes an entry and the objects only it referenced. The caller holds
+// the lock and saves the index.
+func (d *Downloader) evict(e *CacheEntry) int64 {
+	freed := d.ownSize(e)
+	d.removeTree(e.Name)
+	for _, sha := range d.dropTreeRefs(e.Name) {
+		if err := os.Remove(d.objectPath(sha)); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove cache object %s: %v", sha, err)
+		}
+		delete(d.cache.objSizes, sha)
+	}
+	delete(d.cache.index.Entries, e.Name)
+	log.Printf("Evicted %s, freed %d bytes", e.Name, freed)
+	return freed
+}
+
+// CleanupOldCache evicts the least recently used unpinned entries until the
+// cache is under 80% of MaxCacheSize. Sizes come from the index.
+func (d *Downloader) CleanupOldCache() error {
+	d.cache.mu.Lock()
+	defer d.cache.mu.Unlock()
+
+	total := d.totalSize()
+	if total <= MaxCacheSize {
+		return nil
+	}
+	log.Printf("Cache size %d exceeds limit %d, cleaning up...", total, MaxCacheSize)
+
+	var candidates []*CacheEntry
+	for _, e := range d.cache.index.Entries {
+		if !d.isPinned(e) {
+			candidates = append(candidates, e)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].LastAccess.Before(candidates[j].LastAccess) })
+
+	for _, e := range candidates {
+		if total <= MaxCacheSize*80/100 {
+			break
+		}
+		total -= d.evict(e)
+	}
+	d.saveCache()
+	if total > MaxCacheSize*80/100 {
+		return fmt.Errorf("cache still holds %d bytes; the rest is pinned", total)
+	}
+	return nil
+}
@@ -1,6 +1,8 @@
 package depot
 
 import (
+	"astra_core/steamcmd"
+	"bufio"
 	"context"
 	"fmt"
 	"io"
@@ -8,201 +10,321 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 )
 
 const (
 	MaxCacheSize    = 20 * 1024 * 1024 * 1024
 	DepotCachePath  = "/data/depot_cache"
-	SteamCMDPath    = "/opt/steamcmd/steamcmd.sh"
 	DownloadTimeout = 30 * time.Minute
 )
 
 type Downloader struct {
 	cachePath string
 	appID     int
+	steamcmd  string // executable
+	cache     cacheState
 }
 
 func NewDownloader(appID int) *Downloader {
-	cachePath := DepotCachePath
-	if envPath := os.Getenv("DEPOT_CACHE_PATH"); envPath != "" {
-		cachePath = envPath
-	}
-
-	os.MkdirAll(cachePath, 0755)
+	cachePath := cacheDir()
+	os.MkdirAll(filepath.Join(cachePath, manifestsDir), 0755)
+	removeStaleDownloads(filepath.Join(cachePath, downloadsDir))
 
-	return &Downloader{
+	d := &Downloader{
 		cachePath: cachePath,
 		appID:     appID,
+		steamcmd:  steamcmd.Executable(),
 	}
+	d.loadCache()
+	return d
 }
 
-func (d *Downloader) DownloadDepot(depotID int, manifestID string, fileFilter string) (string, error) {
+// cacheDir is DEPOT_CACHE_PATH, or DepotCachePath without it.
+func cacheDir() string {
+	if envPath := os.Getenv("DEPOT_CACHE_PATH"); envPath != "" {
+		return envPath
+	}
+	return DepotCachePath
+}
+
+// downloadCompletePattern matches steamcmd's summary line, e.g.
+// Depot download complete : "/root/Steam/steamapps/content/app_730/depot_2347770" (12 files, manifest 7617088375292372759)
+var downloadCompletePattern = regexp.MustCompile(`Depot download complete : "([^"]+)" \((\d+) files?, manifest (\d+)\)`)
+
+func (d *Downloader) DownloadDepot(ctx context.Context, depotID int, manifestID string, fileFilter string, progress ProgressFunc) (string, error) {
+	if _, err := strconv.ParseUint(manifestID, 10, 64); err != nil {
+		return "", fmt.Errorf("invalid manifest id %q for depot %d", manifestID, depotID)
+	}
+
 	outputDir := filepath.Join(d.cachePath, fmt.Sprintf("%d_%s", depotID, manifestID))
 
 	if _, err := os.Stat(outputDir); err == nil {
 		log.Printf("Depot %d already cached at %s", depotID, outputDir)
+		d.touch(filepath.Base(outputDir))
 		return outputDir, nil
 	}
 
-	loginArgs := []string{"+login", "anonymous"}
-	if user := os.Getenv("STEAM_USER"); user != "" {
-		if pass := os.Getenv("STEAM_PASS"); pass != "" {
-			loginArgs = []string{"+login", user, pass}
-		}
+	installDir, err := d.newInstallDir(depotID, manifestID)
+	if err != nil {
+		return "", err
 	}
+	defer os.RemoveAll(installDir)
 
-	args := append(loginArgs,
-		"+@sSteamCmdForcePlatformType", "windows",
-		"+download_depot", fmt.Sprintf("%d", d.appID), fmt.Sprintf("%d", depotID),
-	)
-
+	// Without the manifest id steamcmd fetches whatever is current.
+	args := []string{"+download_depot", fmt.Sprintf("%d", d.appID), fmt.Sprintf("%d", depotID), manifestID}
 	if fileFilter != "" {
 		args = append(args, fileFilter)
 	}
 
-	args = append(args, "+quit")
-
 	log.Printf("Downloading depot %d with manifest %s...", depotID, manifestID)
 
-	ctx, cancel := context.WithTimeout(context.Background(), DownloadTimeout)
-	defer cancel()
-
-	cmd := exec.CommandContext(ctx, SteamCMDPath, args...)
-	output, err := cmd.CombinedOutput()
-
-	// Log output to help debugging where files are stored
-	log.Printf("SteamCMD Output: %s", string(output))
-
+	output, err := d.runSteamCmd(ctx, installDir, progress, args...)
 	if err != nil {
 		return "", fmt.Errorf("failed to download depot: %w", err)
 	}
 
-	depotPath := findDepotPath(d.appID, depotID)
-	if depotPath != "" {
-		// Validate size before moving
-		size, _ := getDirSize(depotPath)
-		if size < 1000 {
-			log.Printf("WARNING: Downloaded depot %d is remarkably small (%d bytes). This usually indicates authentication failure or a protected depot.", depotID, size)
-		}
+	depotPath, err := downloadedPath(output, installDir, depotID, manifestID)
+	if err != nil {
+		return "", err
+	}
 
-		if err := moveOrCopy(depotPath, outputDir); err != nil {
-			return "", fmt.Errorf("failed to move depot files: %w", err)
-		}
-		return outputDir, nil
+	// Nothing is cached that was not checked against the manifest: a partial
+	// or corrupt download would otherwise stay cached under its manifest id.
+	manifestPath, ok := d.storedManifest(depotID, manifestID, filepath.Join(installDir, "depotcache"))
+	if !ok {
+		return "", fmt.Errorf("cannot verify depot %d manifest %s: steamcmd left no manifest", depotID, manifestID)
+	}
+	manifest, err := LoadManifest(manifestPath)
+	if err != nil {
+		return "", fmt.Errorf("cannot verify depot %d manifest %s: %w", depotID, manifestID, err)
+	}
+	if err := checkContent(depotPath, manifest, fileFilter == ""); err != nil {
+		return "", fmt.Errorf("depot %d: %w", depotID, err)
 	}
 
+	// The install dir is inside the cache, so the verified build appears at
+	// once.
+	if err := os.Rename(depotPath, outputDir); err != nil {
+		return "", fmt.Errorf("failed to move depot files: %w", err)
+	}
+	if err := d.ingestTree(filepath.Base(outputDir)); err != nil {
+		log.Printf("Failed to deduplicate %s: %v", outputDir, err)
+	}
+	d.recordEntry(filepath.Base(outputDir))
 	return outputDir, nil
 }
 
-func findDepotPath(appID, depotID int) string {
-	// 1. Try known patterns first (fastest)
-	patterns := []string{
-		fmt.Sprintf("/root/Steam/steamapps/content/app_%d/depot_%d", appID, depotID),
-		fmt.Sprintf("/home/*/.steam/steamapps/content/app_%d/depot_%d", appID, depotID),
-		fmt.Sprintf("/opt/steamcmd/steamapps/content/app_%d/depot_%d", appID, depotID),
-		fmt.Sprintf("/opt/steamcmd/linux32/steamapps/content/app_%d/depot_%d", appID, depotID),
-	}
-
-	for _, pattern := range patterns {
-		matches, _ := filepath.Glob(pattern)
-		if len(matches) > 0 {
-			info, err := os.Stat(matches[0])
-			if err == nil && info.IsDir() {
-				// Check if it's not empty
-				if size, _ := getDirSize(matches[0]); size > 0 {
-					return matches[0]
-				}
-			}
+// DownloadFiles downloads only the given files of a build into a sparse cache
+// entry, <depot>_<manifest>.sparse, laid out like a full one. Files already in
+// the entry are kept, so it grows as later diffs need more of the build. Every
+// downloaded file is checked against its size and hash in the manifest. A full
+// cache entry is returned as is.
+func (d *Downloader) DownloadFiles(ctx context.Context, depotID int, manifest *Manifest, files []string, progress ProgressFunc) (string, error) {
+	manifestID := manifest.ManifestID
+	if fullDir, ok := d.CachedPath(depotID, manifestID); ok {
+		return fullDir, nil
+	}
+	sparseDir := filepath.Join(d.cachePath, fmt.Sprintf("%d_%s.sparse", depotID, manifestID))
+
+	byName := make(map[string]ManifestFile, len(manifest.Files))
+	for _, f := range manifest.Files {
+		byName[strings.ToLower(f.Name)] = f
+	}
+	var missing []ManifestFile
+	for _, name := range files {
+		f, ok := byName[strings.ToLower(name)]
+		if !ok {
+			return "", fmt.Errorf("file %s is not in manifest %s", name, manifestID)
 		}
+		if info, err := os.Stat(filepath.Join(sparseDir, filepath.FromSlash(f.Name))); err == nil && uint64(info.Size()) == f.Size {
+			continue
+		}
+		missing = append(missing, f)
+	}
+	if len(missing) == 0 {
+		d.touch(filepath.Base(sparseDir))
+		return sparseDir, nil
 	}
 
-	// 2. Fallback: Recursive search in common roots
-	roots := []string{"/opt/steamcmd", "/root", "/data"}
-	targetName := fmt.Sprintf("depot_%d", depotID)
+	// Windows depot manifests name files with backslashes, and the filelist is
+	// matched against those names.
+	var list strings.Builder
+	for _, f := range missing {
+		list.WriteString(strings.ReplaceAll(f.Name, "/", `\`) + "\n")
+	}
+	filelist := filepath.Join(d.cachePath, manifestsDir, fmt.Sprintf("%d_%s.filelist", depotID, manifestID))
+	if err := os.WriteFile(filelist, []byte(list.String()), 0644); err != nil {
+		return "", err
+	}
+	defer os.Remove(filelist)
 
-	for _, root := range roots {
-		found := ""
-		filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return nil
-			}
-			if info.IsDir() && info.Name() == targetName {
-				// Verify parent structure to avoid false positives if possible, or just accept it
-				found = path
-				return fmt.Errorf("found") // Stop walking
-			}
-			return nil
-		})
+	installDir, err := d.newInstallDir(depotID, manifestID)
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(installDir)
 
-		if found != "" {
-			log.Printf("Found depot %d via recursive search at: %s", depotID, found)
-			return found
+	log.Printf("Downloading %d file(s) of depot %d with manifest %s...", len(missing), depotID, manifestID)
+	output, err := d.runSteamCmd(ctx, installDir, progress, "+download_depot", fmt.Sprintf("%d", d.appID), fmt.Sprintf("%d", depotID), manifestID, filelist)
+	if err != nil {
+		return "", fmt.Errorf("failed to download depot files: %w", err)
+	}
+	depotPath, err := downloadedPath(output, installDir, depotID, manifestID)
+	if err != nil {
+		return "", err
+	}
+
+	// Check every file before any of them joins the entry.
+	for _, f := range missing {
+		if msg := checkFile(filepath.Join(depotPath, filepath.FromSlash(f.Name)), f); msg != "" {
+			return "", fmt.Errorf("downloaded file %s %s", f.Name, msg)
+		}
+	}
+	for _, f := range missing {
+		src := filepath.Join(depotPath, filepath.FromSlash(f.Name))
+		dst := filepath.Join(sparseDir, filepath.FromSlash(f.Name))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return "", err
+		}
+		os.Remove(dst)
+		if err := moveOrCopy(src, dst); err != nil {
+			return "", fmt.Errorf("failed to move %s: %w", f.Name, err)
 		}
 	}
+	if err := d.ingestTree(filepath.Base(sparseDir)); err != nil {
+		log.Printf("Failed to deduplicate %s: %v", sparseDir, err)
+	}
+	d.recordEntry(filepath.Base(sparseDir))
+	return sparseDir, nil
+}
 
-	// 3. Debug: Log structure of /opt/steamcmd to help diagnosis
-	log.Println("DEBUG: Dumping /opt/steamcmd structure:")
-	filepath.Walk("/opt/steamcmd", func(path string, info os.FileInfo, err error) error {
-		if err == nil {
-			log.Println(path)
+// runSteamCmd runs steamcmd with the configured login and returns its output.
+// Downloads go into installDir. Progress lines are passed to progress while
+// it runs; cancelling ctx kills it.
+func (d *Downloader) runSteamCmd(ctx context.Context, installDir string, progress ProgressFunc, args ...string) (string, error) {
+	loginArgs := []string{"+login", "anonymous"}
+	if user := os.Getenv("STEAM_USER"); user != "" {
+		if pass := os.Getenv("STEAM_PASS"); pass != "" {
+			loginArgs = []string{"+login", user, pass}
 		}
-		return nil
-	})
+	}
+
+	// steamcmd only honors the install dir when it is set before logging in.
+	fullArgs := append([]string{"+force_install_dir", installDir}, loginArgs...)
+	fullArgs = append(fullArgs, "+@sSteamCmdForcePlatformType", "windows")
+	fullArgs = append(fullArgs, args...)
+	fullArgs = append(fullArgs, "+quit")
+
+	ctx, cancel := context.WithTimeout(ctx, DownloadTimeout)
+	defer cancel()
 
-	return ""
+	cmd := exec.CommandContext(ctx, d.steamcmd, fullArgs...)
+	killOnCancel(cmd)
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+
+	var output strings.Builder
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(pr)
+		scanner.Split(scanLines)
+		for scanner.Scan() {
+			line := scanner.Text()
+			output.WriteString(line + "\n")
+			if p, ok := parseProgress(line); ok && progress != nil {
+				progress(p)
+			}
+		}
+		io.Copy(io.Discard, pr)
+	}()
+	err := cmd.Wait()
+	pw.Close()
+	<-done
+
+	// Log output to help debugging where files are stored
+	log.Printf("SteamCMD Output: %s", output.String())
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return output.String(), ctxErr
+	}
+	return output.String(), err
 }
 
-func (d *Downloader) CleanupOldCache() error {
-	var totalSize int64
+// downloadsDir holds a fresh steamcmd install directory per download, inside
+// the cache so the result can be renamed into place.
+const downloadsDir = "downloads"
 
-	entries, err := os.ReadDir(d.cachePath)
+func (d *Downloader) newInstallDir(depotID int, manifestID string) (string, error) {
+	// steamcmd reports absolute paths, which downloadedPath compares against.
+	root, err := filepath.Abs(filepath.Join(d.cachePath, downloadsDir))
 	if err != nil {
-		return err
+		return "", err
 	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return "", err
+	}
+	return os.MkdirTemp(root, fmt.Sprintf("%d_%s-", depotID, manifestID))
+}
 
-	for _, entry := range entries {
-		info, err := entry.Info()
-		if err != nil {
-			continue
-		}
-		if entry.IsDir() {
-			dirSize, _ := getDirSize(filepath.Join(d.cachePath, entry.Name()))
-			totalSize += dirSize
-		} else {
-			totalSize += info.Size()
+// removeStaleDownloads deletes install directories left by interrupted runs.
+// Younger ones may belong to another process sharing the cache, such as a
+// running server while a command imports a build.
+func removeStaleDownloads(root string) {
+	dirs, _ := os.ReadDir(root)
+	for _, dir := range dirs {
+		if info, err := dir.Info(); err == nil && time.Since(info.ModTime()) > DownloadTimeout {
+			os.RemoveAll(filepath.Join(root, dir.Name()))
 		}
 	}
+}
 
-	if totalSize > MaxCacheSize {
-		log.Printf("Cache size %d exceeds limit %d, cleaning up...", totalSize, MaxCacheSize)
-		for _, entry := range entries {
-			if totalSize <= MaxCacheSize*80/100 {
-				break
-			}
-			path := filepath.Join(d.cachePath, entry.Name())
-			size, _ := getDirSize(path)
-			os.RemoveAll(path)
-			totalSize -= size
-			log.Printf("Removed %s, freed %d bytes", entry.Name(), size)
+// downloadedPath returns where steamcmd put a depot, as reported by its
+// summary line, after checking that the requested manifest was downloaded
+// into installDir. A failed download reports steamcmd's own error lines.
+func downloadedPath(output, installDir string, depotID int, manifestID string) (string, error) {
+	m := downloadCompletePattern.FindStringSubmatch(output)
+	if m == nil {
+		if msg := steamcmdErrors(output); msg != "" {
+			return "", fmt.Errorf("download of depot %d manifest %s failed: %s", depotID, manifestID, msg)
 		}
+		return "", fmt.Errorf("download of depot %d manifest %s did not complete", depotID, manifestID)
+	}
+	if m[3] != manifestID {
+		return "", fmt.Errorf("depot %d: requested manifest %s but steamcmd downloaded %s", depotID, manifestID, m[3])
 	}
 
-	return nil
+	path := m[1]
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(installDir, path)
+	}
+	if rel, err := filepath.Rel(installDir, path); err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("depot %d: steamcmd reported %s, outside its install directory %s", depotID, path, installDir)
+	}
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("depot %d: steamcmd reported %s, which is not a directory", depotID, path)
+	}
+	return path, nil
 }
 
-func getDirSize(path string) (int64, error) {
-	var size int64
-	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if !info.IsDir() {
-			size += info.Size()
+// steamcmdErrors collects the error lines of steamcmd's output.
+func steamcmdErrors(output string) string {
+	var errs []string
+	for _, line := range strings.FieldsFunc(output, func(r rune) bool { return r == '\n' || r == '\r' }) {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "ERROR!") || strings.HasPrefix(line, "FAILED") || strings.Contains(line, "Download failed") {
+			errs = append(errs, line)
 		}
-		return nil
-	})
-	return size, nil
+	}
+	return strings.Join(errs, "; ")
 }
 
 func moveOrCopy(src, dst string) error {
@@ -255,8 +377,117 @@ func moveOrCopy(src, dst string) error {
 	return os.RemoveAll(src)
 }
 
-func (d *Downloader) GetCachedFiles(depotID int, manifestID string) ([]string, error) {
+// depotCacheDirs are where the configured steamcmd keeps the manifests of the
+// depots it downloaded: the depotcache of its install directory, or of the
+// linux32 directory holding the client. An executable found on PATH or
+// symlinked is followed to its install directory.
+func (d *Downloader) depotCacheDirs() []string {
+	exe := d.steamcmd
+	if path, err := exec.LookPath(exe); err == nil {
+		exe = path
+	}
+	installDirs := []string{filepath.Dir(exe)}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil && filepath.Dir(resolved) != installDirs[0] {
+		installDirs = append(installDirs, filepath.Dir(resolved))
+	}
+	var dirs []string
+	for _, dir := range installDirs {
+		dirs = append(dirs, filepath.Join(dir, "depotcache"), filepath.Join(dir, "linux32", "depotcache"))
+	}
+	return dirs
+}
+
+// manifestsDir holds our copies of depot manifests inside the cache.
+const manifestsDir = "manifests"
+
+// FetchManifest returns the manifest of a build: our stored copy, steamcmd's
+// depotcache copy, or one fetched with an empty file list so that no content
+// is downloaded.
+func (d *Downloader) FetchManifest(ctx context.Context, depotID int, manifestID string) (*Manifest, error) {
+	if _, err := strconv.ParseUint(manifestID, 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid manifest id %q for depot %d", manifestID, depotID)
+	}
+
+	if path, ok := d.storedManifest(depotID, manifestID); ok {
+		return LoadManifest(path)
+	}
+
+	filelist := filepath.Join(d.cachePath, manifestsDir, fmt.Sprintf("%d_%s.filelist", depotID, manifestID))
+	if err := os.WriteFile(filelist, []byte("astranet-manifest-only\n"), 0644); err != nil {
+		return nil, err
+	}
+	defer os.Remove(filelist)
+	installDir, err := d.newInstallDir(depotID, manifestID)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(installDir)
+
+	log.Printf("Fetching manifest %s of depot %d...", manifestID, depotID)
+	output, err := d.runSteamCmd(ctx, installDir, nil, "+download_depot", fmt.Sprintf("%d", d.appID), fmt.Sprintf("%d", depotID), manifestID, filelist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch manifest: %w", err)
+	}
+	if path, ok := d.storedManifest(depotID, manifestID, filepath.Join(installDir, "depotcache")); ok {
+		return LoadManifest(path)
+	}
+	if msg := steamcmdErrors(output); msg != "" {
+		return nil, fmt.Errorf("manifest %s of depot %d: %s", manifestID, depotID, msg)
+	}
+	return nil, fmt.Errorf("manifest %s of depot %d not found after download", manifestID, depotID)
+}
+
+// storedManifest returns our copy of a manifest, first copying it from
+// steamcmd's depotcache when it is there.
+func (d *Downloader) storedManifest(depotID int, manifestID string, extraDirs ...string) (string, bool) {
+	name := fmt.Sprintf("%d_%s.manifest", depotID, manifestID)
+	local := filepath.Join(d.cachePath, manifestsDir, name)
+	if _, err := os.Stat(local); err == nil {
+		return local, true
+	}
+
+	dirs := append(extraDirs, d.depotCacheDirs()...)
+	for _, dir := range dirs {
+		matches, _ := filepath.Glob(filepath.Join(dir, name))
+		if len(matches) == 0 {
+			continue
+		}
+		data, err := os.ReadFile(matches[0])
+		if err != nil {
+			continue
+		}
+		if err := os.WriteFile(local, data, 0644); err != nil {
+			log.Printf("Failed to store manifest %s: %v", name, err)
+			return matches[0], true
+		}
+		return local, true
+	}
+	return "", false
+}
+
+// CachedPath returns the cache directory of a build if it was downloaded before.
+func (d *Downloader) CachedPath(depotID int, manifestID string) (string, bool) {
 	outputDir := filepath.Join(d.cachePath, fmt.Sprintf("%d_%s", depotID, manifestID))
+	if info, err := os.Stat(outputDir); err == nil && info.IsDir() {
+		d.touch(filepath.Base(outputDir))
+		return outputDir, true
+	}
+	return "", false
+}
+
+// GetCachedFiles lists the files of a cached build from its tree index,
+// walking the directory for entries cached before deduplication.
+func (d *Downloader) GetCachedFiles(depotID int, manifestID string) ([]string, error) {
+	entry := fmt.Sprintf("%d_%s", depotID, manifestID)
+	if tree, err := d.readTree(entry); err == nil {
+		files := make([]string, len(tree))
+		for i, e := range tree {
+			files[i] = filepath.FromSlash(e.Path)
+		}
+		return files, nil
+	}
+
+	outputDir := filepath.Join(d.cachePath, entry)
 
 	var files []string
 	err := filepath.Walk(outputDir, func(path string, info os.FileInfo, err error) error {
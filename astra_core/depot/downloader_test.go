@@ -0,0 +1,47 @@
+package depot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStoredManifestFromSteamCmdDepotCache(t *testing.T) {
+	dir := t.TempDir()
+	install := filepath.Join(dir, "steamcmd")
+	if err := os.MkdirAll(filepath.Join(install, "linux32", "depotcache"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(install, "steamcmd.sh"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	manifest := []byte("manifest 2347771_100")
+	if err := os.WriteFile(filepath.Join(install, "linux32", "depotcache", "2347771_100.manifest"), manifest, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// steamcmd is configured through a symlink outside its install directory.
+	link := filepath.Join(dir, "bin", "steamcmd")
+	if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(install, "steamcmd.sh"), link); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("STEAMCMD_PATH", link)
+	t.Setenv("DEPOT_CACHE_PATH", filepath.Join(dir, "cache"))
+
+	d := NewDownloader(730)
+	path, ok := d.storedManifest(2347771, "100")
+	if !ok {
+		t.Fatalf("manifest in %s not found", install)
+	}
+	if want := filepath.Join(dir, "cache", manifestsDir, "2347771_100.manifest"); path != want {
+		t.Errorf("stored at %s, want our copy %s", path, want)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != string(manifest) {
+		t.Errorf("stored copy %q, %v", data, err)
+	}
+	if _, ok := d.storedManifest(2347771, "200"); ok {
+		t.Errorf("found a manifest steamcmd never downloaded")
+	}
+}
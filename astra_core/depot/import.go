@@ -0,0 +1,262 @@
+package depot
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var ErrAlreadyCached = errors.New("build is already cached")
+
+// ImportOptions control how local content is registered as a build.
+type ImportOptions struct {
+	Manifest string // depot manifest of the build; the files are checked against it and it is stored
+	Replace  bool   // replace an existing cache entry of the build
+}
+
+// Import registers a local directory, zip or tar archive (optionally gzipped)
+// as the content of a build, so it can be analyzed without steamcmd. The
+// directory or archive root is the depot root. The content is staged and
+// checked first; the cache entry only appears once it is complete.
+func (d *Downloader) Import(depotID int, manifestID, source string, opts ImportOptions) (*CacheEntry, error) {
+	if _, err := strconv.ParseUint(manifestID, 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid manifest id %q for depot %d", manifestID, depotID)
+	}
+
+	var manifest *Manifest
+	if opts.Manifest != "" {
+		var err error
+		if manifest, err = LoadManifest(opts.Manifest); err != nil {
+			return nil, fmt.Errorf("load manifest: %w", err)
+		}
+		if (manifest.DepotID != 0 && manifest.DepotID != depotID) || (manifest.ManifestID != "" && manifest.ManifestID != manifestID) {
+			return nil, fmt.Errorf("manifest is %d_%s, not %d_%s", manifest.DepotID, manifest.ManifestID, depotID, manifestID)
+		}
+	}
+
+	name := fmt.Sprintf("%d_%s", depotID, manifestID)
+	dest := filepath.Join(d.cachePath, name)
+	if _, err := os.Stat(dest); err == nil && !opts.Replace {
+		return nil, ErrAlreadyCached
+	}
+
+	staging := dest + ".import"
+	os.RemoveAll(staging)
+	defer os.RemoveAll(staging)
+	if err := os.MkdirAll(staging, 0755); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Importing %s as depot %d manifest %s...", source, depotID, manifestID)
+	if err := unpackSource(source, staging); err != nil {
+		return nil, fmt.Errorf("import %s: %w", source, err)
+	}
+	if manifest != nil {
+		if err := checkContent(staging, manifest, true); err != nil {
+			return nil, err
+		}
+	}
+
+	d.cache.mu.Lock()
+	if e := d.cache.index.Entries[name]; e != nil {
+		d.evict(e)
+		d.saveCache()
+	}
+	d.cache.mu.Unlock()
+	os.RemoveAll(dest)
+	if err := os.Rename(staging, dest); err != nil {
+		return nil, err
+	}
+
+	if err := d.ingestTree(name); err != nil {
+		log.Printf("Failed to deduplicate %s: %v", dest, err)
+	}
+	d.recordEntry(name)
+	if opts.Manifest != "" {
+		stored := filepath.Join(d.cachePath, manifestsDir, name+".manifest")
+		if err := copyFile(opts.Manifest, stored); err != nil {
+			log.Printf("Failed to store manifest of %s: %v", name, err)
+		}
+	}
+
+	d.cache.mu.Lock()
+	defer d.cache.mu.Unlock()
+	entry := *d.cache.index.Entries[name]
+	log.Printf("Imported %s: %d files, %d bytes", name, entry.Files, entry.Size)
+	return &entry, nil
+}
+
+// unpackSource copies a directory, or extracts an archive recognized by its
+// content, into dir.
+func unpackSource(source, dir string) error {
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return copyTree(source, dir)
+	}
+
+	f, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	head, _ := br.Peek(512)
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return extractZip(f, info.Size(), dir)
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		return extractTar(gz, dir)
+	case len(head) >= 262 && string(head[257:262]) == "ustar":
+		return extractTar(br, dir)
+	}
+	return fmt.Errorf("not a directory, zip or tar archive")
+}
+
+// archivePath maps an archive member name into dir, refusing names that
+// would escape it.
+func archivePath(dir, name string) (string, error) {
+	name = strings.ReplaceAll(name, `\`, "/")
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("unsafe path %q in archive", name)
+		}
+	}
+	clean := path.Clean("/" + name)[1:]
+	if clean == "" {
+		return "", nil
+	}
+	return filepath.Join(dir, filepath.FromSlash(clean)), nil
+}
+
+func extractZip(f *os.File, size int64, dir string) error {
+	zr, err := zip.NewReader(f, size)
+	if err != nil {
+		return err
+	}
+	for _, zf := range zr.File {
+		dst, err := archivePath(dir, zf.Name)
+		if err != nil {
+			return err
+		}
+		if dst == "" {
+			continue
+		}
+		if zf.FileInfo().IsDir() {
+			if err := os.MkdirAll(dst, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if !zf.Mode().IsRegular() {
+			log.Printf("Skipping %s: not a regular file", zf.Name)
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return err
+		}
+		err = writeFile(dst, rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", zf.Name, err)
+		}
+	}
+	return nil
+}
+
+func extractTar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		dst, err := archivePath(dir, hdr.Name)
+		if err != nil {
+			return err
+		}
+		if dst == "" {
+			continue
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(dst, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := writeFile(dst, tr); err != nil {
+				return fmt.Errorf("%s: %w", hdr.Name, err)
+			}
+		default:
+			log.Printf("Skipping %s: not a regular file", hdr.Name)
+		}
+	}
+}
+
+func writeFile(dst string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// copyTree copies the regular files of src into dst. Files are copied, not
+// linked, so later changes to the source cannot reach the cache's objects.
+func copyTree(src, dst string) error {
+	return filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, p)
+		target := filepath.Join(dst, rel)
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, 0755)
+		case info.Mode().IsRegular():
+			return copyFile(p, target)
+		}
+		log.Printf("Skipping %s: not a regular file", p)
+		return nil
+	})
+}
+
+// LoadStoredManifest returns a manifest kept in the cache, without running
+// steamcmd.
+func (d *Downloader) LoadStoredManifest(depotID int, manifestID string) (*Manifest, error) {
+	path, ok := d.storedManifest(depotID, manifestID)
+	if !ok {
+		return nil, fmt.Errorf("manifest %s of depot %d is not stored", manifestID, depotID)
+	}
+	return LoadManifest(path)
+}
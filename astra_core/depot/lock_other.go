@@ -0,0 +1,7 @@
+//go:build !unix
+
+package depot
+
+import "os"
+
+func lockFile(f *os.File) error { return nil }
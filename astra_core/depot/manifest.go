@@ -0,0 +1,345 @@
+package depot
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Section magics of a Steam depot manifest. Each section is the magic, a
+// little-endian length and a protobuf message.
+const (
+	manifestPayloadMagic   = 0x71F617D0
+	manifestMetadataMagic  = 0x1F4812BE
+	manifestSignatureMagic = 0x1B81B817
+	manifestEndMagic       = 0x32C415AB
+)
+
+// EDepotFileFlag values.
+const (
+	FileFlagUserConfig       = 1 << 0
+	FileFlagVersionedConfig  = 1 << 1
+	FileFlagEncrypted        = 1 << 2
+	FileFlagReadOnly         = 1 << 3
+	FileFlagHidden           = 1 << 4
+	FileFlagExecutable       = 1 << 5
+	FileFlagDirectory        = 1 << 6
+	FileFlagCustomExecutable = 1 << 7
+	FileFlagInstallScript    = 1 << 8
+	FileFlagSymlink          = 1 << 9
+)
+
+var ErrEncryptedFilenames = errors.New("manifest filenames are encrypted")
+
+// Manifest is a parsed depot manifest: the files of one build of a depot.
+type Manifest struct {
+	DepotID            int
+	ManifestID         string
+	CreationTime       time.Time
+	FilenamesEncrypted bool
+	OriginalSize       uint64
+	CompressedSize     uint64
+	UniqueChunks       int
+	Files              []ManifestFile
+}
+
+type ManifestFile struct {
+	Name       string // depot-relative, with forward slashes
+	Size       uint64
+	Flags      uint32
+	SHA1       string // of the content, hex
+	LinkTarget string
+	Chunks     []ManifestChunk
+}
+
+func (f ManifestFile) IsDir() bool {
+	return f.Flags&FileFlagDirectory != 0
+}
+
+type ManifestChunk struct {
+	SHA1           string
+	CRC            uint32
+	Offset         uint64
+	OriginalSize   uint32
+	CompressedSize uint32
+}
+
+// LoadManifest reads a manifest as steamcmd stores it in its depotcache.
+// Zip-wrapped manifests, as served by the content servers, are accepted too.
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseManifest(data)
+}
+
+func ParseManifest(data []byte) (*Manifest, error) {
+	if bytes.HasPrefix(data, []byte("PK")) {
+		unzipped, err := unzipManifest(data)
+		if err != nil {
+			return nil, err
+		}
+		data = unzipped
+	}
+
+	m := &Manifest{}
+	var payload []byte
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return nil, fmt.Errorf("truncated manifest section")
+		}
+		magic := binary.LittleEndian.Uint32(data)
+		if magic == manifestEndMagic {
+			break
+		}
+		if len(data) < 8 {
+			return nil, fmt.Errorf("truncated manifest section")
+		}
+		size := binary.LittleEndian.Uint32(data[4:])
+		if uint64(size) > uint64(len(data)-8) {
+			return nil, fmt.Errorf("manifest section 0x%08x overruns the file", magic)
+		}
+		body := data[8 : 8+size]
+		data = data[8+size:]
+
+		switch magic {
+		case manifestPayloadMagic:
+			payload = body
+		case manifestMetadataMagic:
+			if err := m.parseMetadata(body); err != nil {
+				return nil, fmt.Errorf("manifest metadata: %w", err)
+			}
+		case manifestSignatureMagic:
+		default:
+			return nil, fmt.Errorf("unknown manifest section 0x%08x", magic)
+		}
+	}
+	if payload == nil {
+		return nil, fmt.Errorf("manifest has no payload")
+	}
+	if m.FilenamesEncrypted {
+		return nil, ErrEncryptedFilenames
+	}
+	if err := m.parsePayload(payload); err != nil {
+		return nil, fmt.Errorf("manifest payload: %w", err)
+	}
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Name < m.Files[j].Name })
+	return m, nil
+}
+
+func unzipManifest(data []byte) ([]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	if len(zr.File) == 0 {
+		return nil, fmt.Errorf("empty manifest archive")
+	}
+	rc, err := zr.File[0].Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// ContentManifestMetadata
+func (m *Manifest) parseMetadata(b []byte) error {
+	return eachField(b, func(num int, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			m.DepotID = int(v)
+		case 2:
+			m.ManifestID = strconv.FormatUint(v, 10)
+		case 3:
+			m.CreationTime = time.Unix(int64(v), 0).UTC()
+		case 4:
+			m.FilenamesEncrypted = v != 0
+		case 5:
+			m.OriginalSize = v
+		case 6:
+			m.CompressedSize = v
+		case 7:
+			m.UniqueChunks = int(v)
+		}
+		return nil
+	})
+}
+
+// ContentManifestPayload: repeated FileMapping mappings = 1.
+func (m *Manifest) parsePayload(b []byte) error {
+	return eachField(b, func(num int, _ uint64, data []byte) error {
+		if num != 1 {
+			return nil
+		}
+		f, err := parseFileMapping(data)
+		if err != nil {
+			return err
+		}
+		m.Files = append(m.Files, f)
+		return nil
+	})
+}
+
+func parseFileMapping(b []byte) (ManifestFile, error) {
+	var f ManifestFile
+	err := eachField(b, func(num int, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			f.Name = strings.ReplaceAll(strings.TrimRight(string(data), "\x00"), `\`, "/")
+		case 2:
+			f.Size = v
+		case 3:
+			f.Flags = uint32(v)
+		case 5:
+			f.SHA1 = hex.EncodeToString(data)
+		case 6:
+			c, err := parseChunk(data)
+			if err != nil {
+				return err
+			}
+			f.Chunks = append(f.Chunks, c)
+		case 7:
+			f.LinkTarget = string(data)
+		}
+		return nil
+	})
+	return f, err
+}
+
+func parseChunk(b []byte) (ManifestChunk, error) {
+	var c ManifestChunk
+	err := eachField(b, func(num int, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			c.SHA1 = hex.EncodeToString(data)
+		case 2:
+			c.CRC = uint32(v)
+		case 3:
+			c.Offset = v
+		case 4:
+			c.OriginalSize = uint32(v)
+		case 5:
+			c.CompressedSize = uint32(v)
+		}
+		return nil
+	})
+	return c, err
+}
+
+// eachField walks the fields of a protobuf message. Scalars arrive in v,
+// length-delimited fields in data.
+func eachField(b []byte, fn func(num int, v uint64, data []byte) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return fmt.Errorf("bad field key")
+		}
+		b = b[n:]
+		num := int(key >> 3)
+
+		var v uint64
+		var data []byte
+		switch key & 7 {
+		case 0: // varint
+			v, n = binary.Uvarint(b)
+			if n <= 0 {
+				return fmt.Errorf("bad varint in field %d", num)
+			}
+			b = b[n:]
+		case 1: // fixed64
+			if len(b) < 8 {
+				return fmt.Errorf("truncated field %d", num)
+			}
+			v = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case 2: // length-delimited
+			size, n := binary.Uvarint(b)
+			if n <= 0 || size > uint64(len(b)-n) {
+				return fmt.Errorf("bad length in field %d", num)
+			}
+			data = b[n : n+int(size)]
+			b = b[n+int(size):]
+		case 5: // fixed32
+			if len(b) < 4 {
+				return fmt.Errorf("truncated field %d", num)
+			}
+			v = uint64(binary.LittleEndian.Uint32(b))
+			b = b[4:]
+		default:
+			return fmt.Errorf("unsupported wire type %d in field %d", key&7, num)
+		}
+		if err := fn(num, v, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ManifestDiff is the file-level difference between two builds of a depot.
+// A file changed when its content hash differs.
+type ManifestDiff struct {
+	DepotID     int
+	OldManifest string
+	NewManifest string
+	Added       []string
+	Removed     []string
+	Changed     []string
+	SizeDelta   int64
+}
+
+func (d *ManifestDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// CompareManifests diffs the files of two manifests; directories are skipped.
+// old may be nil for a new depot.
+func CompareManifests(old, new *Manifest) ManifestDiff {
+	d := ManifestDiff{DepotID: new.DepotID, NewManifest: new.ManifestID}
+	oldFiles := make(map[string]ManifestFile)
+	if old != nil {
+		d.OldManifest = old.ManifestID
+		for _, f := range old.Files {
+			if !f.IsDir() {
+				oldFiles[strings.ToLower(f.Name)] = f
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, f := range new.Files {
+		if f.IsDir() {
+			continue
+		}
+		key := strings.ToLower(f.Name)
+		seen[key] = true
+		prev, ok := oldFiles[key]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, f.Name)
+			d.SizeDelta += int64(f.Size)
+		case prev.SHA1 != f.SHA1 || prev.Size != f.Size || prev.LinkTarget != f.LinkTarget:
+			d.Changed = append(d.Changed, f.Name)
+			d.SizeDelta += int64(f.Size) - int64(prev.Size)
+		}
+	}
+	if old != nil {
+		for _, f := range old.Files {
+			if !f.IsDir() && !seen[strings.ToLower(f.Name)] {
+				d.Removed = append(d.Removed, f.Name)
+				d.SizeDelta -= int64(f.Size)
+			}
+		}
+	}
+	return d
+}
@@ -0,0 +1,231 @@
+package depot
+
+import (
+	"encoding/binary"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The helpers below hand-encode the protobuf fields and sections of a manifest.
+
+func pbVarint(num int, v uint64) []byte {
+	b := binary.AppendUvarint(nil, uint64(num)<<3)
+	return binary.AppendUvarint(b, v)
+}
+
+func pbFixed32(num int, v uint32) []byte {
+	b := binary.AppendUvarint(nil, uint64(num)<<3|5)
+	return binary.LittleEndian.AppendUint32(b, v)
+}
+
+func pbFixed64(num int, v uint64) []byte {
+	b := binary.AppendUvarint(nil, uint64(num)<<3|1)
+	return binary.LittleEndian.AppendUint64(b, v)
+}
+
+func pbBytes(num int, data []byte) []byte {
+	b := binary.AppendUvarint(nil, uint64(num)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+func manifestSection(magic uint32, body []byte) []byte {
+	b := binary.LittleEndian.AppendUint32(nil, magic)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(body)))
+	return append(b, body...)
+}
+
+func concat(parts ...[]byte) []byte {
+	return slices.Concat(parts...)
+}
+
+func testMetadata(encrypted bool) []byte {
+	flag := uint64(0)
+	if encrypted {
+		flag = 1
+	}
+	return manifestSection(manifestMetadataMagic, concat(
+		pbVarint(1, 2347771),
+		pbVarint(2, 7617088375292372759),
+		pbVarint(3, 1700000000),
+		pbVarint(4, flag),
+		pbVarint(5, 4096),
+		pbVarint(6, 1024),
+		pbVarint(7, 2),
+	))
+}
+
+func testPayload() []byte {
+	chunk := concat(
+		pbBytes(1, []byte{0xaa, 0xbb}),
+		pbFixed32(2, 0xdeadbeef),
+		pbVarint(3, 0),
+		pbFixed32(4, 4096),
+		pbFixed32(5, 1024),
+	)
+	dll := concat(
+		pbBytes(1, []byte(`game\csgo\bin\win64\server.dll`+"\x00")),
+		pbVarint(2, 4096),
+		pbVarint(3, FileFlagReadOnly),
+		pbBytes(5, []byte{0x01, 0x02, 0x03}),
+		pbBytes(6, chunk),
+	)
+	dir := concat(
+		pbBytes(1, []byte(`game\csgo`)),
+		pbVarint(3, FileFlagDirectory),
+	)
+	return manifestSection(manifestPayloadMagic, concat(pbBytes(1, dll), pbBytes(1, dir)))
+}
+
+func TestParseManifest(t *testing.T) {
+	data := concat(
+		testPayload(),
+		testMetadata(false),
+		manifestSection(manifestSignatureMagic, []byte("signature")),
+		binary.LittleEndian.AppendUint32(nil, manifestEndMagic),
+	)
+	m, err := ParseManifest(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.DepotID != 2347771 || m.ManifestID != "7617088375292372759" {
+		t.Errorf("depot %d manifest %s, want 2347771 7617088375292372759", m.DepotID, m.ManifestID)
+	}
+	if !m.CreationTime.Equal(time.Unix(1700000000, 0)) || m.OriginalSize != 4096 || m.CompressedSize != 1024 || m.UniqueChunks != 2 {
+		t.Errorf("metadata %+v", m)
+	}
+	if len(m.Files) != 2 {
+		t.Fatalf("%d files, want 2", len(m.Files))
+	}
+
+	dir, dll := m.Files[0], m.Files[1]
+	if dir.Name != "game/csgo" || !dir.IsDir() {
+		t.Errorf("first file %+v, want the game/csgo directory", dir)
+	}
+	if dll.Name != "game/csgo/bin/win64/server.dll" || dll.Size != 4096 || dll.Flags != FileFlagReadOnly || dll.SHA1 != "010203" {
+		t.Errorf("second file %+v", dll)
+	}
+	want := ManifestChunk{SHA1: "aabb", CRC: 0xdeadbeef, Offset: 0, OriginalSize: 4096, CompressedSize: 1024}
+	if !slices.Equal(dll.Chunks, []ManifestChunk{want}) {
+		t.Errorf("chunks %+v, want %+v", dll.Chunks, want)
+	}
+}
+
+func TestParseManifestErrors(t *testing.T) {
+	payload := testPayload()
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"encrypted filenames", concat(payload, testMetadata(true)), ErrEncryptedFilenames.Error()},
+		{"truncated magic", payload[:3], "truncated manifest section"},
+		{"truncated size", payload[:6], "truncated manifest section"},
+		{"truncated section", payload[:len(payload)-1], "overruns the file"},
+		{"truncated file mapping", manifestSection(manifestPayloadMagic, pbBytes(1, pbBytes(1, []byte("abc"))[:3])), "bad length in field 1"},
+		{"unknown section", concat(payload, manifestSection(0x12345678, nil)), "unknown manifest section"},
+		{"no payload", testMetadata(false), "manifest has no payload"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseManifest(tt.data)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	_, err := ParseManifest(concat(payload, testMetadata(true)))
+	if !errors.Is(err, ErrEncryptedFilenames) {
+		t.Errorf("encrypted filenames: %v, want ErrEncryptedFilenames", err)
+	}
+}
+
+func TestEachField(t *testing.T) {
+	type field struct {
+		num  int
+		v    uint64
+		data string
+	}
+	tests := []struct {
+		name    string
+		b       []byte
+		want    []field
+		wantErr string
+	}{
+		{
+			name: "every wire type",
+			b:    concat(pbVarint(1, 300), pbFixed64(2, 1<<40), pbBytes(3, []byte("abc")), pbFixed32(4, 7)),
+			want: []field{{1, 300, ""}, {2, 1 << 40, ""}, {3, 0, "abc"}, {4, 7, ""}},
+		},
+		{name: "empty", b: nil},
+		{name: "bad key", b: []byte{0x80}, wantErr: "bad field key"},
+		{name: "bad varint", b: []byte{0x08, 0x80}, wantErr: "bad varint in field 1"},
+		{name: "truncated fixed64", b: pbFixed64(2, 1)[:5], wantErr: "truncated field 2"},
+		{name: "truncated fixed32", b: pbFixed32(4, 1)[:3], wantErr: "truncated field 4"},
+		{name: "length past the end", b: pbBytes(3, []byte("abc"))[:4], wantErr: "bad length in field 3"},
+		{name: "group wire type", b: []byte{0x0b}, wantErr: "unsupported wire type 3 in field 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []field
+			err := eachField(tt.b, func(num int, v uint64, data []byte) error {
+				got = append(got, field{num, v, string(data)})
+				return nil
+			})
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("fields %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareManifests(t *testing.T) {
+	old := &Manifest{DepotID: 11, ManifestID: "100", Files: []ManifestFile{
+		{Name: "game/bin", Flags: FileFlagDirectory},
+		{Name: "game/bin/client.dll", Size: 100, SHA1: "aa"},
+		{Name: "game/bin/engine2.dll", Size: 50, SHA1: "bb"},
+		{Name: "game/bin/server.dll", Size: 70, SHA1: "cc"},
+	}}
+	new := &Manifest{DepotID: 11, ManifestID: "200", Files: []ManifestFile{
+		{Name: "game/bin", Flags: FileFlagDirectory},
+		{Name: "game/bin/Client.dll", Size: 100, SHA1: "aa"},
+		{Name: "game/bin/engine2.dll", Size: 60, SHA1: "dd"},
+		{Name: "game/bin/tier0.dll", Size: 30, SHA1: "ee"},
+	}}
+
+	d := CompareManifests(old, new)
+	if d.DepotID != 11 || d.OldManifest != "100" || d.NewManifest != "200" {
+		t.Errorf("diff of depot %d %s -> %s, want 11 100 -> 200", d.DepotID, d.OldManifest, d.NewManifest)
+	}
+	if !slices.Equal(d.Added, []string{"game/bin/tier0.dll"}) {
+		t.Errorf("added %q", d.Added)
+	}
+	if !slices.Equal(d.Changed, []string{"game/bin/engine2.dll"}) {
+		t.Errorf("changed %q", d.Changed)
+	}
+	if !slices.Equal(d.Removed, []string{"game/bin/server.dll"}) {
+		t.Errorf("removed %q", d.Removed)
+	}
+	if d.SizeDelta != 30+10-70 {
+		t.Errorf("size delta %d, want %d", d.SizeDelta, 30+10-70)
+	}
+
+	first := CompareManifests(nil, new)
+	if len(first.Added) != 3 || len(first.Removed) != 0 || first.OldManifest != "" {
+		t.Errorf("diff against no old manifest %+v, want every file added", first)
+	}
+}
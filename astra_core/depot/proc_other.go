@@ -0,0 +1,7 @@
+//go:build !unix
+
+package depot
+
+import "os/exec"
+
+func killOnCancel(cmd *exec.Cmd) {}
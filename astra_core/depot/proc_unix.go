@@ -0,0 +1,18 @@
+//go:build unix
+
+package depot
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killOnCancel makes cancellation kill steamcmd's whole process group:
+// steamcmd.sh runs the real client as a child, which would otherwise keep
+// downloading.
+func killOnCancel(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
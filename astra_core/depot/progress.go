@@ -0,0 +1,44 @@
+package depot
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+)
+
+// DownloadProgress is the download state steamcmd reports.
+type DownloadProgress struct {
+	Percent    float64 `json:"percent"`
+	BytesDone  int64   `json:"bytes_done"`
+	BytesTotal int64   `json:"bytes_total"`
+}
+
+// ProgressFunc receives download progress; it may be nil.
+type ProgressFunc func(DownloadProgress)
+
+// progressPattern matches steamcmd's progress lines, e.g.
+// Update state (0x61) downloading, progress: 45.23 (1234567 / 2729000000)
+var progressPattern = regexp.MustCompile(`progress: (\d+(?:\.\d+)?) \((\d+) / (\d+)\)`)
+
+func parseProgress(line string) (DownloadProgress, bool) {
+	m := progressPattern.FindStringSubmatch(line)
+	if m == nil {
+		return DownloadProgress{}, false
+	}
+	var p DownloadProgress
+	p.Percent, _ = strconv.ParseFloat(m[1], 64)
+	p.BytesDone, _ = strconv.ParseInt(m[2], 10, 64)
+	p.BytesTotal, _ = strconv.ParseInt(m[3], 10, 64)
+	return p, true
+}
+
+// scanLines splits on \n and on the bare \r steamcmd uses to redraw progress.
+func scanLines(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
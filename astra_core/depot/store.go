@@ -0,0 +1,216 @@
+package depot
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The cache is content addressed: every file is stored once under
+// objects/<sha1[:2]>/<sha1>, and each cached build is a tree of hardlinks to
+// its objects, with an index in trees/<entry>.json. Keeping many builds costs
+// little more than one, since most files are shared.
+const (
+	objectsDir = "objects"
+	treesDir   = "trees"
+)
+
+// TreeEntry is one file of a cached build.
+type TreeEntry struct {
+	Path string `json:"path"` // relative, with forward slashes
+	SHA1 string `json:"sha1"`
+	Size int64  `json:"size"`
+}
+
+// isStoreDir reports the cache subdirectories that are not build trees.
+func isStoreDir(name string) bool {
+	return name == objectsDir || name == treesDir || name == manifestsDir || name == downloadsDir || name == quarantineDir
+}
+
+func (d *Downloader) objectPath(sha string) string {
+	return filepath.Join(d.cachePath, objectsDir, sha[:2], sha)
+}
+
+func (d *Downloader) treeIndexPath(entry string) string {
+	return filepath.Join(d.cachePath, treesDir, entry+".json")
+}
+
+// ingestTree moves the files of a cache entry into the object store and links
+// them back into place, then writes the entry's index. Files already linked to
+// their object are not hashed again, so growing a sparse entry is cheap.
+func (d *Downloader) ingestTree(entry string) error {
+	root := filepath.Join(d.cachePath, entry)
+	known := make(map[string]TreeEntry)
+	if entries, err := d.readTree(entry); err == nil {
+		for _, e := range entries {
+			known[e.Path] = e
+		}
+	}
+
+	var tree []TreeEntry
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		rel = filepath.ToSlash(rel)
+
+		if e, ok := known[rel]; ok && e.Size == info.Size() {
+			if objInfo, err := os.Stat(d.objectPath(e.SHA1)); err == nil && os.SameFile(info, objInfo) {
+				tree = append(tree, e)
+				return nil
+			}
+		}
+
+		sha, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		if err := d.linkObject(path, sha, info.Size()); err != nil {
+			return fmt.Errorf("store %s: %w", rel, err)
+		}
+		tree = append(tree, TreeEntry{Path: rel, SHA1: sha, Size: info.Size()})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return d.writeTree(entry, tree)
+}
+
+// linkObject makes path a hardlink of its object, creating the object from
+// path when it is new.
+func (d *Downloader) linkObject(path, sha string, size int64) error {
+	obj := d.objectPath(sha)
+	if info, err := os.Stat(obj); err == nil && info.Size() == size {
+		tmp := path + ".link"
+		if err := os.Link(obj, tmp); err != nil {
+			// Without hardlinks the entry keeps its own copy.
+			return nil
+		}
+		return os.Rename(tmp, path)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(obj), 0755); err != nil {
+		return err
+	}
+	os.Remove(obj)
+	if err := os.Link(path, obj); err != nil {
+		// Cross-device or no hardlink support: store a copy.
+		return copyFile(path, obj)
+	}
+	return nil
+}
+
+func (d *Downloader) writeTree(entry string, tree []TreeEntry) error {
+	sort.Slice(tree, func(i, j int) bool { return tree[i].Path < tree[j].Path })
+	data, err := json.Marshal(tree)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(d.cachePath, treesDir), 0755); err != nil {
+		return err
+	}
+	tmp := d.treeIndexPath(entry) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, d.treeIndexPath(entry))
+}
+
+func (d *Downloader) readTree(entry string) ([]TreeEntry, error) {
+	data, err := os.ReadFile(d.treeIndexPath(entry))
+	if err != nil {
+		return nil, err
+	}
+	var tree []TreeEntry
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// removeTree deletes a cache entry and its index. Its objects stay until
+// collectGarbage finds them unreferenced.
+func (d *Downloader) removeTree(entry string) error {
+	os.Remove(d.treeIndexPath(entry))
+	return os.RemoveAll(filepath.Join(d.cachePath, entry))
+}
+
+// collectGarbage deletes the objects no tree references and returns the
+// bytes freed.
+func (d *Downloader) collectGarbage() (int64, error) {
+	referenced := make(map[string]bool)
+	indexes, _ := filepath.Glob(filepath.Join(d.cachePath, treesDir, "*.json"))
+	for _, index := range indexes {
+		tree, err := d.readTree(strings.TrimSuffix(filepath.Base(index), ".json"))
+		if err != nil {
+			// An unreadable index could hide references; keep everything.
+			return 0, fmt.Errorf("read %s: %w", index, err)
+		}
+		for _, e := range tree {
+			referenced[e.SHA1] = true
+		}
+	}
+
+	var freed int64
+	err := filepath.Walk(filepath.Join(d.cachePath, objectsDir), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || referenced[info.Name()] {
+			return nil
+		}
+		if err := os.Remove(path); err == nil {
+			freed += info.Size()
+		}
+		return nil
+	})
+	if freed > 0 {
+		log.Printf("Removed unreferenced cache objects, freed %d bytes", freed)
+	}
+	return freed, err
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha1.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,245 @@
+package depot
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// quarantineDir holds cache entries that failed verification, kept for
+// inspection instead of being deleted.
+const quarantineDir = "quarantine"
+
+// VerifyResult is the outcome of re-checking a cache entry.
+type VerifyResult struct {
+	Name        string   `json:"name"`
+	Against     string   `json:"against"` // "manifest", "tree", or empty when there is nothing to check against
+	Files       int      `json:"files"`
+	Problems    []string `json:"problems,omitempty"`
+	Quarantined string   `json:"quarantined,omitempty"` // where the entry was moved
+}
+
+// fileProblem is a file of a build that does not match what was expected.
+type fileProblem struct {
+	path string // relative, with forward slashes
+	msg  string
+}
+
+func (p fileProblem) String() string { return p.path + " " + p.msg }
+
+// checkFile compares a file with its manifest record. Empty files have no
+// hash worth checking.
+func checkFile(path string, f ManifestFile) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "is missing"
+	}
+	if uint64(info.Size()) != f.Size {
+		return fmt.Sprintf("is %d bytes, manifest says %d", info.Size(), f.Size)
+	}
+	if f.SHA1 != "" && f.Size > 0 {
+		if sha, err := hashFile(path); err != nil || sha != f.SHA1 {
+			return "does not match its manifest hash"
+		}
+	}
+	return ""
+}
+
+// contentProblems checks the files in dir against a manifest: each must be
+// in it, with its size and hash. A complete build must also hold every file
+// of the manifest; a sparse one only some. It returns the files checked.
+func contentProblems(dir string, m *Manifest, complete bool) ([]fileProblem, int) {
+	byName := make(map[string]ManifestFile)
+	for _, f := range m.Files {
+		if f.IsDir() || f.Flags&FileFlagSymlink != 0 {
+			continue
+		}
+		byName[strings.ToLower(f.Name)] = f
+	}
+
+	var problems []fileProblem
+	seen := make(map[string]bool)
+	filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, p)
+		rel = filepath.ToSlash(rel)
+		f, ok := byName[strings.ToLower(rel)]
+		if !ok {
+			problems = append(problems, fileProblem{rel, "is not in the manifest"})
+			return nil
+		}
+		seen[strings.ToLower(rel)] = true
+		if msg := checkFile(p, f); msg != "" {
+			problems = append(problems, fileProblem{rel, msg})
+		}
+		return nil
+	})
+	if complete {
+		for _, f := range m.Files {
+			if _, ok := byName[strings.ToLower(f.Name)]; ok && !seen[strings.ToLower(f.Name)] {
+				problems = append(problems, fileProblem{f.Name, "is missing"})
+			}
+		}
+	}
+	return problems, len(seen)
+}
+
+// treeProblems checks a cache entry against its tree index, which records
+// the hashes of its files when they were stored.
+func treeProblems(dir string, tree []TreeEntry) ([]fileProblem, int) {
+	var problems []fileProblem
+	known := make(map[string]bool, len(tree))
+	for _, t := range tree {
+		known[t.Path] = true
+		msg := checkFile(filepath.Join(dir, filepath.FromSlash(t.Path)), ManifestFile{Name: t.Path, Size: uint64(t.Size), SHA1: t.SHA1})
+		if msg != "" {
+			problems = append(problems, fileProblem{t.Path, strings.Replace(msg, "manifest", "stored", 1)})
+		}
+	}
+	filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			rel, _ := filepath.Rel(dir, p)
+			if !known[filepath.ToSlash(rel)] {
+				problems = append(problems, fileProblem{filepath.ToSlash(rel), "was not stored with the build"})
+			}
+		}
+		return nil
+	})
+	return problems, len(tree)
+}
+
+// checkContent verifies that dir holds the files of the manifest, with their
+// sizes and hashes; all of them unless the build is partial.
+func checkContent(dir string, m *Manifest, complete bool) error {
+	problems, _ := contentProblems(dir, m, complete)
+	if len(problems) == 0 {
+		return nil
+	}
+	msgs := make([]string, 0, 11)
+	for i, p := range problems {
+		if i == 10 {
+			msgs = append(msgs, fmt.Sprintf("and %d more", len(problems)-10))
+			break
+		}
+		msgs = append(msgs, p.String())
+	}
+	return fmt.Errorf("content does not match manifest %s: %s", m.ManifestID, strings.Join(msgs, "; "))
+}
+
+// Verify re-checks a cache entry against its stored manifest, or against its
+// tree index without one. Entries cached before deduplication and without a
+// manifest cannot be checked. A corrupt entry is moved to the quarantine
+// directory and dropped from the cache, so the next job downloads it again.
+func (d *Downloader) Verify(name string) (*VerifyResult, error) {
+	d.cache.mu.Lock()
+	e := d.cache.index.Entries[name]
+	var entry CacheEntry
+	if e != nil {
+		entry = *e
+	}
+	d.cache.mu.Unlock()
+	if e == nil {
+		return nil, ErrNotCached
+	}
+
+	dir := filepath.Join(d.cachePath, name)
+	result := &VerifyResult{Name: name}
+	var problems []fileProblem
+	if m, err := d.LoadStoredManifest(entry.DepotID, entry.ManifestID); err == nil {
+		result.Against = "manifest"
+		problems, result.Files = contentProblems(dir, m, !entry.Sparse)
+	} else if tree, err := d.readTree(name); err == nil {
+		result.Against = "tree"
+		problems, result.Files = treeProblems(dir, tree)
+	} else {
+		return result, nil
+	}
+	if len(problems) == 0 {
+		return result, nil
+	}
+
+	for _, p := range problems {
+		result.Problems = append(result.Problems, p.String())
+	}
+	dest, err := d.quarantine(name, problems)
+	if err != nil {
+		return result, fmt.Errorf("quarantine %s: %w", name, err)
+	}
+	result.Quarantined = dest
+	return result, nil
+}
+
+// VerifyAll verifies every cache entry, in name order.
+func (d *Downloader) VerifyAll() []VerifyResult {
+	d.cache.mu.Lock()
+	names := make([]string, 0, len(d.cache.index.Entries))
+	for name := range d.cache.index.Entries {
+		names = append(names, name)
+	}
+	d.cache.mu.Unlock()
+	sort.Strings(names)
+
+	var results []VerifyResult
+	for _, name := range names {
+		result, err := d.Verify(name)
+		if err == ErrNotCached {
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to verify %s: %v", name, err)
+		}
+		if result != nil {
+			results = append(results, *result)
+		}
+	}
+	return results
+}
+
+// quarantine moves a corrupt entry out of the cache and evicts it. The
+// objects behind its bad files are unlinked too, so no later build is
+// linked to them; the quarantined copy keeps their content.
+func (d *Downloader) quarantine(name string, problems []fileProblem) (string, error) {
+	d.cache.mu.Lock()
+	defer d.cache.mu.Unlock()
+	e := d.cache.index.Entries[name]
+	if e == nil {
+		return "", ErrNotCached
+	}
+
+	dest := filepath.Join(d.cachePath, quarantineDir, name+"-"+time.Now().Format("20060102-150405"))
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", err
+	}
+	if err := os.Rename(filepath.Join(d.cachePath, name), dest); err != nil {
+		return "", err
+	}
+
+	bad := make(map[string]bool, len(problems))
+	for _, p := range problems {
+		bad[p.path] = true
+	}
+	if tree, err := d.readTree(name); err == nil {
+		for _, t := range tree {
+			if !bad[t.Path] {
+				continue
+			}
+			obj := d.objectPath(t.SHA1)
+			objInfo, err1 := os.Stat(obj)
+			fileInfo, err2 := os.Stat(filepath.Join(dest, filepath.FromSlash(t.Path)))
+			if err1 == nil && err2 == nil && os.SameFile(objInfo, fileInfo) {
+				os.Remove(obj)
+			}
+		}
+	}
+
+	d.evict(e)
+	d.saveCache()
+	log.Printf("Quarantined %s in %s: %d bad file(s)", name, dest, len(problems))
+	return dest, nil
+}
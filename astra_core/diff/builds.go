@@ -0,0 +1,77 @@
+package diff
+
+import (
+	"astra_core/extractor"
+	"fmt"
+	"strings"
+)
+
+// EnhanceWithBuild records one binary's version and build metadata.
+func (t *Tracker) EnhanceWithBuild(result *DiffResult, build extractor.BuildInfoChange) {
+	result.Builds = append(result.Builds, build)
+}
+
+// RebuiltOnly lists the binaries that were recompiled without code changes.
+func (r *DiffResult) RebuiltOnly() []string {
+	var files []string
+	for _, b := range r.Builds {
+		if b.Status == extractor.BuildRebuilt {
+			files = append(files, b.File)
+		}
+	}
+	return files
+}
+
+// BuildsMarkdown summarizes the version and compile time of every binary.
+func BuildsMarkdown(builds []extractor.BuildInfoChange) string {
+	if len(builds) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("## Binary Builds\n\n")
+	for _, b := range builds {
+		sb.WriteString(fmt.Sprintf("- `%s`: %s", b.File, b.Status))
+		if v := buildChange(b.Old.Version(), b.New.Version()); v != "" {
+			sb.WriteString(", version " + v)
+		}
+		if v := buildChange(compileTime(b.Old), compileTime(b.New)); v != "" {
+			sb.WriteString(", compiled " + v)
+		}
+		if b.New.BuildID != "" {
+			sb.WriteString(", build-id `" + b.New.BuildID + "`")
+		}
+		sb.WriteString("\n")
+	}
+	if rebuilt := countStatus(builds, extractor.BuildRebuilt); rebuilt > 0 {
+		sb.WriteString(fmt.Sprintf("\n%d binaries were rebuilt without code changes.\n", rebuilt))
+	}
+	return sb.String()
+}
+
+func compileTime(b *extractor.BuildInfo) string {
+	if t, ok := b.CompiledAt(); ok {
+		return t.Format("2006-01-02 15:04 UTC")
+	}
+	return ""
+}
+
+// buildChange renders "old → new", or just the value when it did not change.
+func buildChange(old, new string) string {
+	if old == "" || old == new {
+		return new
+	}
+	if new == "" {
+		return old
+	}
+	return old + " → " + new
+}
+
+func countStatus(builds []extractor.BuildInfoChange, status string) int {
+	n := 0
+	for _, b := range builds {
+		if b.Status == status {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,367 @@
+package diff
+
+import (
+	"astra_core/extractor"
+	"astra_core/items"
+	"astra_core/localization"
+	"astra_core/rules"
+	"astra_core/steamcmd"
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Evidence is one signal that counted towards an update type.
+type Evidence struct {
+	Source string  `json:"source"` // depot, appinfo, strings, protobuf, files, schema, localization, panorama, symbols, classes
+	Detail string  `json:"detail"`
+	Weight float64 `json:"weight"`
+}
+
+// TypeScore is the accumulated evidence for one update type. Confidence is the
+// type's share of all evidence, discounted by 1-e^-score so that a single weak
+// signal never reads as certain.
+type TypeScore struct {
+	Type       UpdateType `json:"type"`
+	Score      float64    `json:"score"`
+	Confidence float64    `json:"confidence"`
+	Evidence   []Evidence `json:"evidence"`
+}
+
+// Classification is the ranked list of candidate update types, best first.
+type Classification []TypeScore
+
+// Signal weights. 1.0 is one strong signal, e.g. string votes reaching their
+// rule-file threshold; depot and appinfo changes only say where something changed.
+const (
+	weightDepot        = 0.5
+	weightDepotMinor   = 0.25
+	weightBranch       = 0.5
+	weightNewBranch    = 0.25
+	weightAppInfoKey   = 0.25
+	weightProtobuf     = 1
+	weightNewItem      = 2
+	weightNewKit       = 2
+	weightChangedItem  = 1
+	weightToken        = 0.5
+	weightPanoramaFile = 0.5
+	weightUIEvent      = 0.5
+	weightExport       = 0.25
+	weightClass        = 0.5
+	weightFunction     = 0.1
+	weightFile         = 0.5
+)
+
+var depotSignals = map[string]struct {
+	typ    UpdateType
+	weight float64
+}{
+	"2347779": {UpdateTypeServer, weightDepot},
+	"731":     {UpdateTypePatch, weightDepot},
+	"2347770": {UpdateTypePatch, weightDepot},
+	"734":     {UpdateTypePatch, weightDepotMinor},
+	"735":     {UpdateTypePatch, weightDepotMinor},
+	"736":     {UpdateTypePatch, weightDepotMinor},
+	"2347773": {UpdateTypeMap, weightDepotMinor},
+	"2347774": {UpdateTypeMap, weightDepotMinor},
+}
+
+// scaled turns a count into a weight: base for one occurrence, growing logarithmically.
+func scaled(base float64, n int) float64 {
+	if n <= 0 {
+		return 0
+	}
+	return base * (1 + math.Log2(float64(n)))
+}
+
+func (r *DiffResult) addEvidence(typ UpdateType, source string, weight float64, format string, args ...any) {
+	if weight <= 0 {
+		return
+	}
+	e := Evidence{Source: source, Detail: fmt.Sprintf(format, args...), Weight: math.Round(weight*100) / 100}
+	for i := range r.Classification {
+		if r.Classification[i].Type == typ {
+			r.Classification[i].Evidence = append(r.Classification[i].Evidence, e)
+			return
+		}
+	}
+	r.Classification = append(r.Classification, TypeScore{Type: typ, Evidence: []Evidence{e}})
+}
+
+// rank rescores the classification and sets Type/TypeReason from the winner.
+func (r *DiffResult) rank() {
+	total := 0.0
+	for i := range r.Classification {
+		ts := &r.Classification[i]
+		ts.Score = 0
+		for _, e := range ts.Evidence {
+			ts.Score += e.Weight
+		}
+		sort.SliceStable(ts.Evidence, func(a, b int) bool { return ts.Evidence[a].Weight > ts.Evidence[b].Weight })
+		total += ts.Score
+	}
+
+	sort.SliceStable(r.Classification, func(i, j int) bool {
+		if r.Classification[i].Score != r.Classification[j].Score {
+			return r.Classification[i].Score > r.Classification[j].Score
+		}
+		return r.Classification[i].Type < r.Classification[j].Type
+	})
+	for i := range r.Classification {
+		ts := &r.Classification[i]
+		confidence := ts.Score / total * (1 - math.Exp(-ts.Score))
+		ts.Score = math.Round(ts.Score*100) / 100
+		ts.Confidence = math.Round(confidence*100) / 100
+	}
+
+	top, ok := r.Classification.Top()
+	if !ok {
+		r.Type, r.TypeReason = UpdateTypeUnknown, ""
+		return
+	}
+	r.Type = top.Type
+	var reasons []string
+	for i, e := range top.Evidence {
+		if i >= 2 {
+			break
+		}
+		reasons = append(reasons, e.Detail)
+	}
+	r.TypeReason = strings.Join(reasons, "; ")
+}
+
+func (c Classification) Top() (TypeScore, bool) {
+	if len(c) == 0 {
+		return TypeScore{}, false
+	}
+	return c[0], true
+}
+
+func (c Classification) Markdown(limit int) string {
+	if len(c) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("## Classification\n\n")
+	for i, ts := range c {
+		if i >= limit {
+			sb.WriteString(fmt.Sprintf("... and %d more\n", len(c)-limit))
+			break
+		}
+		sb.WriteString(fmt.Sprintf("**%s** — %.0f%% (score %.2f)\n", ts.Type, ts.Confidence*100, ts.Score))
+		for _, e := range ts.Evidence {
+			sb.WriteString(fmt.Sprintf("- [%s] %s (+%.2f)\n", e.Source, e.Detail, e.Weight))
+		}
+	}
+	return sb.String()
+}
+
+func addDepotEvidence(result *DiffResult) {
+	for _, depot := range result.ChangedDepots {
+		if sig, ok := depotSignals[depot.ID]; ok {
+			result.addEvidence(sig.typ, "depot", sig.weight, "%s depot changed", depot.Name)
+		}
+	}
+}
+
+func addAppInfoEvidence(result *DiffResult, oldInfo, newInfo *steamcmd.AppInfo) {
+	if oldPublic, ok := oldInfo.Branches["public"]; ok {
+		if newPublic, ok := newInfo.Branches["public"]; ok && newPublic.BuildID != oldPublic.BuildID {
+			result.addEvidence(UpdateTypePatch, "appinfo", weightBranch, "public branch build %s → %s", oldPublic.BuildID, newPublic.BuildID)
+		}
+	}
+	if len(oldInfo.Branches) > 0 {
+		for name := range newInfo.Branches {
+			if _, ok := oldInfo.Branches[name]; !ok {
+				result.addEvidence(UpdateTypeFeature, "appinfo", weightNewBranch, "new branch %q", name)
+			}
+		}
+	}
+
+	// Without a previous appinfo every key would count as changed.
+	if len(oldInfo.Common) == 0 && len(oldInfo.Config) == 0 {
+		return
+	}
+	var changed []string
+	for _, section := range []struct {
+		name     string
+		old, new map[string]string
+	}{{"common", oldInfo.Common, newInfo.Common}, {"config", oldInfo.Config, newInfo.Config}} {
+		for k, v := range section.new {
+			if section.old[k] != v {
+				changed = append(changed, section.name+"/"+k)
+			}
+		}
+		for k := range section.old {
+			if _, ok := section.new[k]; !ok {
+				changed = append(changed, section.name+"/"+k)
+			}
+		}
+	}
+	if len(changed) > 0 {
+		sort.Strings(changed)
+		result.addEvidence(UpdateTypePatch, "appinfo", scaled(weightAppInfoKey, len(changed)),
+			"%d appinfo key(s) changed: %s", len(changed), sampleList(changed, 5))
+	}
+}
+
+func addStringEvidence(result *DiffResult, added []string) {
+	for _, v := range rules.Active().Scores(added) {
+		result.addEvidence(UpdateType(v.Type), "strings", v.Ratio(), "string rules scored %.1f of %.0f (%s)", v.Score, v.Threshold, v.Summary())
+	}
+}
+
+func addProtobufEvidence(result *DiffResult, file string, added, removed []extractor.ProtobufMatch) {
+	var names []string
+	for _, p := range added {
+		names = append(names, "+"+p.Name)
+	}
+	for _, p := range removed {
+		names = append(names, "-"+p.Name)
+	}
+	if n := len(names); n > 0 {
+		result.addEvidence(UpdateTypeProtobuf, "protobuf", scaled(weightProtobuf, n),
+			"%d protobuf message/enum name(s) added or removed in %s: %s", n, file, sampleList(names, 3))
+	}
+}
+
+func addSchemaEvidence(result *DiffResult, d *items.SchemaDiff) {
+	count := func(kind string, f func(*items.SchemaSection) int) int {
+		if s := d.Section(kind); s != nil {
+			return f(s)
+		}
+		return 0
+	}
+	added := func(s *items.SchemaSection) int { return len(s.Added) }
+	changed := func(s *items.SchemaSection) int { return len(s.Changed) }
+
+	if n := count(items.KindCases, added) + count(items.KindItems, added); n > 0 {
+		result.addEvidence(UpdateTypeItem, "schema", scaled(weightNewItem, n), "%d new item definition(s) in items_game.txt", n)
+	}
+	if n := count(items.KindPaintKits, added) + count(items.KindStickerKits, added) + count(items.KindKeychains, added); n > 0 {
+		result.addEvidence(UpdateTypeCosmetic, "schema", scaled(weightNewKit, n), "%d new paint/sticker/keychain kit(s) in items_game.txt", n)
+	}
+	if n := count(items.KindItems, changed) + count(items.KindAttributes, changed); n > 0 {
+		result.addEvidence(UpdateTypeBalance, "schema", scaled(weightChangedItem, n), "%d item/attribute definition(s) changed in items_game.txt", n)
+	}
+}
+
+func addLocalizationEvidence(result *DiffResult, d *localization.Diff) {
+	primary := d.Primary()
+	if primary == nil || primary.Total() == 0 {
+		return
+	}
+	result.addEvidence(UpdateTypeLocalization, "localization", scaled(weightToken, primary.Total()),
+		"%d localization token(s) changed in %s", primary.Total(), primary.Language)
+}
+
+func addPanoramaEvidence(result *DiffResult, d *PanoramaDiff) {
+	if n := len(d.Files); n > 0 {
+		result.addEvidence(UpdateTypeFeature, "panorama", scaled(weightPanoramaFile, n), "%d Panorama file(s) changed", n)
+	}
+	if n := len(d.NewEvents) + len(d.NewIDs); n > 0 {
+		result.addEvidence(UpdateTypeFeature, "panorama", scaled(weightUIEvent, n), "%d new UI event(s)/panel id(s)", n)
+	}
+}
+
+func addSymbolEvidence(result *DiffResult, sd extractor.SymbolDiff) {
+	if n := len(sd.AddedExports) + len(sd.RemovedExports); n > 0 {
+		result.addEvidence(UpdateTypePatch, "symbols", scaled(weightExport, n), "%d export(s) added or removed in %s", n, sd.File)
+	}
+}
+
+func addClassEvidence(result *DiffResult, cd extractor.ClassDiff) {
+	if n := len(cd.Added); n > 0 {
+		var names []string
+		for _, c := range cd.Added {
+			names = append(names, c.Name)
+		}
+		result.addEvidence(UpdateTypeFeature, "classes", scaled(weightClass, n), "%d new class(es) in %s: %s", n, cd.File, sampleList(names, 3))
+	}
+}
+
+func addFunctionEvidence(result *DiffResult, fd extractor.FunctionDiff) {
+	if n := fd.ChangedCount; n > 0 {
+		result.addEvidence(UpdateTypePatch, "functions", scaled(weightFunction, n), "%d function(s) changed in %s", n, fd.File)
+	}
+	if n := fd.AddedCount; n > 0 {
+		result.addEvidence(UpdateTypeFeature, "functions", scaled(weightFunction, n), "%d new function(s) in %s", n, fd.File)
+	}
+}
+
+// fileSignal maps a depot-relative path to the update type it suggests.
+func fileSignal(p string) (UpdateType, bool) {
+	p = strings.ToLower(p)
+	if _, ok := underDir(p, "maps"); ok {
+		return UpdateTypeMap, true
+	}
+	if path.Base(p) == "items_game.txt" {
+		return UpdateTypeItem, true
+	}
+	if rel, ok := underDir(p, "resource"); ok {
+		if _, ok := localization.IsLocalizationFile(rel); ok {
+			return UpdateTypeLocalization, true
+		}
+	}
+	if _, ok := underDir(p, "panorama"); ok {
+		return UpdateTypeFeature, true
+	}
+	switch path.Ext(p) {
+	case ".dll", ".so", ".exe", ".dylib":
+		return UpdateTypePatch, true
+	}
+	return "", false
+}
+
+// underDir returns p from the first path element named dir onwards, so
+// game/csgo/resource/x.txt and resource/x.txt both yield resource/x.txt.
+func underDir(p, dir string) (string, bool) {
+	if strings.HasPrefix(p, dir+"/") {
+		return p, true
+	}
+	if i := strings.Index(p, "/"+dir+"/"); i >= 0 {
+		return p[i+1:], true
+	}
+	return "", false
+}
+
+func addFileEvidence(result *DiffResult) {
+	counts := make(map[UpdateType]map[string]int)
+	tally := func(status string, files []string) {
+		for _, f := range files {
+			typ, ok := fileSignal(f)
+			if !ok {
+				continue
+			}
+			if counts[typ] == nil {
+				counts[typ] = make(map[string]int)
+			}
+			counts[typ][status]++
+		}
+	}
+	tally("new", result.NewFiles)
+	tally("changed", result.ChangedFiles)
+	tally("removed", result.RemovedFiles)
+
+	for typ, byStatus := range counts {
+		total := 0
+		var parts []string
+		for _, status := range []string{"new", "changed", "removed"} {
+			if n := byStatus[status]; n > 0 {
+				total += n
+				parts = append(parts, fmt.Sprintf("%d %s", n, status))
+			}
+		}
+		result.addEvidence(typ, "files", scaled(weightFile, total), "%s file(s) pointing to %s", strings.Join(parts, ", "), typ)
+	}
+}
+
+func sampleList(items []string, limit int) string {
+	if len(items) <= limit {
+		return strings.Join(items, ", ")
+	}
+	return fmt.Sprintf("%s, … (+%d)", strings.Join(items[:limit], ", "), len(items)-limit)
+}
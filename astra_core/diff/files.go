@@ -0,0 +1,48 @@
+package diff
+
+import (
+	"astra_core/depot"
+	"fmt"
+	"strings"
+)
+
+// EnhanceWithManifestDiff adds the file lists of one depot's manifest diff.
+// The classification weighs them later in EnhanceWithFileChanges.
+func (t *Tracker) EnhanceWithManifestDiff(result *DiffResult, change DepotChange, md depot.ManifestDiff) {
+	if md.IsEmpty() {
+		return
+	}
+	result.NewFiles = append(result.NewFiles, md.Added...)
+	result.ChangedFiles = append(result.ChangedFiles, md.Changed...)
+	result.RemovedFiles = append(result.RemovedFiles, md.Removed...)
+	result.Analysis += "\n" + manifestDiffMarkdown(change, md, 20)
+}
+
+func manifestDiffMarkdown(change DepotChange, md depot.ManifestDiff, limit int) string {
+	var sb strings.Builder
+	name := change.Name
+	if name == "" {
+		name = change.ID
+	}
+	sb.WriteString(fmt.Sprintf("## File Changes: %s\n\n", name))
+	sb.WriteString(fmt.Sprintf("%d new, %d changed, %d removed, %+d bytes\n\n", len(md.Added), len(md.Changed), len(md.Removed), md.SizeDelta))
+
+	writeFiles := func(title, prefix string, files []string) {
+		if len(files) == 0 {
+			return
+		}
+		sb.WriteString(fmt.Sprintf("**%s (%d):**\n", title, len(files)))
+		for i, f := range files {
+			if i >= limit {
+				sb.WriteString(fmt.Sprintf("... and %d more\n", len(files)-limit))
+				break
+			}
+			sb.WriteString(prefix + " `" + f + "`\n")
+		}
+	}
+
+	writeFiles("New Files", "+", md.Added)
+	writeFiles("Changed Files", "~", md.Changed)
+	writeFiles("Removed Files", "-", md.Removed)
+	return sb.String()
+}
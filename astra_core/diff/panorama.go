@@ -0,0 +1,141 @@
+package diff
+
+import (
+	"astra_core/panorama"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// LCS in GenerateUnifiedDiff is quadratic, so very large files only get a status line.
+const maxPanoramaDiffLines = 4000
+
+type PanoramaFileDiff struct {
+	Path        string `json:"path"`
+	Kind        string `json:"kind"`
+	Status      string `json:"status"` // added, removed, modified
+	UnifiedDiff string `json:"unified_diff,omitempty"`
+}
+
+type PanoramaDiff struct {
+	Files         []PanoramaFileDiff `json:"files"`
+	NewPanels     []string           `json:"new_panels,omitempty"`
+	NewIDs        []string           `json:"new_ids,omitempty"`
+	NewEvents     []string           `json:"new_events,omitempty"`
+	RemovedIDs    []string           `json:"removed_ids,omitempty"`
+	RemovedEvents []string           `json:"removed_events,omitempty"`
+}
+
+func (d *PanoramaDiff) IsEmpty() bool {
+	return d == nil || len(d.Files) == 0
+}
+
+// ComparePanorama produces per-file unified diffs of layouts, styles and scripts
+// plus the panel types, ids and events that appeared or disappeared overall.
+func ComparePanorama(old, new map[string]panorama.File) *PanoramaDiff {
+	result := &PanoramaDiff{}
+
+	paths := make(map[string]bool)
+	for p := range old {
+		paths[p] = true
+	}
+	for p := range new {
+		paths[p] = true
+	}
+	sorted := make([]string, 0, len(paths))
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	sort.Strings(sorted)
+
+	for _, p := range sorted {
+		o, inOld := old[p]
+		n, inNew := new[p]
+
+		fd := PanoramaFileDiff{Path: p}
+		switch {
+		case !inOld:
+			fd.Kind, fd.Status = n.Kind, "added"
+		case !inNew:
+			fd.Kind, fd.Status = o.Kind, "removed"
+		case o.Text != n.Text:
+			fd.Kind, fd.Status = n.Kind, "modified"
+		default:
+			continue
+		}
+
+		if strings.Count(o.Text, "\n")+strings.Count(n.Text, "\n") <= maxPanoramaDiffLines {
+			fd.UnifiedDiff = GenerateUnifiedDiff(o.Text, n.Text, "a/"+p, "b/"+p)
+		}
+		result.Files = append(result.Files, fd)
+	}
+
+	oldSyms := collectSymbols(old)
+	newSyms := collectSymbols(new)
+	result.NewPanels, _ = compareStrings(oldSyms.Panels, newSyms.Panels)
+	result.NewIDs, result.RemovedIDs = compareStrings(oldSyms.IDs, newSyms.IDs)
+	result.NewEvents, result.RemovedEvents = compareStrings(oldSyms.Events, newSyms.Events)
+	sort.Strings(result.NewPanels)
+	sort.Strings(result.NewIDs)
+	sort.Strings(result.RemovedIDs)
+	sort.Strings(result.NewEvents)
+	sort.Strings(result.RemovedEvents)
+
+	return result
+}
+
+func collectSymbols(files map[string]panorama.File) panorama.Symbols {
+	var all panorama.Symbols
+	for _, f := range files {
+		s := panorama.ExtractSymbols(f.Kind, f.Text)
+		all.Panels = append(all.Panels, s.Panels...)
+		all.IDs = append(all.IDs, s.IDs...)
+		all.Events = append(all.Events, s.Events...)
+	}
+	return all
+}
+
+// EnhanceWithPanorama attaches the UI diff and adds a summary to the analysis.
+func (t *Tracker) EnhanceWithPanorama(result *DiffResult, pd *PanoramaDiff) {
+	if pd.IsEmpty() {
+		return
+	}
+	result.Panorama = pd
+	addPanoramaEvidence(result, pd)
+	result.rank()
+	result.Analysis += "\n" + pd.Markdown(20)
+}
+
+func (d *PanoramaDiff) Markdown(limit int) string {
+	if d.IsEmpty() {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("## Panorama UI Changes\n\n")
+	for i, f := range d.Files {
+		if i >= limit {
+			sb.WriteString(fmt.Sprintf("... and %d more files\n", len(d.Files)-limit))
+			break
+		}
+		sb.WriteString(fmt.Sprintf("- `%s` (%s, %s)\n", f.Path, f.Kind, f.Status))
+	}
+
+	writeList := func(title string, items []string) {
+		if len(items) == 0 {
+			return
+		}
+		sb.WriteString("\n**" + title + ":** ")
+		if len(items) > limit {
+			sb.WriteString("`" + strings.Join(items[:limit], "`, `") + fmt.Sprintf("` and %d more\n", len(items)-limit))
+		} else {
+			sb.WriteString("`" + strings.Join(items, "`, `") + "`\n")
+		}
+	}
+	writeList("New Panels", d.NewPanels)
+	writeList("New IDs", d.NewIDs)
+	writeList("New Events", d.NewEvents)
+	writeList("Removed Events", d.RemovedEvents)
+
+	return sb.String()
+}
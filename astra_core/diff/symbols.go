@@ -0,0 +1,159 @@
+package diff
+
+import (
+	"astra_core/extractor"
+	"fmt"
+	"strings"
+)
+
+// EnhanceWithSymbols records a per-file export/import diff.
+func (t *Tracker) EnhanceWithSymbols(result *DiffResult, sd extractor.SymbolDiff) {
+	if sd.IsEmpty() {
+		return
+	}
+	result.SymbolDiffs = append(result.SymbolDiffs, sd)
+	addSymbolEvidence(result, sd)
+	result.rank()
+	result.Analysis += "\n" + symbolDiffMarkdown(sd, 20)
+}
+
+func symbolDiffMarkdown(sd extractor.SymbolDiff, limit int) string {
+	var sb strings.Builder
+	sb.WriteString("## Symbol Changes: " + sd.File + "\n\n")
+
+	writeSymbols := func(title, prefix string, syms []extractor.Symbol) {
+		if len(syms) == 0 {
+			return
+		}
+		sb.WriteString(fmt.Sprintf("**%s (%d):**\n", title, len(syms)))
+		for i, s := range syms {
+			if i >= limit {
+				sb.WriteString(fmt.Sprintf("... and %d more\n", len(syms)-limit))
+				break
+			}
+			name := s.Name
+			if s.Demangled != "" {
+				name = s.Demangled
+			}
+			if s.Library != "" {
+				name = s.Library + "!" + name
+			}
+			sb.WriteString(prefix + " `" + name + "`\n")
+		}
+	}
+
+	writeSymbols("Added Exports", "+", sd.AddedExports)
+	writeSymbols("Removed Exports", "-", sd.RemovedExports)
+	writeSymbols("Added Imports", "+", sd.AddedImports)
+	writeSymbols("Removed Imports", "-", sd.RemovedImports)
+	if len(sd.AddedLibraries) > 0 {
+		sb.WriteString("**New Libraries:** `" + strings.Join(sd.AddedLibraries, "`, `") + "`\n")
+	}
+	if len(sd.RemovedLibraries) > 0 {
+		sb.WriteString("**Removed Libraries:** `" + strings.Join(sd.RemovedLibraries, "`, `") + "`\n")
+	}
+	return sb.String()
+}
+
+// EnhanceWithClasses records a per-file RTTI class diff.
+func (t *Tracker) EnhanceWithClasses(result *DiffResult, cd extractor.ClassDiff) {
+	if cd.IsEmpty() {
+		return
+	}
+	result.ClassDiffs = append(result.ClassDiffs, cd)
+	addClassEvidence(result, cd)
+	result.rank()
+	result.Analysis += "\n" + classDiffMarkdown(cd, 20)
+}
+
+func classDiffMarkdown(cd extractor.ClassDiff, limit int) string {
+	var sb strings.Builder
+	sb.WriteString("## Class Changes: " + cd.File + "\n\n")
+
+	writeClasses := func(title, prefix string, classes []extractor.ClassInfo) {
+		if len(classes) == 0 {
+			return
+		}
+		sb.WriteString(fmt.Sprintf("**%s (%d):**\n", title, len(classes)))
+		for i, c := range classes {
+			if i >= limit {
+				sb.WriteString(fmt.Sprintf("... and %d more\n", len(classes)-limit))
+				break
+			}
+			sb.WriteString(prefix + " `" + c.String() + "`\n")
+		}
+	}
+
+	writeClasses("New Classes", "+", cd.Added)
+	writeClasses("Removed Classes", "-", cd.Removed)
+	for i, c := range cd.Rebased {
+		if i >= limit {
+			sb.WriteString(fmt.Sprintf("... and %d more rebased\n", len(cd.Rebased)-limit))
+			break
+		}
+		sb.WriteString(fmt.Sprintf("~ `%s`: %s → %s\n", c.Name, strings.Join(c.OldBases, ", "), strings.Join(c.NewBases, ", ")))
+	}
+	return sb.String()
+}
+
+// EnhanceWithFunctions records a per-file function-level code diff.
+func (t *Tracker) EnhanceWithFunctions(result *DiffResult, fd extractor.FunctionDiff) {
+	if fd.IsEmpty() {
+		return
+	}
+	result.FunctionDiffs = append(result.FunctionDiffs, fd)
+	addFunctionEvidence(result, fd)
+	result.rank()
+	result.Analysis += "\n" + functionDiffMarkdown(fd, 20)
+}
+
+// ChangedFunctions counts the changed functions across all binaries.
+func (r *DiffResult) ChangedFunctions() int {
+	n := 0
+	for _, fd := range r.FunctionDiffs {
+		n += fd.ChangedCount
+	}
+	return n
+}
+
+func functionDiffMarkdown(fd extractor.FunctionDiff, limit int) string {
+	var sb strings.Builder
+	sb.WriteString("## Function Changes: " + fd.File + "\n\n")
+	sb.WriteString(fd.Summary() + "\n\n")
+
+	writeFunctions := func(title, prefix string, fns []extractor.Function, total int) {
+		if total == 0 {
+			return
+		}
+		sb.WriteString(fmt.Sprintf("**%s (%d):**\n", title, total))
+		for i, fn := range fns {
+			if i >= limit {
+				break
+			}
+			sb.WriteString(fmt.Sprintf("%s `%s` (%d bytes)\n", prefix, fn.DisplayName(), fn.Size))
+		}
+		if total > min(len(fns), limit) {
+			sb.WriteString(fmt.Sprintf("... and %d more\n", total-min(len(fns), limit)))
+		}
+	}
+
+	writeFunctions("Added Functions", "+", fd.Added, fd.AddedCount)
+	writeFunctions("Removed Functions", "-", fd.Removed, fd.RemovedCount)
+	if fd.ChangedCount > 0 {
+		sb.WriteString(fmt.Sprintf("**Changed Functions (%d):**\n", fd.ChangedCount))
+		for i, c := range fd.Changed {
+			if i >= limit {
+				break
+			}
+			name := extractor.Function{Name: c.Name}.DisplayName()
+			if c.OldName != "" {
+				name = c.OldName + " → " + name
+			}
+			sb.WriteString(fmt.Sprintf("~ `%s` %d → %d bytes (%+d)\n", name, c.OldSize, c.NewSize, c.SizeDelta))
+		}
+		if shown := min(len(fd.Changed), limit); fd.ChangedCount > shown {
+			sb.WriteString(fmt.Sprintf("... and %d more\n", fd.ChangedCount-shown))
+		}
+	}
+	return sb.String()
+}
@@ -1,26 +1,45 @@
 package diff
 
 import (
+	"astra_core/extractor"
+	"astra_core/items"
+	"astra_core/localization"
+	"astra_core/rules"
 	"astra_core/steamcmd"
+	"fmt"
+	"sort"
 	"strings"
 )
 
 type DiffResult struct {
-	NewVersion         string          `json:"new_version"`
-	OldVersion         string          `json:"old_version"`
-	ChangedFiles       []string        `json:"changed_files"`
-	NewFiles           []string        `json:"new_files"`
-	RemovedFiles       []string        `json:"removed_files"`
-	ChangedDepots      []DepotChange   `json:"changed_depots"`
-	RawDiff            string          `json:"raw_diff,omitempty"`
-	Type               UpdateType      `json:"type"`
-	TypeReason         string          `json:"type_reason,omitempty"`
-	NewProtobufs       []string        `json:"new_protobufs,omitempty"`
-	RemovedProtobufs   []string        `json:"removed_protobufs,omitempty"`
-	NewStrings         []string        `json:"new_strings,omitempty"` // Deprecated in favor of StringBlocks
-	StringBlocks       []StringBlock   `json:"string_blocks,omitempty"`
-	CategorizedStrings []CategoryBlock `json:"categorized_strings,omitempty"`
-	Analysis           string          `json:"analysis,omitempty"`
+	NewVersion         string                         `json:"new_version"`
+	OldVersion         string                         `json:"old_version"`
+	ChangedFiles       []string                       `json:"changed_files"`
+	NewFiles           []string                       `json:"new_files"`
+	RemovedFiles       []string                       `json:"removed_files"`
+	ChangedDepots      []DepotChange                  `json:"changed_depots"`
+	RawDiff            string                         `json:"raw_diff,omitempty"`
+	Type               UpdateType                     `json:"type"`
+	TypeReason         string                         `json:"type_reason,omitempty"`
+	NewProtobufs       []string                       `json:"new_protobufs,omitempty"`
+	RemovedProtobufs   []string                       `json:"removed_protobufs,omitempty"`
+	NewStrings         []string                       `json:"new_strings,omitempty"` // Deprecated in favor of StringBlocks
+	RemovedStrings     []string                       `json:"removed_strings,omitempty"`
+	ModifiedStrings    []extractor.StringModification `json:"modified_strings,omitempty"`
+	StringChanges      []FileStringChanges            `json:"string_changes,omitempty"`
+	StringBlocks       []StringBlock                  `json:"string_blocks,omitempty"`
+	CategorizedStrings []CategoryBlock                `json:"categorized_strings,omitempty"`
+	CategorizedRemoved []CategoryBlock                `json:"categorized_removed,omitempty"`
+	Analysis           string                         `json:"analysis,omitempty"`
+	ItemSchema         *items.SchemaDiff              `json:"item_schema,omitempty"`
+	Localization       *localization.Diff             `json:"localization,omitempty"`
+	Panorama           *PanoramaDiff                  `json:"panorama,omitempty"`
+	SymbolDiffs        []extractor.SymbolDiff         `json:"symbol_diffs,omitempty"`
+	ClassDiffs         []extractor.ClassDiff          `json:"class_diffs,omitempty"`
+	FunctionDiffs      []extractor.FunctionDiff       `json:"function_diffs,omitempty"`
+	Builds             []extractor.BuildInfoChange    `json:"builds,omitempty"`
+	Classification     Classification                 `json:"classification,omitempty"`
+	Suppressed         Suppression                    `json:"suppressed,omitempty"`
 }
 
 type StringBlock struct {
@@ -29,6 +48,64 @@ type StringBlock struct {
 	Category   string   `json:"category,omitempty"` // Optional: e.g. "server.dll" could be a category itself
 }
 
+// FileStringChanges is the string diff of one binary between the old and new build.
+type FileStringChanges struct {
+	File     string                         `json:"file"`
+	Added    []string                       `json:"added,omitempty"`
+	Removed  []string                       `json:"removed,omitempty"`
+	Modified []extractor.StringModification `json:"modified,omitempty"`
+}
+
+// Suppression counts the strings dropped as noise, by reason (see
+// extractor.FilterNoise).
+type Suppression map[string]int
+
+func (s *Suppression) Merge(counts map[string]int) {
+	for reason, n := range counts {
+		if n == 0 {
+			continue
+		}
+		if *s == nil {
+			*s = make(Suppression)
+		}
+		(*s)[reason] += n
+	}
+}
+
+func (s Suppression) Total() int {
+	total := 0
+	for _, n := range s {
+		total += n
+	}
+	return total
+}
+
+// Summary lists the reasons by count, e.g. "120 gibberish, 4 volatile".
+func (s Suppression) Summary() string {
+	reasons := make([]string, 0, len(s))
+	for reason := range s {
+		reasons = append(reasons, reason)
+	}
+	sort.Slice(reasons, func(i, j int) bool {
+		if s[reasons[i]] != s[reasons[j]] {
+			return s[reasons[i]] > s[reasons[j]]
+		}
+		return reasons[i] < reasons[j]
+	})
+	parts := make([]string, len(reasons))
+	for i, reason := range reasons {
+		parts[i] = fmt.Sprintf("%d %s", s[reason], reason)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (s Suppression) Markdown() string {
+	if s.Total() == 0 {
+		return ""
+	}
+	return fmt.Sprintf("## Suppressed Noise\n\n%d strings: %s\n", s.Total(), s.Summary())
+}
+
 type DepotChange struct {
 	ID     string `json:"id"`
 	OldGID string `json:"old_gid"`
@@ -52,12 +129,10 @@ const (
 	UpdateTypeProtobuf     UpdateType = "Protobuf/Networking"
 )
 
-type Tracker struct {
-	client *steamcmd.Client
-}
+type Tracker struct{}
 
-func NewTracker(client *steamcmd.Client) *Tracker {
-	return &Tracker{client: client}
+func NewTracker() *Tracker {
+	return &Tracker{}
 }
 
 func (t *Tracker) ProcessUpdate(oldInfo, newInfo *steamcmd.AppInfo) *DiffResult {
@@ -89,74 +164,101 @@ func (t *Tracker) ProcessUpdate(oldInfo, newInfo *steamcmd.AppInfo) *DiffResult
 		}
 	}
 
-	result.Type, result.TypeReason = classifyUpdateByDepots(result.ChangedDepots)
+	addDepotEvidence(result)
+	addAppInfoEvidence(result, oldInfo, newInfo)
+	result.rank()
 
 	return result
 }
 
-func (t *Tracker) EnhanceWithStringAnalysis(result *DiffResult, newStrings, oldStrings []string) {
-	added, removed := compareStrings(oldStrings, newStrings)
-
-	result.NewStrings = filterTopStrings(added, 5000)
+// EnhanceWithStringAnalysis records the strings added to, removed from and
+// modified in one file, as computed by extractor.CompareStringSets and
+// extractor.PairModifiedStrings.
+func (t *Tracker) EnhanceWithStringAnalysis(result *DiffResult, file string, added, removed []string, modified []extractor.StringModification) {
+	sort.Strings(added)
+	sort.Strings(removed)
+	if len(added) == 0 && len(removed) == 0 && len(modified) == 0 {
+		return
+	}
 
-	newType, reason := classifyByStrings(added, removed)
-	if newType != UpdateTypeUnknown {
-		result.Type = newType
-		result.TypeReason = reason
+	result.StringChanges = append(result.StringChanges, FileStringChanges{
+		File:     file,
+		Added:    filterTopStrings(added, 5000),
+		Removed:  filterTopStrings(removed, 5000),
+		Modified: modified,
+	})
+	result.RemovedStrings = filterTopStrings(append(result.RemovedStrings, removed...), 5000)
+	result.ModifiedStrings = append(result.ModifiedStrings, modified...)
+
+	// A renamed string says as much about the update as a new one.
+	evidence := append([]string{}, added...)
+	for _, m := range modified {
+		evidence = append(evidence, m.New)
 	}
+	addStringEvidence(result, evidence)
+	result.rank()
 
-	result.Analysis = generateAnalysis(added, removed, result.Type)
+	result.Analysis += "\n" + stringChangesMarkdown(file, added, removed, modified)
 }
 
-func classifyUpdateByDepots(depots []DepotChange) (UpdateType, string) {
-	for _, depot := range depots {
-		switch depot.ID {
-		case "2347779":
-			return UpdateTypeServer, "CS2 Dedicated Server depot changed"
-		case "731":
-			return UpdateTypePatch, "Public depot changed"
-		case "2347770":
-			return UpdateTypePatch, "CS2 Content depot changed"
-		}
-	}
-	return UpdateTypeUnknown, ""
+// EnhanceWithSuppression adds one file's noise counts to the result.
+func (t *Tracker) EnhanceWithSuppression(result *DiffResult, counts Suppression) {
+	result.Suppressed.Merge(counts)
 }
 
-func classifyByStrings(added, removed []string) (UpdateType, string) {
-	var weaponCount, protoCount, balanceCount, cosmeticCount int
-
-	for _, s := range added {
-		lower := strings.ToLower(s)
-
-		if strings.HasPrefix(lower, "cmsg") || strings.Contains(lower, "proto") {
-			protoCount++
-		}
-		if strings.HasPrefix(lower, "weapon_") {
-			weaponCount++
-		}
-		if strings.HasPrefix(lower, "item_") || strings.Contains(lower, "cosmetic") {
-			cosmeticCount++
-		}
-		if strings.Contains(lower, "damage") || strings.Contains(lower, "armor") ||
-			strings.Contains(lower, "speed") || strings.Contains(lower, "accuracy") {
-			balanceCount++
-		}
+// EnhanceWithProtobufs records the protobuf messages and enums added to and
+// removed from one file, as computed by extractor.CompareProtobufs.
+func (t *Tracker) EnhanceWithProtobufs(result *DiffResult, file string, added, removed []extractor.ProtobufMatch) {
+	if len(added) == 0 && len(removed) == 0 {
+		return
 	}
+	sort.Slice(added, func(i, j int) bool { return added[i].Name < added[j].Name })
+	sort.Slice(removed, func(i, j int) bool { return removed[i].Name < removed[j].Name })
 
-	if protoCount > 5 {
-		return UpdateTypeProtobuf, "Multiple new protobuf definitions detected"
+	for _, p := range added {
+		result.NewProtobufs = append(result.NewProtobufs, p.Name)
 	}
-	if weaponCount > 3 {
-		return UpdateTypeBalance, "Multiple weapon-related strings detected"
+	for _, p := range removed {
+		result.RemovedProtobufs = append(result.RemovedProtobufs, p.Name)
 	}
-	if cosmeticCount > 5 {
-		return UpdateTypeCosmetic, "Multiple cosmetic-related strings detected"
+
+	addProtobufEvidence(result, file, added, removed)
+	result.rank()
+}
+
+// EnhanceWithItemSchema attaches the items_game.txt diff. Schema definitions are
+// authoritative for items, so they carry the heaviest weights in the classification.
+func (t *Tracker) EnhanceWithItemSchema(result *DiffResult, schemaDiff *items.SchemaDiff) {
+	if schemaDiff.IsEmpty() {
+		return
 	}
-	if balanceCount > 5 {
-		return UpdateTypeBalance, "Multiple balance-related strings detected"
+	result.ItemSchema = schemaDiff
+
+	addSchemaEvidence(result, schemaDiff)
+	result.rank()
+
+	result.Analysis += "\n" + schemaDiff.Markdown(20)
+}
+
+// EnhanceWithLocalization attaches the token diff and counts changed tokens of
+// the primary language towards Localization.
+func (t *Tracker) EnhanceWithLocalization(result *DiffResult, locDiff *localization.Diff) {
+	if locDiff.IsEmpty() {
+		return
 	}
+	result.Localization = locDiff
 
-	return UpdateTypeUnknown, ""
+	addLocalizationEvidence(result, locDiff)
+	result.rank()
+
+	result.Analysis += "\n" + locDiff.Markdown(20)
+}
+
+// EnhanceWithFileChanges weighs the depot file lists (maps, localization,
+// Panorama, binaries) into the classification.
+func (t *Tracker) EnhanceWithFileChanges(result *DiffResult) {
+	addFileEvidence(result)
+	result.rank()
 }
 
 func compareStrings(old, new []string) (added, removed []string) {
@@ -191,20 +293,38 @@ func filterTopStrings(strings []string, limit int) []string {
 	return strings[:limit]
 }
 
-func generateAnalysis(added, removed []string, updateType UpdateType) string {
+func stringChangesMarkdown(file string, added, removed []string, modified []extractor.StringModification) string {
 	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("## String Changes: %s\n\n", file))
+	sb.WriteString(fmt.Sprintf("+%d / -%d / ~%d strings\n\n", len(added), len(removed), len(modified)))
 
-	sb.WriteString("## Update Analysis\n\n")
-	sb.WriteString("**Detected Type:** " + string(updateType) + "\n\n")
-
-	if len(added) > 0 {
-		sb.WriteString("**Notable Additions:**\n")
+	writeNotable := func(title, prefix string, strs []string) {
 		count := 0
-		for _, s := range added {
-			if isNotableString(s) && count < 20 {
-				sb.WriteString("- `" + s + "`\n")
-				count++
+		for _, s := range strs {
+			if count >= 20 {
+				break
 			}
+			if !isNotableString(s) {
+				continue
+			}
+			if count == 0 {
+				sb.WriteString("**" + title + ":**\n")
+			}
+			sb.WriteString(prefix + " `" + s + "`\n")
+			count++
+		}
+	}
+	writeNotable("Notable Additions", "+", added)
+	writeNotable("Notable Removals", "-", removed)
+
+	if len(modified) > 0 {
+		sb.WriteString("**Modified:**\n")
+		for i, m := range modified {
+			if i >= 20 {
+				sb.WriteString(fmt.Sprintf("... and %d more\n", len(modified)-20))
+				break
+			}
+			sb.WriteString(fmt.Sprintf("~ `%s` → `%s`\n", m.Old, m.New))
 		}
 	}
 
@@ -212,15 +332,7 @@ func generateAnalysis(added, removed []string, updateType UpdateType) string {
 }
 
 func isNotableString(s string) bool {
-	lower := strings.ToLower(s)
-	notable := []string{"weapon_", "item_", "cmsg", "ability_", "hero_", "npc_", "k_e", "sv_", "mp_", "cl_"}
-
-	for _, prefix := range notable {
-		if strings.HasPrefix(lower, prefix) {
-			return true
-		}
-	}
-	return false
+	return rules.Active().IsNotable(s)
 }
 
 func getDepotName(depotID string) string {
@@ -254,59 +366,24 @@ type CategoryBlock struct {
 	Strings  []string `json:"strings"`
 }
 
+// CategorizeStrings groups strings by the category of the first matching rule,
+// in the category order of the active rule file.
 func CategorizeStrings(strList []string) []CategoryBlock {
-	categories := map[string][]string{
-		"weapons":  {},
-		"maps":     {},
-		"items":    {},
-		"ui":       {},
-		"network":  {},
-		"security": {},
-		"audio":    {},
-		"other":    {},
-	}
+	engine := rules.Active()
 
+	categories := make(map[string][]string)
 	for _, s := range strList {
-		switch {
-		case containsAny(s, "weapon_", "ak47", "m4a1", "awp", "knife", "gun", "ammo"):
-			categories["weapons"] = append(categories["weapons"], s)
-		case containsAny(s, "map_", "de_", "cs_", "ar_", "level", "spawn"):
-			categories["maps"] = append(categories["maps"], s)
-		case containsAny(s, "item_", "skin", "case", "sticker", "agent", "glove"):
-			categories["items"] = append(categories["items"], s)
-		case containsAny(s, "ui_", "hud", "menu", "button", "panel", "label"):
-			categories["ui"] = append(categories["ui"], s)
-		case containsAny(s, "net_", "server", "client", "packet", "proto", "msg"):
-			categories["network"] = append(categories["network"], s)
-		case containsAny(s, "vac", "cheat", "ban", "trust", "secure", "rsa", "key", "cert"):
-			categories["security"] = append(categories["security"], s)
-		case containsAny(s, "sound", "audio", "music", "sfx", "voice"):
-			categories["audio"] = append(categories["audio"], s)
-		default:
-			categories["other"] = append(categories["other"], s)
-		}
+		cat := engine.Category(s)
+		categories[cat] = append(categories[cat], s)
 	}
 
-	icons := map[string]string{
-		"weapons":  "",
-		"maps":     "",
-		"items":    "",
-		"ui":       "",
-		"network":  "",
-		"security": "",
-		"audio":    "",
-		"other":    "",
-	}
-
-	order := []string{"weapons", "maps", "items", "network", "security", "ui", "audio", "other"}
-
 	blocks := make([]CategoryBlock, 0)
-	for _, cat := range order {
-		strs := categories[cat]
+	for _, cat := range engine.Categories() {
+		strs := categories[cat.Name]
 		if len(strs) > 0 {
 			blocks = append(blocks, CategoryBlock{
-				Category: cat,
-				Icon:     icons[cat],
+				Category: cat.Name,
+				Icon:     cat.Icon,
 				Count:    len(strs),
 				Strings:  strs,
 			})
@@ -315,13 +392,3 @@ func CategorizeStrings(strList []string) []CategoryBlock {
 
 	return blocks
 }
-
-func containsAny(s string, patterns ...string) bool {
-	lower := strings.ToLower(s)
-	for _, p := range patterns {
-		if strings.Contains(lower, p) {
-			return true
-		}
-	}
-	return false
-}
@@ -0,0 +1,423 @@
+package extractor
+
+import (
+	"crypto/sha256"
+	"debug/elf"
+	"debug/pe"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+const maxBuildStrings = 20
+
+// BuildInfo is the version and build metadata of one binary.
+type BuildInfo struct {
+	Format         string            `json:"format"`                    // pe, elf
+	Timestamp      int64             `json:"timestamp,omitempty"`       // PE TimeDateStamp, Unix seconds
+	FileVersion    string            `json:"file_version,omitempty"`    // VS_FIXEDFILEINFO
+	ProductVersion string            `json:"product_version,omitempty"` // VS_FIXEDFILEINFO
+	VersionStrings map[string]string `json:"version_strings,omitempty"` // StringFileInfo entries
+	BuildID        string            `json:"build_id,omitempty"`        // ELF NT_GNU_BUILD_ID
+	BuildStrings   []string          `json:"build_strings,omitempty"`   // embedded dates and version lines
+	Size           int64             `json:"size"`
+	FileHash       string            `json:"file_hash"`           // sha256 of the whole file
+	CodeHash       string            `json:"code_hash,omitempty"` // sha256 of the executable sections
+}
+
+// CompiledAt returns the PE link time, if the binary has one.
+func (b *BuildInfo) CompiledAt() (time.Time, bool) {
+	if b == nil || b.Timestamp == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(b.Timestamp, 0).UTC(), true
+}
+
+// Version is the file version, falling back to the product version.
+func (b *BuildInfo) Version() string {
+	if b == nil {
+		return ""
+	}
+	if b.FileVersion != "" {
+		return b.FileVersion
+	}
+	return b.ProductVersion
+}
+
+var buildStringPatterns = []*regexp.Regexp{
+	// __DATE__ and __TIME__
+	regexp.MustCompile(`^(Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec) [ 0-3][0-9] [0-9]{4}( [0-9]{2}:[0-9]{2}:[0-9]{2})?$`),
+	regexp.MustCompile(`^[0-9]{2}:[0-9]{2}:[0-9]{2}$`),
+	// "Build Date: Oct 18 2026", "PatchVersion=1.40.2.1", "server version 14090"
+	regexp.MustCompile(`(?i)^.{0,40}\b(build|patch|product|server|client|engine|protocol)[ _]?(date|time|version|number|label|id)\s*[:=]?\s*(v?[0-9]|(Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec) )`),
+	regexp.MustCompile(`(?i)^.{0,40}\bcompiled\b.{0,40}[0-9]{4}`),
+}
+
+// ExtractBuildInfo reads the version resources or build-id notes of a binary,
+// hashes it and collects embedded build strings.
+func ExtractBuildInfo(filePath string) (*BuildInfo, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info := &BuildInfo{}
+	hash := sha256.New()
+	n, err := scanBuildStrings(io.TeeReader(f, hash), info)
+	if err != nil {
+		return nil, err
+	}
+	info.Size = n
+	info.FileHash = hex.EncodeToString(hash.Sum(nil))
+
+	magic := make([]byte, 4)
+	if _, err := f.ReadAt(magic, 0); err != nil {
+		return nil, err
+	}
+	switch {
+	case string(magic) == elf.ELFMAG:
+		ef, err := elf.NewFile(f)
+		if err != nil {
+			return nil, err
+		}
+		defer ef.Close()
+		elfBuildInfo(ef, info)
+	case magic[0] == 'M' && magic[1] == 'Z':
+		pf, err := pe.NewFile(f)
+		if err != nil {
+			return nil, err
+		}
+		defer pf.Close()
+		peBuildInfo(pf, info)
+	default:
+		return nil, fmt.Errorf("unsupported binary format")
+	}
+	return info, nil
+}
+
+// scanBuildStrings streams r like ExtractAndFilterStrings and keeps the
+// printable strings that look like build dates or version lines.
+func scanBuildStrings(r io.Reader, info *BuildInfo) (int64, error) {
+	seen := make(map[string]bool)
+	buf := make([]byte, bufferSize)
+	var current []byte
+	var total int64
+
+	flush := func() {
+		if len(current) >= MinStringLength && len(current) <= 100 && len(info.BuildStrings) < maxBuildStrings {
+			s := string(current)
+			if !seen[s] && isBuildString(s) {
+				seen[s] = true
+				info.BuildStrings = append(info.BuildStrings, s)
+			}
+		}
+		current = current[:0]
+	}
+
+	for {
+		n, err := r.Read(buf)
+		total += int64(n)
+		for _, b := range buf[:n] {
+			if isPrintable(b) {
+				current = append(current, b)
+			} else {
+				flush()
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+	flush()
+	return total, nil
+}
+
+func isBuildString(s string) bool {
+	for _, re := range buildStringPatterns {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func peBuildInfo(f *pe.File, info *BuildInfo) {
+	info.Format = "pe"
+	info.Timestamp = int64(f.FileHeader.TimeDateStamp)
+
+	hash := sha256.New()
+	for _, s := range f.Sections {
+		if s.Characteristics&pe.IMAGE_SCN_MEM_EXECUTE == 0 {
+			continue
+		}
+		io.Copy(hash, s.Open())
+	}
+	info.CodeHash = hex.EncodeToString(hash.Sum(nil))
+
+	if data := peVersionResource(f); data != nil {
+		parseVersionInfo(data, info)
+	}
+}
+
+// peVersionResource returns the first RT_VERSION resource of the image.
+func peVersionResource(f *pe.File) []byte {
+	var dir pe.DataDirectory
+	switch oh := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		if oh.NumberOfRvaAndSizes > pe.IMAGE_DIRECTORY_ENTRY_RESOURCE {
+			dir = oh.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_RESOURCE]
+		}
+	case *pe.OptionalHeader64:
+		if oh.NumberOfRvaAndSizes > pe.IMAGE_DIRECTORY_ENTRY_RESOURCE {
+			dir = oh.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_RESOURCE]
+		}
+	}
+	if dir.VirtualAddress == 0 || dir.Size == 0 {
+		return nil
+	}
+	rsrc, err := readRVA(f, dir.VirtualAddress, dir.Size)
+	if err != nil {
+		return nil
+	}
+
+	const rtVersion = 16
+	// Type -> name -> language -> IMAGE_RESOURCE_DATA_ENTRY.
+	offset, ok := resourceEntry(rsrc, 0, rtVersion)
+	for level := 0; ok && level < 2; level++ {
+		offset, ok = resourceEntry(rsrc, offset, -1)
+	}
+	if !ok || int(offset)+16 > len(rsrc) {
+		return nil
+	}
+	dataRVA := binary.LittleEndian.Uint32(rsrc[offset:])
+	size := binary.LittleEndian.Uint32(rsrc[offset+4:])
+	if size > 1<<20 {
+		return nil
+	}
+	data, err := readRVA(f, dataRVA, size)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// resourceEntry finds the entry with the given integer id (or the first entry
+// when id is -1) in the IMAGE_RESOURCE_DIRECTORY at dirOffset and returns the
+// offset it points to, with the subdirectory flag stripped.
+func resourceEntry(rsrc []byte, dirOffset uint32, id int) (uint32, bool) {
+	if int(dirOffset)+16 > len(rsrc) {
+		return 0, false
+	}
+	named := binary.LittleEndian.Uint16(rsrc[dirOffset+12:])
+	ids := binary.LittleEndian.Uint16(rsrc[dirOffset+14:])
+	for i := 0; i < int(named)+int(ids); i++ {
+		e := int(dirOffset) + 16 + i*8
+		if e+8 > len(rsrc) {
+			return 0, false
+		}
+		name := binary.LittleEndian.Uint32(rsrc[e:])
+		target := binary.LittleEndian.Uint32(rsrc[e+4:])
+		if id == -1 || (name&0x80000000 == 0 && int(name) == id) {
+			return target &^ 0x80000000, true
+		}
+	}
+	return 0, false
+}
+
+// parseVersionInfo reads VS_VERSIONINFO: the fixed file info and the
+// StringFileInfo key/value pairs.
+func parseVersionInfo(data []byte, info *BuildInfo) {
+	key, value, children, ok := versionNode(data)
+	if !ok || key != "VS_VERSION_INFO" {
+		return
+	}
+	if len(value) >= 52 && binary.LittleEndian.Uint32(value) == 0xFEEF04BD {
+		info.FileVersion = fixedVersion(value[8:], value[12:])
+		info.ProductVersion = fixedVersion(value[16:], value[20:])
+	}
+
+	eachVersionChild(children, func(node []byte) {
+		key, _, tables, ok := versionNode(node)
+		if !ok || key != "StringFileInfo" {
+			return
+		}
+		eachVersionChild(tables, func(table []byte) {
+			_, _, strs, ok := versionNode(table)
+			if !ok {
+				return
+			}
+			eachVersionChild(strs, func(str []byte) {
+				k, v, _, ok := versionNode(str)
+				if !ok || k == "" {
+					return
+				}
+				if info.VersionStrings == nil {
+					info.VersionStrings = make(map[string]string)
+				}
+				info.VersionStrings[k] = strings.TrimRight(decodeUTF16(v), "\x00 ")
+			})
+		})
+	})
+}
+
+func fixedVersion(ms, ls []byte) string {
+	hi := binary.LittleEndian.Uint32(ms)
+	lo := binary.LittleEndian.Uint32(ls)
+	return fmt.Sprintf("%d.%d.%d.%d", hi>>16, hi&0xffff, lo>>16, lo&0xffff)
+}
+
+// versionNode splits one version resource block (wLength, wValueLength, wType,
+// szKey, padding, Value, padding, Children) into its parts.
+func versionNode(b []byte) (key string, value, children []byte, ok bool) {
+	if len(b) < 6 {
+		return "", nil, nil, false
+	}
+	length := int(binary.LittleEndian.Uint16(b))
+	valueLength := int(binary.LittleEndian.Uint16(b[2:]))
+	isText := binary.LittleEndian.Uint16(b[4:]) == 1
+	if length < 6 || length > len(b) {
+		return "", nil, nil, false
+	}
+	b = b[:length]
+
+	pos := 6
+	var name []uint16
+	for pos+2 <= len(b) {
+		c := binary.LittleEndian.Uint16(b[pos:])
+		pos += 2
+		if c == 0 {
+			break
+		}
+		name = append(name, c)
+	}
+	pos = align4(pos)
+
+	// Text values are measured in UTF-16 code units.
+	if isText {
+		valueLength *= 2
+	}
+	end := min(pos+valueLength, len(b))
+	if pos < end {
+		value = b[pos:end]
+	}
+	pos = align4(end)
+	if pos < len(b) {
+		children = b[pos:]
+	}
+	return string(utf16.Decode(name)), value, children, true
+}
+
+func eachVersionChild(b []byte, fn func([]byte)) {
+	for len(b) >= 6 {
+		length := int(binary.LittleEndian.Uint16(b))
+		if length < 6 || length > len(b) {
+			return
+		}
+		fn(b[:length])
+		b = b[min(align4(length), len(b)):]
+	}
+}
+
+func align4(n int) int {
+	return (n + 3) &^ 3
+}
+
+func decodeUTF16(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[i*2:])
+	}
+	return string(utf16.Decode(u))
+}
+
+func elfBuildInfo(f *elf.File, info *BuildInfo) {
+	info.Format = "elf"
+
+	hash := sha256.New()
+	for _, s := range f.Sections {
+		if s.Flags&elf.SHF_EXECINSTR == 0 || s.Type == elf.SHT_NOBITS {
+			continue
+		}
+		io.Copy(hash, s.Open())
+	}
+	info.CodeHash = hex.EncodeToString(hash.Sum(nil))
+
+	for _, p := range f.Progs {
+		if p.Type != elf.PT_NOTE {
+			continue
+		}
+		data, err := io.ReadAll(p.Open())
+		if err != nil {
+			continue
+		}
+		if id := gnuBuildID(data, f.ByteOrder); id != "" {
+			info.BuildID = id
+			return
+		}
+	}
+}
+
+// gnuBuildID walks the notes of a PT_NOTE segment for NT_GNU_BUILD_ID.
+func gnuBuildID(notes []byte, order binary.ByteOrder) string {
+	const ntGNUBuildID = 3
+	for len(notes) >= 12 {
+		nameSize := int(order.Uint32(notes))
+		descSize := int(order.Uint32(notes[4:]))
+		noteType := order.Uint32(notes[8:])
+		nameEnd := 12 + align4(nameSize)
+		descEnd := nameEnd + align4(descSize)
+		if nameSize < 0 || descSize < 0 || descEnd > len(notes) || 12+nameSize > len(notes) {
+			return ""
+		}
+		name := strings.TrimRight(string(notes[12:12+nameSize]), "\x00")
+		if name == "GNU" && noteType == ntGNUBuildID {
+			return hex.EncodeToString(notes[nameEnd : nameEnd+descSize])
+		}
+		notes = notes[descEnd:]
+	}
+	return ""
+}
+
+// Build states of a binary between two builds.
+const (
+	BuildNew       = "new"       // no old side
+	BuildUnchanged = "unchanged" // identical file
+	BuildRebuilt   = "rebuilt"   // recompiled, same code: only metadata differs
+	BuildChanged   = "changed"
+)
+
+// BuildInfoChange is one binary's metadata in the old and new build.
+type BuildInfoChange struct {
+	File   string     `json:"file"`
+	Status string     `json:"status"`
+	Old    *BuildInfo `json:"old,omitempty"`
+	New    *BuildInfo `json:"new"`
+}
+
+// CompareBuildInfo decides whether a binary changed. A binary whose file hash
+// changed while its executable sections did not was rebuilt without code
+// changes: new timestamps, build ids or version resources only.
+func CompareBuildInfo(file string, old, new *BuildInfo) BuildInfoChange {
+	c := BuildInfoChange{File: file, Old: old, New: new}
+	switch {
+	case old == nil:
+		c.Status = BuildNew
+	case old.FileHash == new.FileHash:
+		c.Status = BuildUnchanged
+	case old.CodeHash != "" && old.CodeHash == new.CodeHash:
+		c.Status = BuildRebuilt
+	default:
+		c.Status = BuildChanged
+	}
+	return c
+}
@@ -0,0 +1,650 @@
+package extractor
+
+import (
+	"debug/elf"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/arch/x86/x86asm"
+)
+
+const (
+	maxFunctionSize    = 1 << 20
+	maxListedFunctions = 500
+)
+
+// Function is one function of a binary with a position-independent hash of
+// its instructions.
+type Function struct {
+	Name         string `json:"name"`
+	Address      uint64 `json:"address"`
+	Size         int    `json:"size"`
+	Instructions int    `json:"instructions"`
+	Hash         string `json:"hash"`
+	Anonymous    bool   `json:"anonymous,omitempty"` // no symbol; named sub_<address>
+}
+
+// DisplayName is the demangled name when there is one.
+func (f Function) DisplayName() string {
+	if d := Demangle(f.Name); d != "" {
+		return d
+	}
+	return f.Name
+}
+
+// FunctionTable is the disassembled code of one binary, sorted by address.
+type FunctionTable struct {
+	Format    string     `json:"format"` // pe, elf
+	Source    string     `json:"source"` // where the boundaries came from: symbols, pdata, eh_frame
+	Functions []Function `json:"functions"`
+}
+
+// codeImage is the executable part of a binary, addressed by virtual address.
+type codeImage struct {
+	sections []codeSection
+	minAddr  uint64 // image address range, for recognizing absolute addresses
+	maxAddr  uint64
+}
+
+type codeSection struct {
+	addr uint64
+	data []byte
+}
+
+func (c *codeImage) bytes(addr uint64, size int) []byte {
+	for _, s := range c.sections {
+		if addr >= s.addr && addr < s.addr+uint64(len(s.data)) {
+			off := addr - s.addr
+			end := min(off+uint64(size), uint64(len(s.data)))
+			return s.data[off:end]
+		}
+	}
+	return nil
+}
+
+type functionBounds struct {
+	name string
+	addr uint64
+	size int
+}
+
+// ExtractFunctions disassembles the x86-64 functions of a binary. Boundaries
+// come from the ELF symbol tables or, for stripped binaries, .eh_frame_hdr;
+// for PE from the .pdata exception table, named by the exports.
+func ExtractFunctions(filePath string) (*FunctionTable, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	magic := make([]byte, 4)
+	if _, err := f.ReadAt(magic, 0); err != nil {
+		return nil, err
+	}
+
+	table := &FunctionTable{}
+	var image *codeImage
+	var bounds []functionBounds
+	switch {
+	case string(magic) == elf.ELFMAG:
+		ef, err := elf.NewFile(f)
+		if err != nil {
+			return nil, err
+		}
+		defer ef.Close()
+		if ef.Machine != elf.EM_X86_64 {
+			return nil, fmt.Errorf("unsupported machine %v", ef.Machine)
+		}
+		table.Format = "elf"
+		image, err = elfCodeImage(ef)
+		if err != nil {
+			return nil, err
+		}
+		bounds, table.Source = elfFunctionBounds(ef)
+	case magic[0] == 'M' && magic[1] == 'Z':
+		pf, err := pe.NewFile(f)
+		if err != nil {
+			return nil, err
+		}
+		defer pf.Close()
+		if pf.Machine != pe.IMAGE_FILE_MACHINE_AMD64 {
+			return nil, fmt.Errorf("unsupported machine 0x%x", pf.Machine)
+		}
+		table.Format = "pe"
+		image, err = peCodeImage(pf)
+		if err != nil {
+			return nil, err
+		}
+		bounds, table.Source = peFunctionBounds(pf)
+	default:
+		return nil, fmt.Errorf("unsupported binary format")
+	}
+
+	for _, b := range dedupeBounds(bounds) {
+		code := image.bytes(b.addr, min(b.size, maxFunctionSize))
+		if len(code) == 0 {
+			continue
+		}
+		hash, count := hashFunction(code, image)
+		fn := Function{Name: b.name, Address: b.addr, Size: b.size, Instructions: count, Hash: hash}
+		if fn.Name == "" {
+			fn.Name = fmt.Sprintf("sub_%x", b.addr)
+			fn.Anonymous = true
+		}
+		table.Functions = append(table.Functions, fn)
+	}
+	return table, nil
+}
+
+// dedupeBounds sorts by address and keeps one entry per address, preferring a
+// named one (aliases share an address).
+func dedupeBounds(bounds []functionBounds) []functionBounds {
+	sort.Slice(bounds, func(i, j int) bool {
+		if bounds[i].addr != bounds[j].addr {
+			return bounds[i].addr < bounds[j].addr
+		}
+		return bounds[i].name != "" && (bounds[j].name == "" || bounds[i].name < bounds[j].name)
+	})
+	out := bounds[:0]
+	for _, b := range bounds {
+		if b.size <= 0 || (len(out) > 0 && out[len(out)-1].addr == b.addr) {
+			continue
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+// hashFunction hashes the instructions with everything that moves between
+// builds masked out: RIP-relative displacements, branch and call targets
+// outside the function and immediates pointing into the image. Registers,
+// opcodes, struct offsets and small constants are kept, so a changed field
+// offset or constant changes the hash.
+func hashFunction(code []byte, image *codeImage) (string, int) {
+	h := fnv.New64a()
+	var buf [8]byte
+	put := func(tag byte, v uint64) {
+		buf[0] = tag
+		h.Write(buf[:1])
+		binary.LittleEndian.PutUint64(buf[:], v)
+		h.Write(buf[:])
+	}
+
+	count := 0
+	for pos := 0; pos < len(code); {
+		inst, err := x86asm.Decode(code[pos:], 64)
+		if err != nil || inst.Len == 0 {
+			put('?', uint64(code[pos]))
+			pos++
+			continue
+		}
+		count++
+		put('o', uint64(inst.Op))
+		for _, arg := range inst.Args {
+			if arg == nil {
+				break
+			}
+			switch a := arg.(type) {
+			case x86asm.Reg:
+				put('r', uint64(a))
+			case x86asm.Mem:
+				put('m', uint64(a.Segment)<<24|uint64(a.Base)<<16|uint64(a.Index)<<8|uint64(a.Scale))
+				if a.Base != x86asm.RIP {
+					put('d', uint64(a.Disp))
+				}
+			case x86asm.Imm:
+				if uint64(a) >= image.minAddr && uint64(a) < image.maxAddr {
+					put('a', 0)
+				} else {
+					put('i', uint64(a))
+				}
+			case x86asm.Rel:
+				// Jumps within the function keep their offset; calls and tail
+				// jumps elsewhere depend on the layout.
+				target := pos + inst.Len + int(a)
+				if target >= 0 && target < len(code) {
+					put('j', uint64(target))
+				} else {
+					put('j', 0)
+				}
+			default:
+				put('x', 0)
+			}
+		}
+		pos += inst.Len
+	}
+	return fmt.Sprintf("%016x", h.Sum64()), count
+}
+
+func elfCodeImage(f *elf.File) (*codeImage, error) {
+	image := &codeImage{minAddr: ^uint64(0)}
+	for _, s := range f.Sections {
+		if s.Flags&elf.SHF_ALLOC != 0 && s.Addr != 0 {
+			image.minAddr = min(image.minAddr, s.Addr)
+			image.maxAddr = max(image.maxAddr, s.Addr+s.Size)
+		}
+		if s.Flags&elf.SHF_EXECINSTR == 0 || s.Type == elf.SHT_NOBITS {
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", s.Name, err)
+		}
+		image.sections = append(image.sections, codeSection{addr: s.Addr, data: data})
+	}
+	return image, nil
+}
+
+func elfFunctionBounds(f *elf.File) ([]functionBounds, string) {
+	var bounds []functionBounds
+	add := func(syms []elf.Symbol) {
+		for _, s := range syms {
+			if elf.ST_TYPE(s.Info) == elf.STT_FUNC && s.Value != 0 && s.Size > 0 && s.Section != elf.SHN_UNDEF {
+				bounds = append(bounds, functionBounds{name: s.Name, addr: s.Value, size: int(s.Size)})
+			}
+		}
+	}
+	if syms, err := f.Symbols(); err == nil {
+		add(syms)
+	}
+	if syms, err := f.DynamicSymbols(); err == nil {
+		add(syms)
+	}
+	if len(bounds) > 0 {
+		return bounds, "symbols"
+	}
+	return ehFrameBounds(f), "eh_frame"
+}
+
+// ehFrameBounds reads the function start addresses from the .eh_frame_hdr
+// binary search table; each function ends where the next one starts.
+func ehFrameBounds(f *elf.File) []functionBounds {
+	sec := f.Section(".eh_frame_hdr")
+	if sec == nil {
+		return nil
+	}
+	hdr, err := sec.Data()
+	if err != nil || len(hdr) < 4 || hdr[0] != 1 {
+		return nil
+	}
+	const (
+		encUdata4        = 0x03
+		encSdata4        = 0x0b
+		encPCRelSdata4   = 0x1b
+		encDataRelSdata4 = 0x3b
+	)
+	if hdr[1] != encPCRelSdata4 || (hdr[2] != encUdata4 && hdr[2] != encSdata4) || hdr[3] != encDataRelSdata4 || len(hdr) < 12 {
+		return nil
+	}
+	count := int(f.ByteOrder.Uint32(hdr[8:]))
+	table := hdr[12:]
+	if count <= 0 || count*8 > len(table) {
+		return nil
+	}
+
+	starts := make([]uint64, count)
+	for i := range starts {
+		starts[i] = uint64(int64(sec.Addr) + int64(int32(f.ByteOrder.Uint32(table[i*8:]))))
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+
+	var text *elf.Section
+	bounds := make([]functionBounds, 0, count)
+	for i, start := range starts {
+		if text == nil || start < text.Addr || start >= text.Addr+text.Size {
+			text = sectionForAddr(f, start)
+			if text == nil {
+				continue
+			}
+		}
+		end := text.Addr + text.Size
+		if i+1 < len(starts) && starts[i+1] < end {
+			end = starts[i+1]
+		}
+		bounds = append(bounds, functionBounds{addr: start, size: int(end - start)})
+	}
+	return bounds
+}
+
+func sectionForAddr(f *elf.File, addr uint64) *elf.Section {
+	for _, s := range f.Sections {
+		if s.Flags&elf.SHF_EXECINSTR != 0 && addr >= s.Addr && addr < s.Addr+s.Size {
+			return s
+		}
+	}
+	return nil
+}
+
+func peCodeImage(f *pe.File) (*codeImage, error) {
+	oh, ok := f.OptionalHeader.(*pe.OptionalHeader64)
+	if !ok {
+		return nil, fmt.Errorf("not a PE32+ image")
+	}
+	image := &codeImage{minAddr: oh.ImageBase, maxAddr: oh.ImageBase + uint64(oh.SizeOfImage)}
+	for _, s := range f.Sections {
+		if s.Characteristics&pe.IMAGE_SCN_MEM_EXECUTE == 0 {
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", s.Name, err)
+		}
+		// Addresses are RVAs, as in .pdata.
+		image.sections = append(image.sections, codeSection{addr: uint64(s.VirtualAddress), data: data})
+	}
+	return image, nil
+}
+
+// peFunctionBounds reads the RUNTIME_FUNCTION entries of the exception
+// directory. Every non-leaf x64 function has one; exported functions get
+// their names.
+func peFunctionBounds(f *pe.File) ([]functionBounds, string) {
+	oh := f.OptionalHeader.(*pe.OptionalHeader64)
+	if oh.NumberOfRvaAndSizes <= pe.IMAGE_DIRECTORY_ENTRY_EXCEPTION {
+		return nil, "pdata"
+	}
+	dir := oh.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_EXCEPTION]
+	if dir.VirtualAddress == 0 || dir.Size < 12 {
+		return nil, "pdata"
+	}
+	pdata, err := readRVA(f, dir.VirtualAddress, dir.Size)
+	if err != nil {
+		return nil, "pdata"
+	}
+
+	names := peExportRVAs(f)
+	bounds := make([]functionBounds, 0, len(pdata)/12)
+	for i := 0; i+12 <= len(pdata); i += 12 {
+		begin := binary.LittleEndian.Uint32(pdata[i:])
+		end := binary.LittleEndian.Uint32(pdata[i+4:])
+		if begin == 0 || end <= begin {
+			continue
+		}
+		bounds = append(bounds, functionBounds{name: names[begin], addr: uint64(begin), size: int(end - begin)})
+	}
+	return bounds, "pdata"
+}
+
+// peExportRVAs maps the RVA of every exported function to its name.
+func peExportRVAs(f *pe.File) map[uint32]string {
+	names := make(map[uint32]string)
+	oh := f.OptionalHeader.(*pe.OptionalHeader64)
+	if oh.NumberOfRvaAndSizes <= pe.IMAGE_DIRECTORY_ENTRY_EXPORT {
+		return names
+	}
+	dir := oh.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_EXPORT]
+	if dir.VirtualAddress == 0 || dir.Size == 0 {
+		return names
+	}
+	hdr, err := readRVA(f, dir.VirtualAddress, 40)
+	if err != nil {
+		return names
+	}
+	numberOfFunctions := binary.LittleEndian.Uint32(hdr[20:])
+	numberOfNames := binary.LittleEndian.Uint32(hdr[24:])
+	if numberOfFunctions > 1<<20 || numberOfNames > numberOfFunctions {
+		return names
+	}
+	functions, err1 := readRVA(f, binary.LittleEndian.Uint32(hdr[28:]), numberOfFunctions*4)
+	nameRVAs, err2 := readRVA(f, binary.LittleEndian.Uint32(hdr[32:]), numberOfNames*4)
+	ordinals, err3 := readRVA(f, binary.LittleEndian.Uint32(hdr[36:]), numberOfNames*2)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return names
+	}
+	for i := uint32(0); i < numberOfNames; i++ {
+		ordinal := uint32(binary.LittleEndian.Uint16(ordinals[i*2:]))
+		if ordinal >= numberOfFunctions {
+			continue
+		}
+		name, err := readCStringRVA(f, binary.LittleEndian.Uint32(nameRVAs[i*4:]))
+		if err != nil {
+			continue
+		}
+		names[binary.LittleEndian.Uint32(functions[ordinal*4:])] = name
+	}
+	return names
+}
+
+// FunctionChange is a function present in both builds whose code changed.
+type FunctionChange struct {
+	Name      string `json:"name"`
+	OldName   string `json:"old_name,omitempty"` // anonymous functions are named by address
+	OldSize   int    `json:"old_size"`
+	NewSize   int    `json:"new_size"`
+	SizeDelta int    `json:"size_delta"`
+}
+
+// FunctionDiff is the function-level diff of one binary. The lists are capped
+// at the largest entries; the counts are complete.
+type FunctionDiff struct {
+	File         string           `json:"file"`
+	Added        []Function       `json:"added,omitempty"`
+	Removed      []Function       `json:"removed,omitempty"`
+	Changed      []FunctionChange `json:"changed,omitempty"`
+	AddedCount   int              `json:"added_count"`
+	RemovedCount int              `json:"removed_count"`
+	ChangedCount int              `json:"changed_count"`
+	Unchanged    int              `json:"unchanged"`
+	SizeDelta    int              `json:"size_delta"` // total code size change
+}
+
+func (d *FunctionDiff) IsEmpty() bool {
+	return d.AddedCount == 0 && d.RemovedCount == 0 && d.ChangedCount == 0
+}
+
+// CompareFunctions matches named functions by name. Anonymous functions are
+// matched by hash: functions whose hash is unique in both builds anchor the
+// alignment, and between two anchors the remaining functions are paired in
+// order when both builds have the same number of them.
+func CompareFunctions(file string, old, new *FunctionTable) FunctionDiff {
+	d := FunctionDiff{File: file}
+	var oldAnon, newAnon []Function
+
+	oldNamed := namedFunctions(old.Functions)
+	for _, fn := range old.Functions {
+		if fn.Anonymous {
+			oldAnon = append(oldAnon, fn)
+		}
+	}
+	newNamed := namedFunctions(new.Functions)
+	for _, fn := range new.Functions {
+		if fn.Anonymous {
+			newAnon = append(newAnon, fn)
+		}
+	}
+	for key, fn := range newNamed {
+		prev, ok := oldNamed[key]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, fn)
+		case prev.Hash != fn.Hash:
+			d.Changed = append(d.Changed, FunctionChange{Name: fn.Name, OldSize: prev.Size, NewSize: fn.Size, SizeDelta: fn.Size - prev.Size})
+		default:
+			d.Unchanged++
+		}
+	}
+	for key, fn := range oldNamed {
+		if _, ok := newNamed[key]; !ok {
+			d.Removed = append(d.Removed, fn)
+		}
+	}
+
+	alignAnonymous(&d, oldAnon, newAnon)
+
+	for _, fn := range old.Functions {
+		d.SizeDelta -= fn.Size
+	}
+	for _, fn := range new.Functions {
+		d.SizeDelta += fn.Size
+	}
+	d.AddedCount, d.RemovedCount, d.ChangedCount = len(d.Added), len(d.Removed), len(d.Changed)
+
+	bySize := func(fns []Function) func(i, j int) bool {
+		return func(i, j int) bool {
+			if fns[i].Size != fns[j].Size {
+				return fns[i].Size > fns[j].Size
+			}
+			return fns[i].Address < fns[j].Address
+		}
+	}
+	sort.Slice(d.Added, bySize(d.Added))
+	sort.Slice(d.Removed, bySize(d.Removed))
+	sort.Slice(d.Changed, func(i, j int) bool {
+		a, b := d.Changed[i], d.Changed[j]
+		if abs(a.SizeDelta) != abs(b.SizeDelta) {
+			return abs(a.SizeDelta) > abs(b.SizeDelta)
+		}
+		return a.Name < b.Name
+	})
+	d.Added = d.Added[:min(len(d.Added), maxListedFunctions)]
+	d.Removed = d.Removed[:min(len(d.Removed), maxListedFunctions)]
+	d.Changed = d.Changed[:min(len(d.Changed), maxListedFunctions)]
+	return d
+}
+
+// namedFunctions keys the named functions by name. Local functions can share
+// a name, so repeats are keyed by their occurrence in address order.
+func namedFunctions(fns []Function) map[string]Function {
+	named := make(map[string]Function)
+	seen := make(map[string]int)
+	for _, fn := range fns {
+		if fn.Anonymous {
+			continue
+		}
+		key := fn.Name
+		if n := seen[fn.Name]; n > 0 {
+			key = fmt.Sprintf("%s#%d", fn.Name, n)
+		}
+		seen[fn.Name]++
+		named[key] = fn
+	}
+	return named
+}
+
+func alignAnonymous(d *FunctionDiff, old, new []Function) {
+	countHashes := func(fns []Function) map[string]int {
+		c := make(map[string]int)
+		for _, fn := range fns {
+			c[fn.Hash]++
+		}
+		return c
+	}
+	oldCount, newCount := countHashes(old), countHashes(new)
+	newIndex := make(map[string]int)
+	for i, fn := range new {
+		if newCount[fn.Hash] == 1 {
+			newIndex[fn.Hash] = i
+		}
+	}
+
+	// Unique hashes in both, in old order; the longest run that is increasing
+	// in the new build too is the set of anchors.
+	var pairs [][2]int
+	for i, fn := range old {
+		if oldCount[fn.Hash] == 1 {
+			if j, ok := newIndex[fn.Hash]; ok {
+				pairs = append(pairs, [2]int{i, j})
+			}
+		}
+	}
+	anchors := longestIncreasing(pairs)
+	anchors = append(anchors, [2]int{len(old), len(new)})
+
+	oi, ni := 0, 0
+	for _, a := range anchors {
+		alignGap(d, old[oi:a[0]], new[ni:a[1]])
+		if a[0] < len(old) {
+			d.Unchanged++
+		}
+		oi, ni = a[0]+1, a[1]+1
+	}
+}
+
+// alignGap handles the functions between two anchors: equal hashes are
+// unchanged, the rest are changed when they pair up one to one.
+func alignGap(d *FunctionDiff, old, new []Function) {
+	remaining := make(map[string][]int)
+	for i, fn := range old {
+		remaining[fn.Hash] = append(remaining[fn.Hash], i)
+	}
+	matched := make(map[int]bool)
+	var restNew []Function
+	for _, fn := range new {
+		if idx := remaining[fn.Hash]; len(idx) > 0 {
+			matched[idx[0]] = true
+			remaining[fn.Hash] = idx[1:]
+			d.Unchanged++
+			continue
+		}
+		restNew = append(restNew, fn)
+	}
+	var restOld []Function
+	for i, fn := range old {
+		if !matched[i] {
+			restOld = append(restOld, fn)
+		}
+	}
+
+	if len(restOld) == len(restNew) {
+		for i := range restOld {
+			c := FunctionChange{
+				Name:      restNew[i].Name,
+				OldSize:   restOld[i].Size,
+				NewSize:   restNew[i].Size,
+				SizeDelta: restNew[i].Size - restOld[i].Size,
+			}
+			if restOld[i].Name != c.Name {
+				c.OldName = restOld[i].Name
+			}
+			d.Changed = append(d.Changed, c)
+		}
+		return
+	}
+	d.Added = append(d.Added, restNew...)
+	d.Removed = append(d.Removed, restOld...)
+}
+
+// longestIncreasing returns the longest subsequence of pairs (already
+// increasing in the first element) that is also increasing in the second.
+func longestIncreasing(pairs [][2]int) [][2]int {
+	if len(pairs) == 0 {
+		return nil
+	}
+	tails := []int{} // index into pairs of the smallest tail of each length
+	prev := make([]int, len(pairs))
+	for i, p := range pairs {
+		k := sort.Search(len(tails), func(k int) bool { return pairs[tails[k]][1] >= p[1] })
+		if k > 0 {
+			prev[i] = tails[k-1]
+		} else {
+			prev[i] = -1
+		}
+		if k == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[k] = i
+		}
+	}
+	out := make([][2]int, len(tails))
+	for i, k := len(tails)-1, tails[len(tails)-1]; i >= 0; i, k = i-1, prev[k] {
+		out[i] = pairs[k]
+	}
+	return out
+}
+
+// Summary is a one-line description of a function diff.
+func (d *FunctionDiff) Summary() string {
+	parts := []string{
+		fmt.Sprintf("+%d", d.AddedCount),
+		fmt.Sprintf("-%d", d.RemovedCount),
+		fmt.Sprintf("~%d", d.ChangedCount),
+		fmt.Sprintf("=%d", d.Unchanged),
+	}
+	return strings.Join(parts, " / ") + fmt.Sprintf(" functions, %+d bytes", d.SizeDelta)
+}
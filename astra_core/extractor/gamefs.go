@@ -0,0 +1,238 @@
+package extractor
+
+import (
+	"astra_core/keyvalues"
+	"astra_core/vpk"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// GameFS merges the loose files and VPK contents of a downloaded depot into a
+// single namespace of game-relative paths such as "scripts/items/items_game.txt".
+// Loose files win over packed ones, matching the engine's search order.
+type GameFS struct {
+	loose map[string]string // game path -> absolute path on disk
+	packs []mountedPack     // in mount order: the first holding a path wins
+}
+
+// mountedPack is a VPK of the depot and where its _dir.vpk is.
+type mountedPack struct {
+	path    string
+	archive *vpk.Archive
+}
+
+// OpenGameFS indexes depotRoot. A directory containing gameinfo.gi or a
+// *_dir.vpk is treated as a mod root; loose paths are made relative to it.
+func OpenGameFS(depotRoot string) (*GameFS, error) {
+	if depotRoot == "" {
+		return nil, fmt.Errorf("gamefs: empty depot path")
+	}
+
+	g := &GameFS{loose: make(map[string]string)}
+
+	var modRoots, gameinfos []string
+	var files []string
+	packs := make(map[string]*vpk.Archive)
+	err := filepath.WalkDir(depotRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		name := strings.ToLower(d.Name())
+		if name == "gameinfo.gi" || strings.HasSuffix(name, "_dir.vpk") {
+			modRoots = append(modRoots, filepath.Dir(path))
+		}
+		if name == "gameinfo.gi" {
+			gameinfos = append(gameinfos, path)
+		}
+		if strings.HasSuffix(name, "_dir.vpk") {
+			archive, err := vpk.Open(path)
+			if err != nil {
+				log.Printf("Skipping unreadable VPK %s: %v", path, err)
+				return nil
+			}
+			packs[path] = archive
+			return nil
+		}
+		if strings.HasSuffix(name, ".vpk") {
+			return nil // numbered data archive
+		}
+		files = append(files, path)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Longest mod root first so nested mods (game/csgo inside game/) resolve correctly.
+	sort.Slice(modRoots, func(i, j int) bool { return len(modRoots[i]) > len(modRoots[j]) })
+
+	for _, path := range files {
+		base := depotRoot
+		for _, root := range modRoots {
+			if strings.HasPrefix(path, root+string(filepath.Separator)) {
+				base = root
+				break
+			}
+		}
+		rel, err := filepath.Rel(base, path)
+		if err != nil {
+			continue
+		}
+		g.loose[normalizeGamePath(rel)] = path
+	}
+
+	g.packs = mountPacks(packs, gameinfos)
+	return g, nil
+}
+
+// mountPacks orders the VPKs like the engine mounts them: by the game search
+// paths of the gameinfo.gi files, then the ones no search path names, by path.
+func mountPacks(packs map[string]*vpk.Archive, gameinfos []string) []mountedPack {
+	var paths []string
+	for path := range packs {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var mounted []mountedPack
+	added := make(map[string]bool)
+	mount := func(path string) {
+		if !added[path] {
+			added[path] = true
+			mounted = append(mounted, mountedPack{path, packs[path]})
+		}
+	}
+	for _, gameinfo := range gameinfos {
+		for _, search := range gameSearchPaths(gameinfo) {
+			for _, path := range paths {
+				if strings.EqualFold(path, search) || strings.EqualFold(filepath.Dir(path), search) {
+					mount(path)
+				}
+			}
+		}
+	}
+	for _, path := range paths {
+		mount(path)
+	}
+	return mounted
+}
+
+// gameSearchPaths reads the "Game" search paths of a gameinfo.gi, in order,
+// as directories or VPKs on disk. Paths are relative to the directory above
+// the mod, as in "Game csgo"; Source 1 style |gameinfo_path| prefixes name
+// the mod directory itself.
+func gameSearchPaths(gameinfo string) []string {
+	data, err := os.ReadFile(gameinfo)
+	if err != nil {
+		return nil
+	}
+	root, err := keyvalues.Parse(data)
+	if err != nil {
+		log.Printf("Ignoring unreadable %s: %v", gameinfo, err)
+		return nil
+	}
+	info := root.Child("GameInfo")
+	if info == nil {
+		return nil
+	}
+	fsys := info.Child("FileSystem")
+	if fsys == nil {
+		return nil
+	}
+	searchPaths := fsys.Child("SearchPaths")
+	if searchPaths == nil {
+		return nil
+	}
+
+	modDir := filepath.Dir(gameinfo)
+	var out []string
+	for _, c := range searchPaths.Children {
+		if c.IsSection() || !isGameSearchPath(c.Key) {
+			continue
+		}
+		value := filepath.FromSlash(c.Value)
+		base := filepath.Dir(modDir)
+		if rest, ok := strings.CutPrefix(value, "|gameinfo_path|"); ok {
+			value, base = rest, modDir
+		} else if rest, ok := strings.CutPrefix(value, "|all_source_engine_paths|"); ok {
+			value = rest
+		}
+		out = append(out, filepath.Join(base, value))
+	}
+	return out
+}
+
+// isGameSearchPath reports whether a search path key such as "Game" or
+// "Game+Mod" mounts content for the game. Variants like Game_LowViolence
+// only apply to some configurations.
+func isGameSearchPath(key string) bool {
+	for _, part := range strings.Split(key, "+") {
+		if strings.EqualFold(part, "game") {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeGamePath(p string) string {
+	return strings.ToLower(filepath.ToSlash(p))
+}
+
+// Glob returns every game path accepted by match, loose and packed, sorted and de-duplicated.
+func (g *GameFS) Glob(match func(gamePath string) bool) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for p := range g.loose {
+		if match(p) && !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	for _, pack := range g.packs {
+		for _, p := range pack.archive.Files() {
+			if match(p) && !seen[p] {
+				seen[p] = true
+				out = append(out, p)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// ReadFile reads a game path: the loose file, or the entry of the first VPK
+// in mount order holding it.
+func (g *GameFS) ReadFile(gamePath string) ([]byte, error) {
+	gamePath = normalizeGamePath(gamePath)
+	if abs, ok := g.loose[gamePath]; ok {
+		return os.ReadFile(abs)
+	}
+	for _, pack := range g.packs {
+		if _, ok := pack.archive.Entry(gamePath); ok {
+			return pack.archive.ReadFile(gamePath)
+		}
+	}
+	return nil, fmt.Errorf("gamefs: %s: %w", gamePath, os.ErrNotExist)
+}
+
+// Source reports where a game path is stored: the loose file or the VPK holding it.
+func (g *GameFS) Source(gamePath string) string {
+	gamePath = normalizeGamePath(gamePath)
+	if abs, ok := g.loose[gamePath]; ok {
+		return abs
+	}
+	for _, pack := range g.packs {
+		if _, ok := pack.archive.Entry(gamePath); ok {
+			return pack.path
+		}
+	}
+	return ""
+}
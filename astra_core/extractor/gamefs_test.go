@@ -0,0 +1,71 @@
+package extractor
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writePreloadVPK writes a v1 _dir.vpk holding one file whose content is all
+// preload data.
+func writePreloadVPK(t *testing.T, path, dir, name, ext, content string) {
+	t.Helper()
+	var tree []byte
+	tree = append(tree, ext+"\x00"+dir+"\x00"+name+"\x00"...)
+	tree = binary.LittleEndian.AppendUint32(tree, crc32.ChecksumIEEE([]byte(content)))
+	tree = binary.LittleEndian.AppendUint16(tree, uint16(len(content)))
+	tree = binary.LittleEndian.AppendUint16(tree, 0x7fff)
+	tree = binary.LittleEndian.AppendUint32(tree, 0)
+	tree = binary.LittleEndian.AppendUint32(tree, 0)
+	tree = binary.LittleEndian.AppendUint16(tree, 0xffff)
+	tree = append(tree, content...)
+	tree = append(tree, "\x00\x00\x00"...) // end of names, directories and extensions
+
+	data := binary.LittleEndian.AppendUint32(nil, 0x55aa1234)
+	data = binary.LittleEndian.AppendUint32(data, 1)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(tree)))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, append(data, tree...), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGameFSReadsPacksInMountOrder(t *testing.T) {
+	for _, tc := range []struct {
+		searchPaths string
+		want        string
+	}{
+		{"Game_LowViolence csgo_lv\n Game csgo\n Game core", "csgo"},
+		{"Game core\n Game csgo", "core"},
+	} {
+		root := t.TempDir()
+		for _, mod := range []string{"core", "csgo", "csgo_lv"} {
+			writePreloadVPK(t, filepath.Join(root, "game", mod, "pak01_dir.vpk"), "scripts", "shared", "txt", mod)
+		}
+		gameinfo := `"GameInfo" { FileSystem { SearchPaths { ` + tc.searchPaths + ` } } }`
+		if err := os.WriteFile(filepath.Join(root, "game", "csgo", "gameinfo.gi"), []byte(gameinfo), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		g, err := OpenGameFS(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 10; i++ {
+			data, err := g.ReadFile("scripts/shared.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tc.want {
+				t.Fatalf("search paths %q: read %q, want %q", tc.searchPaths, data, tc.want)
+			}
+		}
+		if got, want := g.Source("scripts/shared.txt"), filepath.Join(root, "game", tc.want, "pak01_dir.vpk"); got != want {
+			t.Errorf("search paths %q: source %s, want %s", tc.searchPaths, got, want)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package extractor
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Reasons a string is suppressed as noise.
+const (
+	NoiseEntropy        = "entropy"         // random-looking blob
+	NoiseGibberish      = "gibberish"       // bytes of code or data that happen to be printable
+	NoiseHash           = "hash"            // hex digest, GUID or similar identifier
+	NoiseBuildPath      = "build_path"      // source or build machine path
+	NoiseCompilerSymbol = "compiler_symbol" // mangled or compiler-generated name
+	NoiseVolatile       = "volatile"        // learned: changes in most builds
+)
+
+// NoiseConfig holds the thresholds of the noise filter.
+type NoiseConfig struct {
+	MaxEntropy        float64 // bits per character above which long strings are blobs
+	MinEntropyLength  int     // shorter strings are not entropy-checked
+	MaxSymbolRatio    float64 // share of punctuation above which a string is gibberish
+	VolatileRatio     float64 // share of a file's build diffs a string shape must churn in
+	VolatileMinBuilds int     // build diffs needed before anything counts as volatile
+}
+
+func DefaultNoiseConfig() NoiseConfig {
+	return NoiseConfig{
+		MaxEntropy:        4.5,
+		MinEntropyLength:  20,
+		MaxSymbolRatio:    0.35,
+		VolatileRatio:     0.6,
+		VolatileMinBuilds: 3,
+	}
+}
+
+var (
+	hexRunPattern    = regexp.MustCompile(`\b[0-9a-fA-F]{16,}\b`)
+	guidPattern      = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+	drivePathPattern = regexp.MustCompile(`(?i)^[a-z]:[\\/]`)
+	sourceExtPattern = regexp.MustCompile(`\.(c|cc|cpp|cxx|h|hpp|inl|pdb|obj)$`)
+	digitRunPattern  = regexp.MustCompile(`[0-9]+`)
+)
+
+var buildPathPrefixes = []string{"/home/", "/build/", "/buildbot/", "/usr/src/", "/tmp/", "/root/"}
+
+var compilerPrefixes = []string{"_Z", "__Z", "?", ".?A", "$LN", "__imp_", "__cxx", "_GLOBAL__", "__tcf_"}
+
+var compilerMarkers = []string{"@@", "<lambda_", "`anonymous namespace'", "`vftable'", "`string'", "__scrt_", "__acrt_", "__vcrt_"}
+
+// Reason returns why s is noise according to the static filters, or "" when
+// it is not. Learned volatile strings are checked separately by the caller.
+func (c NoiseConfig) Reason(s string) string {
+	switch {
+	case isCompilerSymbol(s):
+		return NoiseCompilerSymbol
+	case isBuildPath(s):
+		return NoiseBuildPath
+	case guidPattern.MatchString(s) || isHexDigest(s):
+		return NoiseHash
+	case symbolRatio(s) > c.MaxSymbolRatio || isMixedCaseNoise(s):
+		return NoiseGibberish
+	case len(s) >= c.MinEntropyLength && !strings.Contains(s, " ") && ShannonEntropy(s) > c.MaxEntropy && vowelRatio(s) < 0.25:
+		return NoiseEntropy
+	}
+	return ""
+}
+
+// ShannonEntropy is the entropy of s in bits per character.
+func ShannonEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	var counts [256]int
+	for i := 0; i < len(s); i++ {
+		counts[s[i]]++
+	}
+	n := float64(len(s))
+	e := 0.0
+	for _, c := range counts {
+		if c > 0 {
+			p := float64(c) / n
+			e -= p * math.Log2(p)
+		}
+	}
+	return e
+}
+
+// StringShape replaces digit runs with a single 0, so values that differ only
+// in numbers (timestamps, build numbers, counters) share a shape.
+func StringShape(s string) string {
+	return digitRunPattern.ReplaceAllString(s, "0")
+}
+
+func isCompilerSymbol(s string) bool {
+	for _, p := range compilerPrefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	for _, m := range compilerMarkers {
+		if strings.Contains(s, m) {
+			return true
+		}
+	}
+	return false
+}
+
+func isBuildPath(s string) bool {
+	if drivePathPattern.MatchString(s) {
+		return true
+	}
+	for _, p := range buildPathPrefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return strings.ContainsAny(s, `/\`) && sourceExtPattern.MatchString(s)
+}
+
+// isHexDigest reports a standalone hex run containing both digits and letters,
+// so plain numbers and hex-looking parts of longer words do not count.
+func isHexDigest(s string) bool {
+	for _, run := range hexRunPattern.FindAllString(s, -1) {
+		if strings.ContainsAny(run, "0123456789") && strings.ContainsAny(strings.ToLower(run), "abcdef") {
+			return true
+		}
+	}
+	return false
+}
+
+// symbolRatio is the share of characters that are neither letters, digits,
+// spaces nor common identifier and path separators.
+func symbolRatio(s string) float64 {
+	symbols := 0
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune(" _./:-#%", r) {
+			continue
+		}
+		symbols++
+	}
+	return float64(symbols) / float64(len(s))
+}
+
+// vowelRatio is the share of vowels among the letters of s. Words and
+// identifiers sit around a third; random letters around a fifth.
+func vowelRatio(s string) float64 {
+	letters, vowels := 0, 0
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		if strings.ContainsRune("aeiouAEIOU", r) {
+			vowels++
+		}
+	}
+	if letters == 0 {
+		return 0
+	}
+	return float64(vowels) / float64(letters)
+}
+
+// isMixedCaseNoise catches short strings such as "L+g8H" or "&BqP": mixed case
+// or punctuation, and no letter run of three or more that reads like a word or
+// a CamelCase part. Short names like "P250", "m4a1", "Ak47" or "IsOk" are kept.
+func isMixedCaseNoise(s string) bool {
+	if len(s) > 12 {
+		return false
+	}
+	best, run := 0, 0
+	hasUpper, hasLower, hasSymbol := false, false, false
+	var prev rune
+	for _, r := range s {
+		switch {
+		case unicode.IsLower(r):
+			hasLower = true
+			run++
+		case unicode.IsUpper(r):
+			hasUpper = true
+			// An upper case letter after a lower case one starts a new word.
+			if unicode.IsLower(prev) {
+				run = 1
+			} else {
+				run++
+			}
+		default:
+			if !unicode.IsDigit(r) && r != '_' {
+				hasSymbol = true
+			}
+			run = 0
+		}
+		best = max(best, run)
+		prev = r
+	}
+	return best < 3 && ((hasUpper && hasLower && !isShortWords(s)) || hasSymbol)
+}
+
+// isShortWords reports whether every letter of s belongs to a short word: an
+// optional capital and lower case letters, with a vowel among them, as in
+// "Ak47" or "IsOk". A capital on its own, as in "BqP", does not count.
+func isShortWords(s string) bool {
+	lower, vowel, started := false, false, false
+	wordDone := func() bool {
+		ok := !started || (lower && vowel)
+		lower, vowel, started = false, false, false
+		return ok
+	}
+	for _, r := range s {
+		switch {
+		case unicode.IsUpper(r):
+			if !wordDone() {
+				return false
+			}
+			started = true
+		case unicode.IsLower(r):
+			started, lower = true, true
+		default:
+			if !wordDone() {
+				return false
+			}
+			continue
+		}
+		if strings.ContainsRune("aeiouAEIOU", r) {
+			vowel = true
+		}
+	}
+	return wordDone()
+}
+
+// FilterNoise drops noise from strs. volatile holds the learned shapes (see
+// StringShape) to suppress; it may be nil. suppressed counts the dropped
+// strings by reason.
+func FilterNoise(strs []string, c NoiseConfig, volatile map[string]bool) (kept []string, suppressed map[string]int) {
+	suppressed = make(map[string]int)
+	for _, s := range strs {
+		reason := c.Reason(s)
+		if reason == "" && volatile[StringShape(s)] {
+			reason = NoiseVolatile
+		}
+		if reason != "" {
+			suppressed[reason]++
+			continue
+		}
+		kept = append(kept, s)
+	}
+	return kept, suppressed
+}
+
+// ChurnedShapes returns the shapes present on both sides of a diff: a value
+// was replaced by another that differs only in its numbers.
+func ChurnedShapes(added, removed []string) []string {
+	removedShapes := make(map[string]bool)
+	for _, s := range removed {
+		if shape := StringShape(s); shape != s {
+			removedShapes[shape] = true
+		}
+	}
+	seen := make(map[string]bool)
+	var shapes []string
+	for _, s := range added {
+		shape := StringShape(s)
+		if shape != s && removedShapes[shape] && !seen[shape] {
+			seen[shape] = true
+			shapes = append(shapes, shape)
+		}
+	}
+	return shapes
+}
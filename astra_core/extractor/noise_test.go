@@ -0,0 +1,78 @@
+package extractor
+
+import "testing"
+
+func TestNoiseReason(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"weapon_m4a1_silencer", ""},
+		{"#SFUI_Settings_Crosshair", ""},
+		{"CMsgGCToClientMatchEnd", ""},
+		{"sv_cheats", ""},
+		{"Hello world", ""},
+		{"P250", ""},
+		{"m4a1", ""},
+		{"Ak47", ""},
+		{"IsOk", ""},
+		{"isOk", ""},
+		{"_ZN5Steam4InitEv", NoiseCompilerSymbol},
+		{"?Init@CSteam@@QAEXXZ", NoiseCompilerSymbol},
+		{"/home/buildbot/src/game/client.cpp", NoiseBuildPath},
+		{`C:\buildworker\csgo\main.cpp`, NoiseBuildPath},
+		{"src/game/shared/weapon.cpp", NoiseBuildPath},
+		{"3f2504e0-4f89-11d3-9a0c-0305e82c3301", NoiseHash},
+		{"d41d8cd98f00b204e9800998ecf8427e", NoiseHash},
+		{"L+g8H", NoiseGibberish},
+		{"&BqP", NoiseGibberish},
+		{"BqP", NoiseGibberish},
+		{"}{)(*&", NoiseGibberish},
+		{"xK9qZ2vR7mW4pL8nT3bY6cJ5hF", NoiseEntropy},
+	}
+	c := DefaultNoiseConfig()
+	for _, tt := range tests {
+		if got := c.Reason(tt.s); got != tt.want {
+			t.Errorf("Reason(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestIsMixedCaseNoise(t *testing.T) {
+	tests := []struct {
+		s    string
+		want bool
+	}{
+		{"Ak47", false},
+		{"IsOk", false},
+		{"isOk", false},
+		{"P250", false},
+		{"m4a1", false},
+		{"abcDEF", false},
+		{"ThisIsALongName", false},
+		{"BqP", true},
+		{"XaQ", true},
+		{"AuVW", true},
+		{"Bq47", true},
+		{"L+g8H", true},
+		{"&BqP", true},
+	}
+	for _, tt := range tests {
+		if got := isMixedCaseNoise(tt.s); got != tt.want {
+			t.Errorf("isMixedCaseNoise(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestFilterNoise(t *testing.T) {
+	strs := []string{"weapon_ak47", "BqP", "build 12345", "build_time 1700000000"}
+	volatile := map[string]bool{StringShape("build_time 1700000000"): true}
+
+	kept, suppressed := FilterNoise(strs, DefaultNoiseConfig(), volatile)
+	if len(kept) != 2 || kept[0] != "weapon_ak47" || kept[1] != "build 12345" {
+		t.Errorf("kept %q, want weapon_ak47 and build 12345", kept)
+	}
+	if suppressed[NoiseGibberish] != 1 || suppressed[NoiseVolatile] != 1 {
+		t.Errorf("suppressed %v, want one gibberish and one volatile", suppressed)
+	}
+}
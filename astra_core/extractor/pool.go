@@ -0,0 +1,154 @@
+package extractor
+
+import (
+	"context"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Budget bounds concurrent extraction. Each task reserves its estimated memory
+// cost before it starts; a task costing more than the whole budget runs alone.
+type Budget struct {
+	Workers     int   `json:"workers"`
+	MemoryBytes int64 `json:"memory_bytes"`
+}
+
+func DefaultBudget() Budget {
+	return Budget{Workers: runtime.NumCPU(), MemoryBytes: 2 << 30}
+}
+
+type Task struct {
+	Name string
+	Size int64 // bytes of input, for progress
+	Cost int64 // estimated peak memory
+	Run  func()
+}
+
+type Progress struct {
+	FilesDone  int       `json:"files_done"`
+	FilesTotal int       `json:"files_total"`
+	BytesDone  int64     `json:"bytes_done"`
+	BytesTotal int64     `json:"bytes_total"`
+	Running    []string  `json:"running,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+}
+
+type Pool struct {
+	budget Budget
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	reserved int64
+	progress Progress
+}
+
+func NewPool(b Budget) *Pool {
+	def := DefaultBudget()
+	if b.Workers <= 0 {
+		b.Workers = def.Workers
+	}
+	if b.MemoryBytes <= 0 {
+		b.MemoryBytes = def.MemoryBytes
+	}
+	p := &Pool{budget: b}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// Run executes tasks on up to Budget.Workers goroutines, largest first so the
+// biggest binaries don't end up as the tail. report, if set, receives a
+// snapshot after every state change and must not block. Once ctx is done,
+// tasks that have not started are skipped; Run waits for the running ones
+// and returns ctx.Err().
+func (p *Pool) Run(ctx context.Context, tasks []Task, report func(Progress)) error {
+	ordered := make([]Task, len(tasks))
+	copy(ordered, tasks)
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].Cost > ordered[j].Cost })
+
+	p.mu.Lock()
+	p.progress = Progress{FilesTotal: len(tasks), StartedAt: time.Now()}
+	for _, t := range tasks {
+		p.progress.BytesTotal += t.Size
+	}
+	p.mu.Unlock()
+
+	queue := make(chan Task)
+	var wg sync.WaitGroup
+	for i := 0; i < p.budget.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range queue {
+				cost := p.acquire(t)
+				if ctx.Err() != nil {
+					p.release(cost)
+					continue
+				}
+				p.update(report, func(pr *Progress) { pr.Running = append(pr.Running, t.Name) })
+
+				t.Run()
+
+				p.release(cost)
+				p.update(report, func(pr *Progress) {
+					pr.FilesDone++
+					pr.BytesDone += t.Size
+					for i, name := range pr.Running {
+						if name == t.Name {
+							pr.Running = append(pr.Running[:i], pr.Running[i+1:]...)
+							break
+						}
+					}
+				})
+			}
+		}()
+	}
+
+feed:
+	for _, t := range ordered {
+		select {
+		case queue <- t:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+	return ctx.Err()
+}
+
+func (p *Pool) acquire(t Task) int64 {
+	cost := t.Cost
+	if cost > p.budget.MemoryBytes {
+		cost = p.budget.MemoryBytes
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.reserved > 0 && p.reserved+cost > p.budget.MemoryBytes {
+		p.cond.Wait()
+	}
+	p.reserved += cost
+	return cost
+}
+
+func (p *Pool) release(cost int64) {
+	p.mu.Lock()
+	p.reserved -= cost
+	p.mu.Unlock()
+	p.cond.Broadcast()
+}
+
+func (p *Pool) update(report func(Progress), f func(*Progress)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f(&p.progress)
+
+	// Reported under the lock so snapshots arrive in order.
+	if report != nil {
+		snapshot := p.progress
+		snapshot.Running = append([]string(nil), p.progress.Running...)
+		report(snapshot)
+	}
+}
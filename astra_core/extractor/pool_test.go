@@ -0,0 +1,44 @@
+package extractor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPoolSkipsTasksOnceCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var ran atomic.Int32
+	var tasks []Task
+	for i := 0; i < 5; i++ {
+		tasks = append(tasks, Task{
+			Name: fmt.Sprintf("file%d", i),
+			Cost: int64(5 - i),
+			Run: func() {
+				ran.Add(1)
+				cancel()
+			},
+		})
+	}
+
+	var last Progress
+	err := NewPool(Budget{Workers: 1, MemoryBytes: 1 << 20}).Run(ctx, tasks, func(p Progress) { last = p })
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Run: %v, want context.Canceled", err)
+	}
+	if ran.Load() != 1 {
+		t.Errorf("%d task(s) ran, want only the one that canceled", ran.Load())
+	}
+	if last.FilesDone != 1 {
+		t.Errorf("progress reports %d file(s) done, want 1", last.FilesDone)
+	}
+
+	ran.Store(0)
+	if err := NewPool(Budget{Workers: 2}).Run(context.Background(), tasks[:3], nil); err != nil || ran.Load() != 3 {
+		t.Errorf("uncanceled Run: %v with %d task(s) run, want all 3", err, ran.Load())
+	}
+}
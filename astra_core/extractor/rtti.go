@@ -0,0 +1,436 @@
+package extractor
+
+import (
+	"debug/elf"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ianlancetaylor/demangle"
+)
+
+// ClassInfo is a polymorphic C++ class recovered from RTTI.
+// Bases lists direct and indirect bases when the hierarchy could be followed.
+type ClassInfo struct {
+	Name  string   `json:"name"`
+	ABI   string   `json:"abi"` // msvc, itanium
+	Bases []string `json:"bases,omitempty"`
+}
+
+var (
+	msvcTypeDescRegex = regexp.MustCompile(`\.\?A[VU][A-Za-z0-9_@?$<>]+@@`)
+	// Itanium typeinfo names are mangled types without the _Z prefix: "11CBaseEntity",
+	// "N7Physics5WorldE". This is only a pre-filter; the demangler validates lengths.
+	itaniumTypeNameRegex = regexp.MustCompile(`^(?:[1-9]\d*[A-Za-z_]|N|S[tabsio])[A-Za-z0-9_]*$`)
+)
+
+// ExtractClasses lists the C++ classes described by RTTI in a PE or ELF binary.
+func ExtractClasses(filePath string) ([]ClassInfo, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	magic := make([]byte, 4)
+	if _, err := f.ReadAt(magic, 0); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case string(magic) == elf.ELFMAG:
+		ef, err := elf.NewFile(f)
+		if err != nil {
+			return nil, err
+		}
+		defer ef.Close()
+		return elfClasses(ef)
+	case magic[0] == 'M' && magic[1] == 'Z':
+		pf, err := pe.NewFile(f)
+		if err != nil {
+			return nil, err
+		}
+		defer pf.Close()
+		return peClasses(pf)
+	default:
+		return nil, fmt.Errorf("unsupported binary format")
+	}
+}
+
+// MSVCTypeName turns a type descriptor name (.?AVCFoo@ns@@) into ns::CFoo.
+// Templates are returned in their decorated form.
+func MSVCTypeName(desc string) string {
+	if len(desc) < 5 || !strings.HasPrefix(desc, ".?A") {
+		return desc
+	}
+	if name := demangleMSVCName("?" + desc[4:]); name != "" {
+		return name
+	}
+	return desc
+}
+
+func peClasses(f *pe.File) ([]ClassInfo, error) {
+	classes := make(map[string]*ClassInfo)
+
+	// x64 images locate RTTI by RVA, and every CompleteObjectLocator stores its
+	// own RVA, which makes them easy to find reliably in .rdata.
+	if _, ok := f.OptionalHeader.(*pe.OptionalHeader64); ok {
+		for _, s := range f.Sections {
+			if s.Name != ".rdata" {
+				continue
+			}
+			data, err := s.Data()
+			if err != nil {
+				return nil, err
+			}
+			for off := 0; off+24 <= len(data); off += 4 {
+				if binary.LittleEndian.Uint32(data[off:]) != 1 {
+					continue
+				}
+				if binary.LittleEndian.Uint32(data[off+20:]) != s.VirtualAddress+uint32(off) {
+					continue
+				}
+				typeRVA := binary.LittleEndian.Uint32(data[off+12:])
+				hierRVA := binary.LittleEndian.Uint32(data[off+16:])
+				name, err := msvcTypeDescriptorName(f, typeRVA)
+				if err != nil {
+					continue
+				}
+				if _, seen := classes[name]; !seen {
+					classes[name] = &ClassInfo{Name: name, ABI: "msvc", Bases: msvcBases(f, hierRVA)}
+				}
+			}
+		}
+	}
+
+	// Fall back to (and complete with) plain descriptor strings, which also covers
+	// classes only used by typeid/dynamic_cast and 32-bit images.
+	for _, s := range f.Sections {
+		if s.Name != ".data" && s.Name != ".rdata" {
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			continue
+		}
+		for _, m := range msvcTypeDescRegex.FindAll(data, -1) {
+			name := MSVCTypeName(string(m))
+			if _, seen := classes[name]; !seen {
+				classes[name] = &ClassInfo{Name: name, ABI: "msvc"}
+			}
+		}
+	}
+
+	return sortedClasses(classes), nil
+}
+
+// TypeDescriptor (x64): pVFTable, spare, then the decorated name.
+func msvcTypeDescriptorName(f *pe.File, rva uint32) (string, error) {
+	name, err := readCStringRVA(f, rva+16)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(name, ".?A") {
+		return "", fmt.Errorf("not a type descriptor")
+	}
+	return MSVCTypeName(name), nil
+}
+
+// ClassHierarchyDescriptor: signature, attributes, numBaseClasses, pBaseClassArray.
+// The first BaseClassDescriptor is the class itself.
+func msvcBases(f *pe.File, hierRVA uint32) []string {
+	hdr, err := readRVA(f, hierRVA, 16)
+	if err != nil {
+		return nil
+	}
+	count := binary.LittleEndian.Uint32(hdr[8:])
+	if count <= 1 || count > 256 {
+		return nil
+	}
+	arrayRVA := binary.LittleEndian.Uint32(hdr[12:])
+	array, err := readRVA(f, arrayRVA, count*4)
+	if err != nil {
+		return nil
+	}
+
+	var bases []string
+	for i := uint32(1); i < count; i++ {
+		bcd, err := readRVA(f, binary.LittleEndian.Uint32(array[i*4:]), 4)
+		if err != nil {
+			continue
+		}
+		if name, err := msvcTypeDescriptorName(f, binary.LittleEndian.Uint32(bcd)); err == nil {
+			bases = append(bases, name)
+		}
+	}
+	return bases
+}
+
+func elfClasses(f *elf.File) ([]ClassInfo, error) {
+	classes := make(map[string]*ClassInfo)
+	nameAt := make(map[uint64]string) // address of typeinfo name string -> class
+
+	// Typeinfo name strings live in .rodata as NUL-terminated mangled types.
+	if s := f.Section(".rodata"); s != nil {
+		data, err := s.Data()
+		if err != nil {
+			return nil, err
+		}
+		start := 0
+		for i, b := range data {
+			if b != 0 {
+				continue
+			}
+			if i-start >= 2 && i-start < 512 {
+				if name := itaniumTypeName(data[start:i]); name != "" {
+					nameAt[s.Addr+uint64(start)] = name
+					if _, seen := classes[name]; !seen {
+						classes[name] = &ClassInfo{Name: name, ABI: "itanium"}
+					}
+				}
+			}
+			start = i + 1
+		}
+	}
+
+	// Exported _ZTS symbols catch names the scan rejected.
+	if syms, err := f.DynamicSymbols(); err == nil {
+		for _, s := range syms {
+			if !strings.HasPrefix(s.Name, "_ZTS") || s.Section == elf.SHN_UNDEF {
+				continue
+			}
+			if name := itaniumTypeName([]byte(s.Name[4:])); name != "" {
+				nameAt[s.Value] = name
+				if _, seen := classes[name]; !seen {
+					classes[name] = &ClassInfo{Name: name, ABI: "itanium"}
+				}
+			}
+		}
+	}
+
+	if f.Class == elf.ELFCLASS64 && f.Machine == elf.EM_X86_64 {
+		for name, bases := range itaniumHierarchy(f, nameAt) {
+			if c, ok := classes[name]; ok {
+				c.Bases = bases
+			}
+		}
+	}
+
+	return sortedClasses(classes), nil
+}
+
+func itaniumTypeName(b []byte) string {
+	if len(b) == 0 || !itaniumTypeNameRegex.Match(b) {
+		return ""
+	}
+	out, err := demangle.ToString("_ZTS" + string(b))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(out, "typeinfo name for ")
+}
+
+type elfReloc struct {
+	sym    string
+	target uint64
+}
+
+// itaniumHierarchy follows typeinfo objects in a PIC x86-64 ELF. Their pointer
+// fields are zero on disk and filled by dynamic relocations, so the relocation
+// table is what links a typeinfo to its name string and base typeinfos.
+func itaniumHierarchy(f *elf.File, nameAt map[uint64]string) map[string][]string {
+	relocs := elfRelocations(f)
+	if len(relocs) == 0 {
+		return nil
+	}
+
+	// typeinfo address -> class name: a typeinfo's second word points at its name.
+	typeinfoName := make(map[uint64]string)
+	for off, r := range relocs {
+		if name, ok := nameAt[r.target]; ok && off >= 8 {
+			typeinfoName[off-8] = name
+		}
+	}
+
+	direct := make(map[string][]string)
+	for ti, name := range typeinfoName {
+		vptr, ok := relocs[ti]
+		if !ok {
+			continue
+		}
+		switch {
+		case strings.Contains(vptr.sym, "__si_class_type_info"):
+			if base, ok := relocs[ti+16]; ok {
+				if baseName, ok := typeinfoName[base.target]; ok {
+					direct[name] = []string{baseName}
+				}
+			}
+		case strings.Contains(vptr.sym, "__vmi_class_type_info"):
+			hdr, err := readELFAddr(f, ti+16, 8)
+			if err != nil {
+				continue
+			}
+			count := binary.LittleEndian.Uint32(hdr[4:])
+			if count > 64 {
+				continue
+			}
+			for i := uint64(0); i < uint64(count); i++ {
+				if base, ok := relocs[ti+24+i*16]; ok {
+					if baseName, ok := typeinfoName[base.target]; ok {
+						direct[name] = append(direct[name], baseName)
+					}
+				}
+			}
+		}
+	}
+
+	// Expand to the full ancestor list, nearest first, like the MSVC base array.
+	result := make(map[string][]string)
+	for name := range direct {
+		seen := map[string]bool{name: true}
+		queue := append([]string(nil), direct[name]...)
+		var all []string
+		for len(queue) > 0 {
+			b := queue[0]
+			queue = queue[1:]
+			if seen[b] {
+				continue
+			}
+			seen[b] = true
+			all = append(all, b)
+			queue = append(queue, direct[b]...)
+		}
+		result[name] = all
+	}
+	return result
+}
+
+func elfRelocations(f *elf.File) map[uint64]elfReloc {
+	syms, _ := f.DynamicSymbols()
+	relocs := make(map[uint64]elfReloc)
+
+	for _, s := range f.Sections {
+		if s.Type != elf.SHT_RELA {
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			continue
+		}
+		for off := 0; off+24 <= len(data); off += 24 {
+			r := elf.Rela64{
+				Off:    binary.LittleEndian.Uint64(data[off:]),
+				Info:   binary.LittleEndian.Uint64(data[off+8:]),
+				Addend: int64(binary.LittleEndian.Uint64(data[off+16:])),
+			}
+			symIdx := elf.R_SYM64(r.Info)
+			switch elf.R_X86_64(elf.R_TYPE64(r.Info)) {
+			case elf.R_X86_64_RELATIVE:
+				relocs[r.Off] = elfReloc{target: uint64(r.Addend)}
+			case elf.R_X86_64_64:
+				// DynamicSymbols omits the null symbol, so index i is syms[i-1].
+				if symIdx == 0 || int(symIdx) > len(syms) {
+					continue
+				}
+				sym := syms[symIdx-1]
+				relocs[r.Off] = elfReloc{sym: sym.Name, target: sym.Value + uint64(r.Addend)}
+			}
+		}
+	}
+	return relocs
+}
+
+func readELFAddr(f *elf.File, addr uint64, n int) ([]byte, error) {
+	for _, s := range f.Sections {
+		if s.Type == elf.SHT_NOBITS || addr < s.Addr || addr+uint64(n) > s.Addr+s.Size {
+			continue
+		}
+		buf := make([]byte, n)
+		if _, err := s.ReadAt(buf, int64(addr-s.Addr)); err != nil {
+			return nil, err
+		}
+		return buf, nil
+	}
+	return nil, fmt.Errorf("address 0x%x not mapped", addr)
+}
+
+func sortedClasses(m map[string]*ClassInfo) []ClassInfo {
+	out := make([]ClassInfo, 0, len(m))
+	for _, c := range m {
+		out = append(out, *c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+type ClassChange struct {
+	Name     string   `json:"name"`
+	OldBases []string `json:"old_bases"`
+	NewBases []string `json:"new_bases"`
+}
+
+type ClassDiff struct {
+	File    string        `json:"file"`
+	Added   []ClassInfo   `json:"added,omitempty"`
+	Removed []ClassInfo   `json:"removed,omitempty"`
+	Rebased []ClassChange `json:"rebased,omitempty"`
+}
+
+func (d *ClassDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Rebased) == 0
+}
+
+// CompareClasses reports added and removed classes, and classes whose
+// known base list changed.
+func CompareClasses(file string, old, new []ClassInfo) ClassDiff {
+	d := ClassDiff{File: file}
+	oldByName := make(map[string]ClassInfo, len(old))
+	newByName := make(map[string]ClassInfo, len(new))
+	for _, c := range old {
+		oldByName[c.Name] = c
+	}
+	for _, c := range new {
+		newByName[c.Name] = c
+	}
+
+	for _, c := range new {
+		o, exists := oldByName[c.Name]
+		if !exists {
+			d.Added = append(d.Added, c)
+			continue
+		}
+		if len(o.Bases) > 0 && len(c.Bases) > 0 && !equalStrings(o.Bases, c.Bases) {
+			d.Rebased = append(d.Rebased, ClassChange{Name: c.Name, OldBases: o.Bases, NewBases: c.Bases})
+		}
+	}
+	for _, c := range old {
+		if _, exists := newByName[c.Name]; !exists {
+			d.Removed = append(d.Removed, c)
+		}
+	}
+	return d
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats a class with its nearest base, e.g. "CWeaponTaser : CCSWeaponBase".
+func (c ClassInfo) String() string {
+	if len(c.Bases) == 0 {
+		return c.Name
+	}
+	return c.Name + " : " + c.Bases[0]
+}
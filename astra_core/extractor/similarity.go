@@ -0,0 +1,238 @@
+package extractor
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	// ModificationThreshold is the similarity above which an added and a removed
+	// string are reported as one modified string.
+	ModificationThreshold = 0.8
+
+	minModifiedLength = 6  // shorter strings are too ambiguous to pair
+	maxCandidates     = 50 // removed strings compared per added string
+)
+
+// StringModification is a removed string that was likely renamed or edited
+// into an added one, e.g. weapon_m4a1_silencer -> weapon_m4a1_silencer_v2.
+type StringModification struct {
+	Old        string  `json:"old"`
+	New        string  `json:"new"`
+	Similarity float64 `json:"similarity"`
+}
+
+// PairModifiedStrings matches added strings against removed ones and moves
+// pairs scoring at least threshold out of both lists. Pairing is one-to-one and
+// greedy by score, so the closest matches win. Only strings sharing a token are
+// compared, which keeps large diffs tractable.
+func PairModifiedStrings(added, removed []string, threshold float64) (modified []StringModification, restAdded, restRemoved []string) {
+	if len(added) == 0 || len(removed) == 0 {
+		return nil, added, removed
+	}
+
+	removedTokens := make([][]string, len(removed))
+	byToken := make(map[string][]int)
+	for i, s := range removed {
+		if len(s) < minModifiedLength {
+			continue
+		}
+		removedTokens[i] = tokenize(s)
+		for _, tok := range removedTokens[i] {
+			byToken[tok] = append(byToken[tok], i)
+		}
+	}
+
+	type candidate struct {
+		a, r  int
+		score float64
+	}
+	var candidates []candidate
+	for a, s := range added {
+		if len(s) < minModifiedLength {
+			continue
+		}
+		tokens := tokenize(s)
+		// Rare tokens first: they point at the most specific candidates.
+		rare := append([]string{}, tokens...)
+		sort.SliceStable(rare, func(i, j int) bool { return len(byToken[rare[i]]) < len(byToken[rare[j]]) })
+		seen := make(map[int]bool)
+	scan:
+		for _, tok := range rare {
+			for _, r := range byToken[tok] {
+				if len(seen) >= maxCandidates {
+					break scan
+				}
+				if seen[r] {
+					continue
+				}
+				seen[r] = true
+				if score := similarity(removed[r], s, removedTokens[r], tokens, threshold); score >= threshold {
+					candidates = append(candidates, candidate{a, r, score})
+				}
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, added, removed
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		if added[candidates[i].a] != added[candidates[j].a] {
+			return added[candidates[i].a] < added[candidates[j].a]
+		}
+		return removed[candidates[i].r] < removed[candidates[j].r]
+	})
+
+	usedAdded := make(map[int]bool)
+	usedRemoved := make(map[int]bool)
+	for _, c := range candidates {
+		if usedAdded[c.a] || usedRemoved[c.r] {
+			continue
+		}
+		usedAdded[c.a] = true
+		usedRemoved[c.r] = true
+		modified = append(modified, StringModification{Old: removed[c.r], New: added[c.a], Similarity: c.score})
+	}
+
+	for i, s := range added {
+		if !usedAdded[i] {
+			restAdded = append(restAdded, s)
+		}
+	}
+	for i, s := range removed {
+		if !usedRemoved[i] {
+			restRemoved = append(restRemoved, s)
+		}
+	}
+	sort.Slice(modified, func(i, j int) bool { return modified[i].New < modified[j].New })
+	return modified, restAdded, restRemoved
+}
+
+// similarity is the better of the normalized edit distance and the token
+// overlap, so both small edits and reordered or extended identifiers score high.
+// The edit distance is only computed while it can still reach threshold and
+// beat the token score.
+func similarity(a, b string, aTokens, bTokens []string, threshold float64) float64 {
+	score := tokenSimilarity(aTokens, bTokens)
+	longest := max(len(a), len(b))
+	limit := int((1 - max(score, threshold)) * float64(longest))
+	if d, ok := levenshteinWithin(a, b, limit); ok {
+		score = max(score, 1-float64(d)/float64(longest))
+	}
+	return score
+}
+
+// tokenSimilarity is the Jaccard index of the two token sets.
+func tokenSimilarity(a, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	set := make(map[string]bool, len(a))
+	for _, t := range a {
+		set[t] = true
+	}
+	shared := 0
+	union := len(set)
+	for _, t := range b {
+		if set[t] {
+			shared++
+			delete(set, t)
+		} else {
+			union++
+		}
+	}
+	return float64(shared) / float64(union)
+}
+
+// tokenize splits an identifier into lowercase words on punctuation and
+// camelCase boundaries: "CMsgGCToClient_Foo" -> [cmsg, gc, to, client, foo].
+func tokenize(s string) []string {
+	var tokens []string
+	seen := make(map[string]bool)
+	var cur []rune
+	flush := func() {
+		if len(cur) > 0 {
+			tok := strings.ToLower(string(cur))
+			if !seen[tok] {
+				seen[tok] = true
+				tokens = append(tokens, tok)
+			}
+			cur = cur[:0]
+		}
+	}
+	runes := []rune(s)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || (unicode.IsUpper(prev) && nextLower) {
+				flush()
+			}
+		}
+		cur = append(cur, r)
+	}
+	flush()
+	return tokens
+}
+
+// levenshteinWithin returns the edit distance of a and b, or false as soon as
+// it is known to exceed limit. Only the diagonal band of width limit is
+// computed, since cells outside it already exceed the limit.
+func levenshteinWithin(a, b string, limit int) (int, bool) {
+	if len(a) < len(b) {
+		a, b = b, a
+	}
+	if len(a)-len(b) > limit {
+		return 0, false
+	}
+	over := limit + 1
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = min(j, over)
+	}
+	for i := 1; i <= len(a); i++ {
+		lo, hi := max(1, i-limit), min(len(b), i+limit)
+		if lo > 1 {
+			curr[lo-1] = over
+		} else {
+			curr[0] = min(i, over)
+		}
+		rowMin := curr[lo-1]
+		for j := lo; j <= hi; j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost, over)
+			rowMin = min(rowMin, curr[j])
+		}
+		if hi < len(b) {
+			curr[hi+1] = over
+		}
+		if rowMin > limit {
+			return 0, false
+		}
+		prev, curr = curr, prev
+	}
+	if prev[len(b)] > limit {
+		return 0, false
+	}
+	return prev[len(b)], true
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
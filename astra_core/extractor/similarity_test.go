@@ -0,0 +1,140 @@
+package extractor
+
+import (
+	"slices"
+	"testing"
+)
+
+// levenshtein is the unbounded edit distance the banded one must agree with.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr := make([]int, len(b)+1)
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev = curr
+	}
+	return prev[len(b)]
+}
+
+func TestLevenshteinWithin(t *testing.T) {
+	tests := []struct {
+		a, b   string
+		limit  int
+		want   int
+		wantOK bool
+	}{
+		{"weapon_m4a1_silencer", "weapon_m4a1_silencer_v2", 3, 3, true},
+		{"weapon_m4a1_silencer", "weapon_m4a1_silencer_v2", 2, 0, false},
+		{"kitten", "sitting", 3, 3, true},
+		{"kitten", "sitting", 2, 0, false},
+		{"abc", "abc", 0, 0, true},
+		{"abc", "abd", 0, 0, false},
+		{"abcdef", "abc", 3, 3, true},
+		{"abcdef", "abc", 2, 0, false}, // length difference above the limit
+		{"abc", "abcdef", 2, 0, false},
+		{"", "abc", 3, 3, true},
+		{"", "", 0, 0, true},
+		{"flaw", "lawn", 2, 2, true},
+	}
+	for _, tt := range tests {
+		d, ok := levenshteinWithin(tt.a, tt.b, tt.limit)
+		if d != tt.want || ok != tt.wantOK {
+			t.Errorf("levenshteinWithin(%q, %q, %d) = %d, %v, want %d, %v", tt.a, tt.b, tt.limit, d, ok, tt.want, tt.wantOK)
+		}
+	}
+
+	words := []string{"", "a", "ab", "ba", "abc", "cab", "abcd", "dcba", "weapon", "wepaon", "weapons", "eapon"}
+	for _, a := range words {
+		for _, b := range words {
+			want := levenshtein(a, b)
+			for limit := 0; limit <= 7; limit++ {
+				d, ok := levenshteinWithin(a, b, limit)
+				if ok != (want <= limit) || (ok && d != want) {
+					t.Errorf("levenshteinWithin(%q, %q, %d) = %d, %v, want distance %d", a, b, limit, d, ok, want)
+				}
+			}
+		}
+	}
+}
+
+func TestPairModifiedStrings(t *testing.T) {
+	tests := []struct {
+		name        string
+		added       []string
+		removed     []string
+		want        []StringModification
+		restAdded   []string
+		restRemoved []string
+	}{
+		{
+			name:    "renamed",
+			added:   []string{"weapon_m4a1_silencer_v2"},
+			removed: []string{"weapon_m4a1_silencer"},
+			want:    []StringModification{{Old: "weapon_m4a1_silencer", New: "weapon_m4a1_silencer_v2"}},
+		},
+		{
+			name:      "one removed string pairs once",
+			added:     []string{"weapon_m4a1_silencer_v3", "weapon_m4a1_silencer_v2"},
+			removed:   []string{"weapon_m4a1_silencer"},
+			want:      []StringModification{{Old: "weapon_m4a1_silencer", New: "weapon_m4a1_silencer_v2"}},
+			restAdded: []string{"weapon_m4a1_silencer_v3"},
+		},
+		{
+			name:    "closest match wins",
+			added:   []string{"#SFUI_Settings_Crosshair_Style", "#SFUI_Settings_Crosshair_Size"},
+			removed: []string{"#SFUI_Settings_Crosshair_Sizes", "#SFUI_Settings_Crosshair_Styles"},
+			want: []StringModification{
+				{Old: "#SFUI_Settings_Crosshair_Sizes", New: "#SFUI_Settings_Crosshair_Size"},
+				{Old: "#SFUI_Settings_Crosshair_Styles", New: "#SFUI_Settings_Crosshair_Style"},
+			},
+		},
+		{
+			name:        "under the minimum length",
+			added:       []string{"abcde"},
+			removed:     []string{"abcdf"},
+			restAdded:   []string{"abcde"},
+			restRemoved: []string{"abcdf"},
+		},
+		{
+			name:        "not similar enough",
+			added:       []string{"weapon_awp_dragon_lore"},
+			removed:     []string{"weapon_ak47"},
+			restAdded:   []string{"weapon_awp_dragon_lore"},
+			restRemoved: []string{"weapon_ak47"},
+		},
+		{
+			name:      "nothing removed",
+			added:     []string{"weapon_m4a1_silencer_v2"},
+			restAdded: []string{"weapon_m4a1_silencer_v2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modified, restAdded, restRemoved := PairModifiedStrings(tt.added, tt.removed, ModificationThreshold)
+			if len(modified) != len(tt.want) {
+				t.Fatalf("modified %+v, want %+v", modified, tt.want)
+			}
+			for i, m := range modified {
+				if m.Old != tt.want[i].Old || m.New != tt.want[i].New || m.Similarity < ModificationThreshold {
+					t.Errorf("modified[%d] = %+v, want %s -> %s above the threshold", i, m, tt.want[i].Old, tt.want[i].New)
+				}
+			}
+			if !slices.Equal(restAdded, tt.restAdded) {
+				t.Errorf("rest added %q, want %q", restAdded, tt.restAdded)
+			}
+			if !slices.Equal(restRemoved, tt.restRemoved) {
+				t.Errorf("rest removed %q, want %q", restRemoved, tt.restRemoved)
+			}
+		})
+	}
+}
@@ -0,0 +1,384 @@
+package extractor
+
+import (
+	"debug/elf"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ianlancetaylor/demangle"
+)
+
+type Symbol struct {
+	Name      string `json:"name"`
+	Library   string `json:"library,omitempty"` // imports only
+	Demangled string `json:"demangled,omitempty"`
+}
+
+// Key identifies a symbol for set comparison. Imports are keyed by library as
+// well, since moving a function between DLLs is a change worth reporting.
+func (s Symbol) Key() string {
+	if s.Library == "" {
+		return s.Name
+	}
+	return strings.ToLower(s.Library) + "!" + s.Name
+}
+
+// SymbolTable is the dynamic linking surface of one binary.
+type SymbolTable struct {
+	Format    string   `json:"format"` // pe, elf
+	Exports   []Symbol `json:"exports,omitempty"`
+	Imports   []Symbol `json:"imports,omitempty"`
+	Libraries []string `json:"libraries,omitempty"`
+}
+
+// ExtractSymbolTable reads PE export/import tables or ELF dynamic symbols.
+func ExtractSymbolTable(filePath string) (*SymbolTable, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	magic := make([]byte, 4)
+	if _, err := f.ReadAt(magic, 0); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case string(magic) == elf.ELFMAG:
+		ef, err := elf.NewFile(f)
+		if err != nil {
+			return nil, err
+		}
+		defer ef.Close()
+		return elfSymbolTable(ef)
+	case magic[0] == 'M' && magic[1] == 'Z':
+		pf, err := pe.NewFile(f)
+		if err != nil {
+			return nil, err
+		}
+		defer pf.Close()
+		return peSymbolTable(pf)
+	default:
+		return nil, fmt.Errorf("unsupported binary format")
+	}
+}
+
+func elfSymbolTable(f *elf.File) (*SymbolTable, error) {
+	table := &SymbolTable{Format: "elf"}
+
+	syms, err := f.DynamicSymbols()
+	if err != nil && err != elf.ErrNoSymbols {
+		return nil, err
+	}
+	for _, s := range syms {
+		if s.Name == "" || s.Section != elf.SHN_UNDEF && elf.ST_VISIBILITY(s.Other) != elf.STV_DEFAULT {
+			continue
+		}
+		bind := elf.ST_BIND(s.Info)
+		if bind != elf.STB_GLOBAL && bind != elf.STB_WEAK {
+			continue
+		}
+		typ := elf.ST_TYPE(s.Info)
+		if typ != elf.STT_FUNC && typ != elf.STT_OBJECT && typ != elf.STT_NOTYPE {
+			continue
+		}
+
+		sym := Symbol{Name: s.Name, Demangled: Demangle(s.Name)}
+		if s.Section == elf.SHN_UNDEF {
+			sym.Library = s.Library
+			table.Imports = append(table.Imports, sym)
+		} else {
+			table.Exports = append(table.Exports, sym)
+		}
+	}
+
+	table.Libraries, _ = f.ImportedLibraries()
+	table.sort()
+	return table, nil
+}
+
+func peSymbolTable(f *pe.File) (*SymbolTable, error) {
+	table := &SymbolTable{Format: "pe"}
+
+	exports, err := peExports(f)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range exports {
+		table.Exports = append(table.Exports, Symbol{Name: name, Demangled: Demangle(name)})
+	}
+
+	// ImportedSymbols yields "function:library"
+	imports, _ := f.ImportedSymbols()
+	for _, imp := range imports {
+		name, lib, _ := strings.Cut(imp, ":")
+		table.Imports = append(table.Imports, Symbol{Name: name, Library: lib, Demangled: Demangle(name)})
+	}
+
+	table.Libraries, _ = f.ImportedLibraries()
+	// ImportedLibraries is unimplemented for PE in the standard library, so derive it from imports
+	if len(table.Libraries) == 0 {
+		seen := make(map[string]bool)
+		for _, imp := range table.Imports {
+			lib := strings.ToLower(imp.Library)
+			if lib != "" && !seen[lib] {
+				seen[lib] = true
+				table.Libraries = append(table.Libraries, lib)
+			}
+		}
+	}
+
+	table.sort()
+	return table, nil
+}
+
+func (t *SymbolTable) sort() {
+	sort.Slice(t.Exports, func(i, j int) bool { return t.Exports[i].Name < t.Exports[j].Name })
+	sort.Slice(t.Imports, func(i, j int) bool { return t.Imports[i].Key() < t.Imports[j].Key() })
+	sort.Strings(t.Libraries)
+}
+
+// peExports walks IMAGE_EXPORT_DIRECTORY. debug/pe does not parse exports.
+func peExports(f *pe.File) ([]string, error) {
+	var dir pe.DataDirectory
+	switch oh := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		if oh.NumberOfRvaAndSizes > pe.IMAGE_DIRECTORY_ENTRY_EXPORT {
+			dir = oh.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_EXPORT]
+		}
+	case *pe.OptionalHeader64:
+		if oh.NumberOfRvaAndSizes > pe.IMAGE_DIRECTORY_ENTRY_EXPORT {
+			dir = oh.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_EXPORT]
+		}
+	}
+	if dir.VirtualAddress == 0 || dir.Size == 0 {
+		return nil, nil
+	}
+
+	hdr, err := readRVA(f, dir.VirtualAddress, 40)
+	if err != nil {
+		return nil, fmt.Errorf("read export directory: %w", err)
+	}
+	numberOfNames := binary.LittleEndian.Uint32(hdr[24:])
+	addressOfNames := binary.LittleEndian.Uint32(hdr[32:])
+	if numberOfNames > 1<<20 {
+		return nil, fmt.Errorf("export directory claims %d names", numberOfNames)
+	}
+
+	nameRVAs, err := readRVA(f, addressOfNames, numberOfNames*4)
+	if err != nil {
+		return nil, fmt.Errorf("read export names: %w", err)
+	}
+
+	names := make([]string, 0, numberOfNames)
+	for i := uint32(0); i < numberOfNames; i++ {
+		name, err := readCStringRVA(f, binary.LittleEndian.Uint32(nameRVAs[i*4:]))
+		if err != nil {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func sectionForRVA(f *pe.File, rva uint32) *pe.Section {
+	for _, s := range f.Sections {
+		size := s.VirtualSize
+		if size == 0 {
+			size = s.Size
+		}
+		if rva >= s.VirtualAddress && rva < s.VirtualAddress+size {
+			return s
+		}
+	}
+	return nil
+}
+
+func readRVA(f *pe.File, rva, n uint32) ([]byte, error) {
+	s := sectionForRVA(f, rva)
+	if s == nil {
+		return nil, fmt.Errorf("rva 0x%x not in any section", rva)
+	}
+	buf := make([]byte, n)
+	if _, err := s.ReadAt(buf, int64(rva-s.VirtualAddress)); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func readCStringRVA(f *pe.File, rva uint32) (string, error) {
+	s := sectionForRVA(f, rva)
+	if s == nil {
+		return "", fmt.Errorf("rva 0x%x not in any section", rva)
+	}
+	var sb strings.Builder
+	buf := make([]byte, 64)
+	off := int64(rva - s.VirtualAddress)
+	for sb.Len() < 4096 {
+		n, err := s.ReadAt(buf, off)
+		for i := 0; i < n; i++ {
+			if buf[i] == 0 {
+				return sb.String(), nil
+			}
+			sb.WriteByte(buf[i])
+		}
+		if err != nil {
+			return sb.String(), nil
+		}
+		off += int64(n)
+	}
+	return sb.String(), nil
+}
+
+// Demangle returns the readable form of an Itanium (_Z...) or MSVC (?...) name,
+// or "" if the name is not mangled or cannot be decoded.
+func Demangle(name string) string {
+	switch {
+	case strings.HasPrefix(name, "_Z"):
+		if out, err := demangle.ToString(name); err == nil {
+			return out
+		}
+	case strings.HasPrefix(name, "?"):
+		return demangleMSVCName(name)
+	}
+	return ""
+}
+
+// demangleMSVCName decodes the qualified name of a decorated MSVC symbol
+// (?func@Class@ns@@...) and drops the type signature. Templates are not decoded.
+func demangleMSVCName(name string) string {
+	rest := name[1:]
+	var special string
+	if strings.HasPrefix(rest, "?") {
+		switch {
+		case strings.HasPrefix(rest, "?0"):
+			special, rest = "ctor", rest[2:]
+		case strings.HasPrefix(rest, "?1"):
+			special, rest = "dtor", rest[2:]
+		case strings.HasPrefix(rest, "?_7"):
+			special, rest = "`vftable'", rest[3:]
+		case strings.HasPrefix(rest, "?$"):
+			return ""
+		default:
+			special, rest = "operator", rest[2:]
+		}
+	}
+
+	var parts []string
+	for {
+		if rest == "" {
+			return ""
+		}
+		if rest[0] == '@' {
+			break
+		}
+		if rest[0] >= '0' && rest[0] <= '9' {
+			idx := int(rest[0] - '0')
+			if idx >= len(parts) {
+				return ""
+			}
+			parts = append(parts, parts[idx])
+			rest = rest[1:]
+			continue
+		}
+		if strings.HasPrefix(rest, "?$") {
+			return ""
+		}
+		end := strings.IndexByte(rest, '@')
+		if end <= 0 {
+			return ""
+		}
+		parts = append(parts, rest[:end])
+		rest = rest[end+1:]
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+
+	// Fragments are innermost first.
+	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+		parts[i], parts[j] = parts[j], parts[i]
+	}
+	switch special {
+	case "ctor":
+		parts = append(parts, parts[len(parts)-1])
+	case "dtor":
+		parts = append(parts, "~"+parts[len(parts)-1])
+	case "":
+	default:
+		parts = append(parts, special)
+	}
+	return strings.Join(parts, "::")
+}
+
+type SymbolDiff struct {
+	File             string   `json:"file"`
+	AddedExports     []Symbol `json:"added_exports,omitempty"`
+	RemovedExports   []Symbol `json:"removed_exports,omitempty"`
+	AddedImports     []Symbol `json:"added_imports,omitempty"`
+	RemovedImports   []Symbol `json:"removed_imports,omitempty"`
+	AddedLibraries   []string `json:"added_libraries,omitempty"`
+	RemovedLibraries []string `json:"removed_libraries,omitempty"`
+}
+
+func (d *SymbolDiff) IsEmpty() bool {
+	return len(d.AddedExports) == 0 && len(d.RemovedExports) == 0 &&
+		len(d.AddedImports) == 0 && len(d.RemovedImports) == 0 &&
+		len(d.AddedLibraries) == 0 && len(d.RemovedLibraries) == 0
+}
+
+func CompareSymbolTables(file string, old, new *SymbolTable) SymbolDiff {
+	d := SymbolDiff{File: file}
+	if old == nil {
+		old = &SymbolTable{}
+	}
+	if new == nil {
+		new = &SymbolTable{}
+	}
+
+	d.AddedExports, d.RemovedExports = compareSymbols(old.Exports, new.Exports)
+	d.AddedImports, d.RemovedImports = compareSymbols(old.Imports, new.Imports)
+
+	oldLibs := make(map[string]bool)
+	newLibs := make(map[string]bool)
+	for _, l := range old.Libraries {
+		oldLibs[strings.ToLower(l)] = true
+	}
+	for _, l := range new.Libraries {
+		newLibs[strings.ToLower(l)] = true
+		if !oldLibs[strings.ToLower(l)] {
+			d.AddedLibraries = append(d.AddedLibraries, l)
+		}
+	}
+	for _, l := range old.Libraries {
+		if !newLibs[strings.ToLower(l)] {
+			d.RemovedLibraries = append(d.RemovedLibraries, l)
+		}
+	}
+	return d
+}
+
+func compareSymbols(old, new []Symbol) (added, removed []Symbol) {
+	oldSet := make(map[string]bool)
+	newSet := make(map[string]bool)
+	for _, s := range old {
+		oldSet[s.Key()] = true
+	}
+	for _, s := range new {
+		newSet[s.Key()] = true
+		if !oldSet[s.Key()] {
+			added = append(added, s)
+		}
+	}
+	for _, s := range old {
+		if !newSet[s.Key()] {
+			removed = append(removed, s)
+		}
+	}
+	return added, removed
+}
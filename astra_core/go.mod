@@ -2,4 +2,8 @@ module astra_core
 
 go 1.25.4
 
-require github.com/mattn/go-sqlite3 v1.14.32
+require (
+	github.com/ianlancetaylor/demangle v0.0.0-20260724033716-83e58baca724
+	github.com/mattn/go-sqlite3 v1.14.32
+	golang.org/x/arch v0.30.0
+)
@@ -0,0 +1,297 @@
+package items
+
+import (
+	"astra_core/keyvalues"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const SchemaPath = "scripts/items/items_game.txt"
+
+// Section kinds reported in a SchemaDiff, in display order.
+const (
+	KindItems       = "items"
+	KindCases       = "cases"
+	KindPaintKits   = "paint_kits"
+	KindStickerKits = "sticker_kits"
+	KindKeychains   = "keychains"
+	KindLootLists   = "loot_lists"
+	KindItemSets    = "item_sets"
+	KindAttributes  = "attributes"
+)
+
+var kindOrder = []string{KindItems, KindCases, KindPaintKits, KindStickerKits, KindKeychains, KindLootLists, KindItemSets, KindAttributes}
+
+// items_game blocks that map directly onto a kind. "items" is split into items/cases separately.
+var blockKinds = map[string]string{
+	"paint_kits":           KindPaintKits,
+	"sticker_kits":         KindStickerKits,
+	"keychain_definitions": KindKeychains,
+	"client_loot_lists":    KindLootLists,
+	"item_sets":            KindItemSets,
+	"attributes":           KindAttributes,
+}
+
+type Entry struct {
+	ID       string            `json:"id"`
+	Name     string            `json:"name"`
+	ItemName string            `json:"item_name,omitempty"` // localization token, e.g. #CSGO_crate_community_33
+	Fields   map[string]string `json:"-"`
+}
+
+// Schema is the subset of items_game.txt AstraNet tracks, keyed by kind then ID.
+type Schema struct {
+	Sections map[string]map[string]*Entry
+}
+
+func ParseSchema(data []byte) (*Schema, error) {
+	root, err := keyvalues.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	game := root.Child("items_game")
+	if game == nil {
+		return nil, fmt.Errorf("items: missing \"items_game\" root")
+	}
+
+	s := &Schema{Sections: make(map[string]map[string]*Entry)}
+	for _, kind := range kindOrder {
+		s.Sections[kind] = make(map[string]*Entry)
+	}
+
+	prefabs := make(map[string]string)
+	for _, block := range game.ChildrenNamed("prefabs") {
+		for _, p := range block.Children {
+			prefabs[strings.ToLower(p.Key)] = strings.ToLower(p.Get("prefab"))
+		}
+	}
+
+	for _, block := range game.Children {
+		key := strings.ToLower(block.Key)
+		if !block.IsSection() {
+			continue
+		}
+
+		switch key {
+		case "items":
+			for _, item := range block.Children {
+				if !item.IsSection() {
+					continue
+				}
+				entry := newEntry(item)
+				kind := KindItems
+				if isCase(entry, prefabs) {
+					kind = KindCases
+				}
+				s.Sections[kind][entry.ID] = entry
+			}
+		case "revolving_loot_lists":
+			// "1" "crate_dhw13_promo" - leaf pairs rather than sections
+			for _, rl := range block.Children {
+				s.Sections[KindLootLists]["revolving:"+rl.Key] = &Entry{
+					ID:     "revolving:" + rl.Key,
+					Name:   rl.Value,
+					Fields: map[string]string{"list": rl.Value},
+				}
+			}
+		default:
+			kind, ok := blockKinds[key]
+			if !ok {
+				continue
+			}
+			for _, def := range block.Children {
+				if !def.IsSection() {
+					continue
+				}
+				entry := newEntry(def)
+				s.Sections[kind][entry.ID] = entry
+			}
+		}
+	}
+
+	return s, nil
+}
+
+func newEntry(n *keyvalues.Node) *Entry {
+	e := &Entry{
+		ID:       n.Key,
+		Name:     n.Get("name"),
+		ItemName: n.Get("item_name"),
+		Fields:   n.Flatten(),
+	}
+	if e.Name == "" {
+		e.Name = n.Key // loot lists and item sets are keyed by name
+	}
+	return e
+}
+
+// Cases either use a *weapon_case* prefab (directly or through a parent prefab)
+// or carry the supply crate series attribute.
+func isCase(e *Entry, prefabs map[string]string) bool {
+	if strings.HasPrefix(strings.ToLower(e.Name), "crate_") {
+		return true
+	}
+	for _, p := range strings.Fields(strings.ToLower(e.Fields["prefab"])) {
+		for depth := 0; p != "" && depth < 8; depth++ {
+			if strings.Contains(p, "weapon_case") {
+				return true
+			}
+			p = prefabs[p]
+		}
+	}
+	_, ok := e.Fields["attributes/set supply crate series/value"]
+	return ok
+}
+
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new,omitempty"`
+}
+
+type EntryChange struct {
+	ID      string        `json:"id"`
+	Name    string        `json:"name"`
+	Changes []FieldChange `json:"changes"`
+}
+
+type SchemaSection struct {
+	Kind    string        `json:"kind"`
+	Added   []Entry       `json:"added,omitempty"`
+	Removed []Entry       `json:"removed,omitempty"`
+	Changed []EntryChange `json:"changed,omitempty"`
+}
+
+type SchemaDiff struct {
+	Sections []SchemaSection `json:"sections"`
+}
+
+func (d *SchemaDiff) IsEmpty() bool {
+	return d == nil || len(d.Sections) == 0
+}
+
+// Section returns the section for kind, or nil if nothing changed there.
+func (d *SchemaDiff) Section(kind string) *SchemaSection {
+	if d == nil {
+		return nil
+	}
+	for i := range d.Sections {
+		if d.Sections[i].Kind == kind {
+			return &d.Sections[i]
+		}
+	}
+	return nil
+}
+
+// CompareSchemas reports added, removed and modified definitions per kind.
+// A nil old schema means every definition in new is reported as added.
+func CompareSchemas(old, new *Schema) *SchemaDiff {
+	result := &SchemaDiff{}
+	if new == nil {
+		return result
+	}
+
+	for _, kind := range kindOrder {
+		newDefs := new.Sections[kind]
+		var oldDefs map[string]*Entry
+		if old != nil {
+			oldDefs = old.Sections[kind]
+		}
+
+		section := SchemaSection{Kind: kind}
+		for _, id := range sortedIDs(newDefs) {
+			n := newDefs[id]
+			o, exists := oldDefs[id]
+			if !exists {
+				section.Added = append(section.Added, *n)
+				continue
+			}
+			if changes := compareFields(o.Fields, n.Fields); len(changes) > 0 {
+				section.Changed = append(section.Changed, EntryChange{ID: id, Name: n.Name, Changes: changes})
+			}
+		}
+		for _, id := range sortedIDs(oldDefs) {
+			if _, exists := newDefs[id]; !exists {
+				section.Removed = append(section.Removed, *oldDefs[id])
+			}
+		}
+
+		if len(section.Added) > 0 || len(section.Removed) > 0 || len(section.Changed) > 0 {
+			result.Sections = append(result.Sections, section)
+		}
+	}
+
+	return result
+}
+
+func compareFields(old, new map[string]string) []FieldChange {
+	var changes []FieldChange
+	for field, nv := range new {
+		if ov, ok := old[field]; !ok || ov != nv {
+			changes = append(changes, FieldChange{Field: field, Old: ov, New: nv})
+		}
+	}
+	for field, ov := range old {
+		if _, ok := new[field]; !ok {
+			changes = append(changes, FieldChange{Field: field, Old: ov})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+// IDs are mostly numeric, so order by length first to keep "2" before "10".
+func sortedIDs(defs map[string]*Entry) []string {
+	ids := make([]string, 0, len(defs))
+	for id := range defs {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if len(ids[i]) != len(ids[j]) {
+			return len(ids[i]) < len(ids[j])
+		}
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+// Markdown renders the diff for the analysis report, listing at most limit entries per group.
+func (d *SchemaDiff) Markdown(limit int) string {
+	if d.IsEmpty() {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("## Item Schema Changes\n\n")
+	for _, section := range d.Sections {
+		sb.WriteString(fmt.Sprintf("### %s (+%d / -%d / ~%d)\n", section.Kind, len(section.Added), len(section.Removed), len(section.Changed)))
+		for i, e := range section.Added {
+			if i >= limit {
+				sb.WriteString(fmt.Sprintf("... and %d more\n", len(section.Added)-limit))
+				break
+			}
+			sb.WriteString("+ `" + e.Name + "` (" + e.ID + ")\n")
+		}
+		for i, e := range section.Removed {
+			if i >= limit {
+				sb.WriteString(fmt.Sprintf("... and %d more\n", len(section.Removed)-limit))
+				break
+			}
+			sb.WriteString("- `" + e.Name + "` (" + e.ID + ")\n")
+		}
+		for i, c := range section.Changed {
+			if i >= limit {
+				sb.WriteString(fmt.Sprintf("... and %d more\n", len(section.Changed)-limit))
+				break
+			}
+			sb.WriteString(fmt.Sprintf("~ `%s` (%s): %d field(s)\n", c.Name, c.ID, len(c.Changes)))
+			for _, fc := range c.Changes {
+				sb.WriteString(fmt.Sprintf("    %s: `%s` → `%s`\n", fc.Field, fc.Old, fc.New))
+			}
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
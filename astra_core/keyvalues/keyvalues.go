@@ -0,0 +1,275 @@
+package keyvalues
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// Node is a single KeyValues entry. Sections have Children, leaves have a Value.
+type Node struct {
+	Key      string
+	Value    string
+	Children []*Node
+	section  bool
+}
+
+func (n *Node) IsSection() bool {
+	return n.section
+}
+
+// Child returns the first direct child with the given key (case-insensitive, like the engine).
+func (n *Node) Child(key string) *Node {
+	for _, c := range n.Children {
+		if strings.EqualFold(c.Key, key) {
+			return c
+		}
+	}
+	return nil
+}
+
+// ChildrenNamed returns every direct child with the given key. items_game.txt
+// repeats top-level blocks such as "items", so callers should merge them.
+func (n *Node) ChildrenNamed(key string) []*Node {
+	var out []*Node
+	for _, c := range n.Children {
+		if strings.EqualFold(c.Key, key) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func (n *Node) Get(key string) string {
+	if c := n.Child(key); c != nil && !c.section {
+		return c.Value
+	}
+	return ""
+}
+
+// Flatten returns all leaf values under n keyed by their slash-joined path.
+// Duplicate paths keep the last value.
+func (n *Node) Flatten() map[string]string {
+	out := make(map[string]string)
+	var walk func(prefix string, node *Node)
+	walk = func(prefix string, node *Node) {
+		for _, c := range node.Children {
+			path := c.Key
+			if prefix != "" {
+				path = prefix + "/" + c.Key
+			}
+			if c.section {
+				walk(path, c)
+			} else {
+				out[path] = c.Value
+			}
+		}
+	}
+	walk("", n)
+	return out
+}
+
+// Parse reads Valve KeyValues text and returns a synthetic root section
+// holding every top-level entry.
+func Parse(data []byte) (*Node, error) {
+	p := &parser{data: decodeText(data), line: 1}
+	root := &Node{section: true}
+	if err := p.parseBody(root, false); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// decodeText normalizes input to UTF-8. Older localization files are UTF-16
+// with a byte order mark.
+func decodeText(data []byte) []byte {
+	var order binary.ByteOrder
+	switch {
+	case len(data) >= 2 && data[0] == 0xFF && data[1] == 0xFE:
+		order = binary.LittleEndian
+	case len(data) >= 2 && data[0] == 0xFE && data[1] == 0xFF:
+		order = binary.BigEndian
+	default:
+		return bytes.TrimPrefix(data, utf8BOM)
+	}
+
+	units := make([]uint16, 0, len(data)/2-1)
+	for i := 2; i+1 < len(data); i += 2 {
+		units = append(units, order.Uint16(data[i:]))
+	}
+	return []byte(string(utf16.Decode(units)))
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokString
+	tokOpen
+	tokClose
+	tokConditional
+)
+
+type parser struct {
+	data []byte
+	pos  int
+	line int
+}
+
+func (p *parser) parseBody(parent *Node, nested bool) error {
+	for {
+		kind, key, err := p.next()
+		if err != nil {
+			return err
+		}
+
+		switch kind {
+		case tokEOF:
+			if nested {
+				return fmt.Errorf("keyvalues: unexpected EOF, missing '}' (line %d)", p.line)
+			}
+			return nil
+		case tokClose:
+			if !nested {
+				return fmt.Errorf("keyvalues: unexpected '}' (line %d)", p.line)
+			}
+			return nil
+		case tokConditional:
+			continue
+		case tokOpen:
+			return fmt.Errorf("keyvalues: unexpected '{' without key (line %d)", p.line)
+		}
+
+		kind, value, err := p.next()
+		if err != nil {
+			return err
+		}
+		// A conditional between key and value/section applies to the entry; we keep it regardless.
+		for kind == tokConditional {
+			if kind, value, err = p.next(); err != nil {
+				return err
+			}
+		}
+
+		switch kind {
+		case tokString:
+			parent.Children = append(parent.Children, &Node{Key: key, Value: value})
+			p.skipConditional()
+		case tokOpen:
+			child := &Node{Key: key, section: true}
+			if err := p.parseBody(child, true); err != nil {
+				return err
+			}
+			parent.Children = append(parent.Children, child)
+		default:
+			return fmt.Errorf("keyvalues: key %q has no value (line %d)", key, p.line)
+		}
+	}
+}
+
+func (p *parser) skipConditional() {
+	save, saveLine := p.pos, p.line
+	kind, _, err := p.next()
+	if err != nil || kind != tokConditional {
+		p.pos, p.line = save, saveLine
+	}
+}
+
+func (p *parser) skipSpaceAndComments() {
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		switch {
+		case c == '\n':
+			p.line++
+			p.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case c == '/' && p.pos+1 < len(p.data) && p.data[p.pos+1] == '/':
+			for p.pos < len(p.data) && p.data[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) next() (tokenKind, string, error) {
+	p.skipSpaceAndComments()
+	if p.pos >= len(p.data) {
+		return tokEOF, "", nil
+	}
+
+	switch c := p.data[p.pos]; c {
+	case '{':
+		p.pos++
+		return tokOpen, "", nil
+	case '}':
+		p.pos++
+		return tokClose, "", nil
+	case '[':
+		end := p.pos
+		for end < len(p.data) && p.data[end] != ']' && p.data[end] != '\n' {
+			end++
+		}
+		cond := string(p.data[p.pos:end])
+		if end < len(p.data) && p.data[end] == ']' {
+			end++
+		}
+		p.pos = end
+		return tokConditional, cond, nil
+	case '"':
+		return p.quoted()
+	default:
+		start := p.pos
+		for p.pos < len(p.data) {
+			c := p.data[p.pos]
+			if c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '{' || c == '}' || c == '"' {
+				break
+			}
+			p.pos++
+		}
+		return tokString, string(p.data[start:p.pos]), nil
+	}
+}
+
+func (p *parser) quoted() (tokenKind, string, error) {
+	startLine := p.line
+	p.pos++ // opening quote
+
+	var sb strings.Builder
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		switch c {
+		case '"':
+			p.pos++
+			return tokString, sb.String(), nil
+		case '\\':
+			if p.pos+1 < len(p.data) {
+				p.pos++
+				switch esc := p.data[p.pos]; esc {
+				case 'n':
+					sb.WriteByte('\n')
+				case 't':
+					sb.WriteByte('\t')
+				case '\\', '"':
+					sb.WriteByte(esc)
+				default:
+					sb.WriteByte('\\')
+					sb.WriteByte(esc)
+				}
+				p.pos++
+				continue
+			}
+		case '\n':
+			p.line++
+		}
+		sb.WriteByte(c)
+		p.pos++
+	}
+	return tokEOF, "", fmt.Errorf("keyvalues: unterminated string starting at line %d", startLine)
+}
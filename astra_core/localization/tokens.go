@@ -0,0 +1,262 @@
+package localization
+
+import (
+	"astra_core/keyvalues"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Matches resource/csgo_english.txt, resource/localization/gameui_schinese.txt, ...
+var localizationFileRegex = regexp.MustCompile(`^resource/(?:.*/)?[a-z0-9_]+_([a-z]+)\.txt$`)
+
+// Steam's API language names, which Valve uses as localization file suffixes.
+var languages = map[string]bool{
+	"english": true, "brazilian": true, "bulgarian": true, "czech": true, "danish": true,
+	"dutch": true, "finnish": true, "french": true, "german": true, "greek": true,
+	"hungarian": true, "indonesian": true, "italian": true, "japanese": true, "koreana": true,
+	"latam": true, "norwegian": true, "polish": true, "portuguese": true, "romanian": true,
+	"russian": true, "schinese": true, "spanish": true, "swedish": true, "tchinese": true,
+	"thai": true, "turkish": true, "ukrainian": true, "vietnamese": true,
+}
+
+// IsLocalizationFile reports whether a game path looks like a token table and returns its language.
+func IsLocalizationFile(gamePath string) (string, bool) {
+	m := localizationFileRegex.FindStringSubmatch(strings.ToLower(gamePath))
+	if m == nil || !languages[m[1]] {
+		return "", false
+	}
+	return m[1], true
+}
+
+type File struct {
+	Language string
+	Tokens   map[string]string
+}
+
+// ParseFile reads a "lang" { "Language" ... "Tokens" { ... } } table.
+// Token names are case-insensitive in the engine, so they are lower-cased here.
+func ParseFile(data []byte) (*File, error) {
+	root, err := keyvalues.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	lang := root.Child("lang")
+	if lang == nil {
+		return nil, fmt.Errorf("localization: missing \"lang\" root")
+	}
+	tokens := lang.Child("Tokens")
+	if tokens == nil {
+		return nil, fmt.Errorf("localization: missing \"Tokens\" block")
+	}
+
+	f := &File{
+		Language: strings.ToLower(lang.Get("Language")),
+		Tokens:   make(map[string]string, len(tokens.Children)),
+	}
+	for _, t := range tokens.Children {
+		if t.IsSection() {
+			continue
+		}
+		// [english]-prefixed entries are the source text kept in translated files
+		if strings.HasPrefix(t.Key, "[english]") {
+			continue
+		}
+		f.Tokens[strings.ToLower(t.Key)] = t.Value
+	}
+	return f, nil
+}
+
+// Table is every token of one language, merged across files.
+type Table struct {
+	Language string
+	Files    []string
+	Tokens   map[string]string
+}
+
+// Merge adds a parsed file to the per-language tables, keyed by language.
+func Merge(tables map[string]*Table, gamePath string, f *File) {
+	lang, _ := IsLocalizationFile(gamePath)
+	if lang == "" {
+		lang = f.Language
+	}
+
+	t, ok := tables[lang]
+	if !ok {
+		t = &Table{Language: lang, Tokens: make(map[string]string)}
+		tables[lang] = t
+	}
+	t.Files = append(t.Files, path.Base(gamePath))
+	for k, v := range f.Tokens {
+		t.Tokens[k] = v
+	}
+}
+
+type Token struct {
+	Token string `json:"token"`
+	Value string `json:"value"`
+}
+
+type TokenChange struct {
+	Token string `json:"token"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+type LanguageDiff struct {
+	Language string        `json:"language"`
+	Files    []string      `json:"files,omitempty"`
+	Added    []Token       `json:"added,omitempty"`
+	Removed  []Token       `json:"removed,omitempty"`
+	Changed  []TokenChange `json:"changed,omitempty"`
+}
+
+func (l *LanguageDiff) Total() int {
+	return len(l.Added) + len(l.Removed) + len(l.Changed)
+}
+
+type Diff struct {
+	Languages []LanguageDiff `json:"languages"`
+}
+
+func (d *Diff) IsEmpty() bool {
+	return d == nil || len(d.Languages) == 0
+}
+
+// Language returns the diff for lang, or nil if it did not change.
+func (d *Diff) Language(lang string) *LanguageDiff {
+	if d == nil {
+		return nil
+	}
+	for i := range d.Languages {
+		if d.Languages[i].Language == lang {
+			return &d.Languages[i]
+		}
+	}
+	return nil
+}
+
+// Primary returns English if it changed, otherwise the language with the most changes.
+// English is the source language, so new features land there first.
+func (d *Diff) Primary() *LanguageDiff {
+	if d.IsEmpty() {
+		return nil
+	}
+	if en := d.Language("english"); en != nil {
+		return en
+	}
+	best := &d.Languages[0]
+	for i := range d.Languages {
+		if d.Languages[i].Total() > best.Total() {
+			best = &d.Languages[i]
+		}
+	}
+	return best
+}
+
+// Compare diffs token tables per language. Languages missing on one side are
+// reported as fully added or removed.
+func Compare(old, new map[string]*Table) *Diff {
+	langs := make(map[string]bool)
+	for l := range old {
+		langs[l] = true
+	}
+	for l := range new {
+		langs[l] = true
+	}
+
+	sortedLangs := make([]string, 0, len(langs))
+	for l := range langs {
+		sortedLangs = append(sortedLangs, l)
+	}
+	sort.Strings(sortedLangs)
+
+	result := &Diff{}
+	for _, lang := range sortedLangs {
+		var oldTokens, newTokens map[string]string
+		ld := LanguageDiff{Language: lang}
+		if t, ok := old[lang]; ok {
+			oldTokens = t.Tokens
+		}
+		if t, ok := new[lang]; ok {
+			newTokens = t.Tokens
+			ld.Files = t.Files
+		}
+
+		for _, k := range sortedKeys(newTokens) {
+			nv := newTokens[k]
+			ov, exists := oldTokens[k]
+			if !exists {
+				ld.Added = append(ld.Added, Token{Token: k, Value: nv})
+			} else if ov != nv {
+				ld.Changed = append(ld.Changed, TokenChange{Token: k, Old: ov, New: nv})
+			}
+		}
+		for _, k := range sortedKeys(oldTokens) {
+			if _, exists := newTokens[k]; !exists {
+				ld.Removed = append(ld.Removed, Token{Token: k, Value: oldTokens[k]})
+			}
+		}
+
+		if ld.Total() > 0 {
+			result.Languages = append(result.Languages, ld)
+		}
+	}
+	return result
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Markdown renders the primary language in full (up to limit per group) and a count line for the rest.
+func (d *Diff) Markdown(limit int) string {
+	primary := d.Primary()
+	if primary == nil {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("## Localization Changes\n\n")
+	sb.WriteString(fmt.Sprintf("### %s (+%d / -%d / ~%d)\n", primary.Language, len(primary.Added), len(primary.Removed), len(primary.Changed)))
+	for i, t := range primary.Added {
+		if i >= limit {
+			sb.WriteString(fmt.Sprintf("... and %d more\n", len(primary.Added)-limit))
+			break
+		}
+		sb.WriteString(fmt.Sprintf("+ `%s`: %s\n", t.Token, t.Value))
+	}
+	for i, t := range primary.Removed {
+		if i >= limit {
+			sb.WriteString(fmt.Sprintf("... and %d more\n", len(primary.Removed)-limit))
+			break
+		}
+		sb.WriteString(fmt.Sprintf("- `%s`: %s\n", t.Token, t.Value))
+	}
+	for i, c := range primary.Changed {
+		if i >= limit {
+			sb.WriteString(fmt.Sprintf("... and %d more\n", len(primary.Changed)-limit))
+			break
+		}
+		sb.WriteString(fmt.Sprintf("~ `%s`: %s → %s\n", c.Token, c.Old, c.New))
+	}
+
+	var others []string
+	for _, l := range d.Languages {
+		if l.Language != primary.Language {
+			others = append(others, fmt.Sprintf("%s (%d)", l.Language, l.Total()))
+		}
+	}
+	if len(others) > 0 {
+		sb.WriteString("\n**Other languages:** " + strings.Join(others, ", ") + "\n")
+	}
+	return sb.String()
+}
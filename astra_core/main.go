@@ -3,7 +3,10 @@ package main
 import (
 	"astra_core/api"
 	"astra_core/database"
+	"astra_core/depot"
+	"astra_core/extractor"
 	"astra_core/monitor"
+	"astra_core/rules"
 	"log"
 	"os"
 	"os/signal"
@@ -19,8 +22,24 @@ func getEnv(key, fallback string) string {
 }
 
 func main() {
+	if rulesPath := os.Getenv("RULES_PATH"); rulesPath != "" {
+		engine, err := rules.Load(rulesPath)
+		if err != nil {
+			log.Fatalf("Failed to load rules: %v", err)
+		}
+		rules.SetActive(engine)
+	}
+
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
 	log.Println("Starting Astra Core...")
 
+	if err := depot.LockCache(); err != nil {
+		log.Fatalf("Failed to lock the depot cache: %v", err)
+	}
+
 	dbPath := getEnv("DB_PATH", "astranet.db")
 	db, err := database.NewDB(dbPath)
 	if err != nil {
@@ -41,8 +60,47 @@ func main() {
 	apiPort := getEnv("API_PORT", "8080")
 
 	mon := monitor.NewMonitor(appID, db)
+	if v, err := strconv.ParseBool(os.Getenv("NOTIFY_UPDATES")); err == nil {
+		mon.SetUpdateNotifications(v)
+	}
+
+	budget := extractor.DefaultBudget()
+	if v, err := strconv.Atoi(os.Getenv("EXTRACT_WORKERS")); err == nil && v > 0 {
+		budget.Workers = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("EXTRACT_MEMORY_MB")); err == nil && v > 0 {
+		budget.MemoryBytes = int64(v) << 20
+	}
+	log.Printf("Extraction budget: %d workers, %d MB", budget.Workers, budget.MemoryBytes>>20)
+	mon.SetExtractionBudget(budget)
+
+	noise := extractor.DefaultNoiseConfig()
+	if v, err := strconv.ParseFloat(os.Getenv("NOISE_MAX_ENTROPY"), 64); err == nil && v > 0 {
+		noise.MaxEntropy = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("NOISE_MIN_ENTROPY_LENGTH")); err == nil && v > 0 {
+		noise.MinEntropyLength = v
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("NOISE_MAX_SYMBOL_RATIO"), 64); err == nil && v > 0 {
+		noise.MaxSymbolRatio = v
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("NOISE_VOLATILE_RATIO"), 64); err == nil && v > 0 {
+		noise.VolatileRatio = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("NOISE_VOLATILE_MIN_BUILDS")); err == nil && v > 0 {
+		noise.VolatileMinBuilds = v
+	}
+	mon.SetNoiseConfig(noise)
+
+	if v, err := strconv.Atoi(os.Getenv("JOB_CONCURRENCY")); err == nil && v > 0 {
+		mon.SetJobConcurrency(v)
+	}
 
 	apiServer := api.NewServer(mon)
+	apiServer.SetImportRoot(os.Getenv("IMPORT_ROOT"))
+	if v, err := strconv.Atoi(os.Getenv("IMPORT_MAX_UPLOAD_MB")); err == nil && v > 0 {
+		apiServer.SetMaxImportUpload(int64(v) << 20)
+	}
 	go apiServer.Start(":" + apiPort)
 
 	go mon.Start()
@@ -0,0 +1,174 @@
+package monitor
+
+import (
+	"astra_core/diff"
+	"astra_core/extractor"
+	"encoding/json"
+	"log"
+	"os"
+)
+
+// Kinds of per-build binary analysis stored in the database.
+const (
+	artifactSymbols   = "symbols"
+	artifactClasses   = "classes"
+	artifactBuild     = "build"
+	artifactFunctions = "functions"
+)
+
+// analyzeBinary runs the structural stages (build metadata, symbol tables, RTTI classes,
+// function hashes) for one binary. Results are stored per build so the old side can come from the
+// database instead of the old download.
+func (m *Monitor) analyzeBinary(u *resultUpdates, change diff.DepotChange, relPath, newFile, oldFile string) {
+	m.analyzeBuild(u, change, relPath, newFile, oldFile)
+	m.analyzeSymbols(u, change, relPath, newFile, oldFile)
+	m.analyzeClasses(u, change, relPath, newFile, oldFile)
+	m.analyzeFunctions(u, change, relPath, newFile, oldFile)
+}
+
+func (m *Monitor) analyzeBuild(u *resultUpdates, change diff.DepotChange, relPath, newFile, oldFile string) {
+	newInfo, err := extractor.ExtractBuildInfo(newFile)
+	if err != nil {
+		log.Printf("Build info extraction failed for %s: %v", relPath, err)
+		return
+	}
+	m.saveArtifact(change, change.NewGID, relPath, artifactBuild, newInfo)
+
+	// Without an old side oldInfo stays nil and the binary is reported as new.
+	var oldInfo *extractor.BuildInfo
+	m.loadOrExtractOld(change, relPath, oldFile, artifactBuild, &oldInfo, func(path string) (any, error) {
+		return extractor.ExtractBuildInfo(path)
+	})
+
+	build := extractor.CompareBuildInfo(relPath, oldInfo, newInfo)
+	log.Printf("Build info for %s: %s, version %q", relPath, build.Status, newInfo.Version())
+	u.add(func(result *diff.DiffResult) { m.tracker.EnhanceWithBuild(result, build) })
+}
+
+// GetBuildInfo returns the stored build metadata of every binary of a build, by file.
+func (m *Monitor) GetBuildInfo(depotID int, manifestID string) (map[string]*extractor.BuildInfo, error) {
+	artifacts, err := m.db.GetBinaryArtifacts(m.appID, depotID, manifestID, artifactBuild)
+	if err != nil {
+		return nil, err
+	}
+	infos := make(map[string]*extractor.BuildInfo, len(artifacts))
+	for file, data := range artifacts {
+		var info extractor.BuildInfo
+		if err := json.Unmarshal(data, &info); err != nil {
+			return nil, err
+		}
+		infos[file] = &info
+	}
+	return infos, nil
+}
+
+func (m *Monitor) analyzeSymbols(u *resultUpdates, change diff.DepotChange, relPath, newFile, oldFile string) {
+	newTable, err := extractor.ExtractSymbolTable(newFile)
+	if err != nil {
+		log.Printf("Symbol extraction failed for %s: %v", relPath, err)
+		return
+	}
+	m.saveArtifact(change, change.NewGID, relPath, artifactSymbols, newTable)
+
+	var oldTable *extractor.SymbolTable
+	if !m.loadOrExtractOld(change, relPath, oldFile, artifactSymbols, &oldTable, func(path string) (any, error) {
+		return extractor.ExtractSymbolTable(path)
+	}) {
+		return
+	}
+
+	symDiff := extractor.CompareSymbolTables(relPath, oldTable, newTable)
+	log.Printf("Symbol diff for %s: +%d/-%d exports, +%d/-%d imports", relPath,
+		len(symDiff.AddedExports), len(symDiff.RemovedExports), len(symDiff.AddedImports), len(symDiff.RemovedImports))
+	u.add(func(result *diff.DiffResult) { m.tracker.EnhanceWithSymbols(result, symDiff) })
+}
+
+func (m *Monitor) analyzeClasses(u *resultUpdates, change diff.DepotChange, relPath, newFile, oldFile string) {
+	newClasses, err := extractor.ExtractClasses(newFile)
+	if err != nil {
+		log.Printf("RTTI extraction failed for %s: %v", relPath, err)
+		return
+	}
+	log.Printf("Recovered %d RTTI classes from %s", len(newClasses), relPath)
+	m.saveArtifact(change, change.NewGID, relPath, artifactClasses, newClasses)
+
+	var oldClasses []extractor.ClassInfo
+	if !m.loadOrExtractOld(change, relPath, oldFile, artifactClasses, &oldClasses, func(path string) (any, error) {
+		return extractor.ExtractClasses(path)
+	}) {
+		return
+	}
+
+	classDiff := extractor.CompareClasses(relPath, oldClasses, newClasses)
+	log.Printf("Class diff for %s: +%d/-%d, %d rebased", relPath, len(classDiff.Added), len(classDiff.Removed), len(classDiff.Rebased))
+	u.add(func(result *diff.DiffResult) { m.tracker.EnhanceWithClasses(result, classDiff) })
+}
+
+func (m *Monitor) analyzeFunctions(u *resultUpdates, change diff.DepotChange, relPath, newFile, oldFile string) {
+	newTable, err := extractor.ExtractFunctions(newFile)
+	if err != nil {
+		log.Printf("Function extraction failed for %s: %v", relPath, err)
+		return
+	}
+	log.Printf("Disassembled %d functions from %s (%s)", len(newTable.Functions), relPath, newTable.Source)
+	m.saveArtifact(change, change.NewGID, relPath, artifactFunctions, newTable)
+
+	var oldTable *extractor.FunctionTable
+	if !m.loadOrExtractOld(change, relPath, oldFile, artifactFunctions, &oldTable, func(path string) (any, error) {
+		return extractor.ExtractFunctions(path)
+	}) {
+		return
+	}
+
+	funcDiff := extractor.CompareFunctions(relPath, oldTable, newTable)
+	log.Printf("Function diff for %s: %s", relPath, funcDiff.Summary())
+	u.add(func(result *diff.DiffResult) { m.tracker.EnhanceWithFunctions(result, funcDiff) })
+}
+
+// loadOrExtractOld fills out with the old build's artifact, preferring the stored
+// copy and falling back to extracting (and storing) it from oldFile.
+// It returns false when there is no old side to compare against.
+func (m *Monitor) loadOrExtractOld(change diff.DepotChange, relPath, oldFile, kind string, out any, extract func(string) (any, error)) bool {
+	if change.OldGID == "" {
+		return false
+	}
+	if m.loadArtifact(change, change.OldGID, relPath, kind, out) {
+		return true
+	}
+	if oldFile == "" {
+		return false
+	}
+	if _, err := os.Stat(oldFile); err != nil {
+		return false
+	}
+
+	value, err := extract(oldFile)
+	if err != nil {
+		return false
+	}
+	m.saveArtifact(change, change.OldGID, relPath, kind, value)
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(data, out) == nil
+}
+
+func (m *Monitor) saveArtifact(change diff.DepotChange, manifestID, relPath, kind string, value any) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	if err := m.db.SaveBinaryArtifact(m.appID, mustAtoi(change.ID), manifestID, relPath, kind, data); err != nil {
+		log.Printf("Failed to store %s for %s: %v", kind, relPath, err)
+	}
+}
+
+func (m *Monitor) loadArtifact(change diff.DepotChange, manifestID, relPath, kind string, out any) bool {
+	data, err := m.db.GetBinaryArtifact(m.appID, mustAtoi(change.ID), manifestID, relPath, kind)
+	if err != nil || data == nil {
+		return false
+	}
+	return json.Unmarshal(data, out) == nil
+}
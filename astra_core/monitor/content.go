@@ -0,0 +1,177 @@
+package monitor
+
+import (
+	"astra_core/diff"
+	"astra_core/extractor"
+	"astra_core/items"
+	"astra_core/localization"
+	"astra_core/panorama"
+	"log"
+)
+
+// analyzeGameContent runs the text-asset stages (item schema, localization, Panorama) over the
+// loose files and VPKs of the old and new depot downloads.
+func (m *Monitor) analyzeGameContent(result *diff.DiffResult, oldPath, newPath string) {
+	newFS, err := extractor.OpenGameFS(newPath)
+	if err != nil {
+		log.Printf("Failed to index game files in %s: %v", newPath, err)
+		return
+	}
+
+	var oldFS *extractor.GameFS
+	if oldPath != "" {
+		if oldFS, err = extractor.OpenGameFS(oldPath); err != nil {
+			log.Printf("Failed to index old game files in %s: %v", oldPath, err)
+		}
+	}
+
+	m.analyzeItemSchema(result, oldFS, newFS)
+	m.analyzeLocalization(result, oldFS, newFS)
+	m.analyzePanorama(result, oldFS, newFS)
+}
+
+func (m *Monitor) analyzeItemSchema(result *diff.DiffResult, oldFS, newFS *extractor.GameFS) {
+	newSchema := loadItemSchema(newFS)
+	if newSchema == nil {
+		return
+	}
+	// Without a previous schema every definition would show up as new.
+	oldSchema := loadItemSchema(oldFS)
+	if oldSchema == nil {
+		log.Println("No previous items_game.txt to compare against, skipping schema diff")
+		return
+	}
+
+	schemaDiff := items.CompareSchemas(oldSchema, newSchema)
+	log.Printf("Item schema diff: %d section(s) changed", len(schemaDiff.Sections))
+	m.tracker.EnhanceWithItemSchema(result, schemaDiff)
+}
+
+func loadItemSchema(gfs *extractor.GameFS) *items.Schema {
+	if gfs == nil {
+		return nil
+	}
+	data, err := gfs.ReadFile(items.SchemaPath)
+	if err != nil {
+		return nil
+	}
+	schema, err := items.ParseSchema(data)
+	if err != nil {
+		log.Printf("Failed to parse %s from %s: %v", items.SchemaPath, gfs.Source(items.SchemaPath), err)
+		return nil
+	}
+	return schema
+}
+
+func (m *Monitor) analyzeLocalization(result *diff.DiffResult, oldFS, newFS *extractor.GameFS) {
+	newTables, newUnread := loadLocalization(newFS)
+	if len(newTables) == 0 {
+		return
+	}
+	oldTables, oldUnread := loadLocalization(oldFS)
+	if len(oldTables) == 0 {
+		log.Println("No previous localization files to compare against, skipping token diff")
+		return
+	}
+	// A language one side lists but cannot read in full, as in a delta
+	// download, is not compared.
+	for lang := range newUnread {
+		delete(oldTables, lang)
+		delete(newTables, lang)
+	}
+	for lang := range oldUnread {
+		delete(oldTables, lang)
+		delete(newTables, lang)
+	}
+
+	locDiff := localization.Compare(oldTables, newTables)
+	log.Printf("Localization diff: %d language(s) changed", len(locDiff.Languages))
+	m.tracker.EnhanceWithLocalization(result, locDiff)
+}
+
+// loadLocalization parses the localization tables of a build, and returns
+// the languages with a file it lists but could not read.
+func loadLocalization(gfs *extractor.GameFS) (map[string]*localization.Table, map[string]bool) {
+	if gfs == nil {
+		return nil, nil
+	}
+
+	tables := make(map[string]*localization.Table)
+	unread := make(map[string]bool)
+	paths := gfs.Glob(func(p string) bool {
+		_, ok := localization.IsLocalizationFile(p)
+		return ok
+	})
+	for _, p := range paths {
+		data, err := gfs.ReadFile(p)
+		if err != nil {
+			log.Printf("Failed to read %s: %v", p, err)
+			lang, _ := localization.IsLocalizationFile(p)
+			unread[lang] = true
+			continue
+		}
+		f, err := localization.ParseFile(data)
+		if err != nil {
+			// resource/ also holds non-token files (fonts, layouts) with language suffixes
+			continue
+		}
+		localization.Merge(tables, p, f)
+	}
+	return tables, unread
+}
+
+func (m *Monitor) analyzePanorama(result *diff.DiffResult, oldFS, newFS *extractor.GameFS) {
+	newFiles, newUnread := loadPanorama(newFS)
+	if len(newFiles) == 0 {
+		return
+	}
+	oldFiles, oldUnread := loadPanorama(oldFS)
+	if len(oldFiles) == 0 {
+		log.Println("No previous Panorama files to compare against, skipping UI diff")
+		return
+	}
+	// A file one side lists but cannot read was not fetched; it is neither
+	// added nor removed.
+	for src := range newUnread {
+		delete(oldFiles, src)
+	}
+	for src := range oldUnread {
+		delete(newFiles, src)
+	}
+
+	pd := diff.ComparePanorama(oldFiles, newFiles)
+	log.Printf("Panorama diff: %d file(s) changed, %d new id(s), %d new event(s)", len(pd.Files), len(pd.NewIDs), len(pd.NewEvents))
+	m.tracker.EnhanceWithPanorama(result, pd)
+}
+
+// loadPanorama decodes the Panorama files of a build, and returns the
+// sources of those it lists but could not read.
+func loadPanorama(gfs *extractor.GameFS) (map[string]panorama.File, map[string]bool) {
+	if gfs == nil {
+		return nil, nil
+	}
+
+	files := make(map[string]panorama.File)
+	unread := make(map[string]bool)
+	paths := gfs.Glob(func(p string) bool {
+		_, ok := panorama.Kind(p)
+		return ok
+	})
+	for _, p := range paths {
+		kind, _ := panorama.Kind(p)
+		data, err := gfs.ReadFile(p)
+		if err != nil {
+			log.Printf("Failed to read %s: %v", p, err)
+			unread[panorama.SourcePath(p)] = true
+			continue
+		}
+		text, err := panorama.Decode(p, data)
+		if err != nil {
+			log.Printf("Failed to decode %s: %v", p, err)
+			continue
+		}
+		src := panorama.SourcePath(p)
+		files[src] = panorama.File{Path: src, Kind: kind, Text: text}
+	}
+	return files, unread
+}
@@ -0,0 +1,346 @@
+package monitor
+
+import (
+	"astra_core/depot"
+	"astra_core/diff"
+	"astra_core/vpk"
+	"context"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// deltaDownload downloads only the changed files of interest of both builds
+// into sparse cache entries, instead of fetching the whole depot twice.
+// Changed VPKs are fetched in two steps: their _dir.vpk first, then only the
+// data archives holding content entries that differ between the builds.
+// The paths returned are views of the two builds holding just those files,
+// since either build may be cached whole or hold files of earlier deltas;
+// release removes them. newPath is empty when no file of interest changed.
+func (m *Monitor) deltaDownload(ctx context.Context, change diff.DepotChange, mc *manifestChange, progress depot.ProgressFunc) (oldPath, newPath string, release func(), err error) {
+	release = func() {}
+	m.downloader.CleanupOldCache()
+	depotID := mustAtoi(change.ID)
+
+	changed := append(append([]string{}, mc.diff.Added...), mc.diff.Changed...)
+	newFiles := deltaFiles(mc.new, changed)
+	if len(newFiles) == 0 {
+		log.Printf("No changed files of interest in depot %s, skipping download", change.ID)
+		return "", "", release, nil
+	}
+	log.Printf("Delta download of depot %s: %d of %d file(s)", change.ID, len(newFiles), len(mc.new.Files))
+
+	newPath, err = m.downloader.DownloadFiles(ctx, depotID, mc.new, newFiles, progress)
+	if err != nil {
+		return "", "", release, err
+	}
+	oldPath = m.deltaOldPath(ctx, change, mc.old, newFiles, progress)
+
+	var dirs []string
+	for _, f := range newFiles {
+		if strings.HasSuffix(strings.ToLower(f), "_dir.vpk") {
+			dirs = append(dirs, f)
+		}
+	}
+	newArchives, oldArchives := vpkArchives(mc.new, mc.old, newPath, oldPath, dirs)
+	if len(newArchives) > 0 {
+		log.Printf("Delta download of depot %s: %d VPK data archive(s)", change.ID, len(newArchives))
+		if newPath, err = m.downloader.DownloadFiles(ctx, depotID, mc.new, newArchives, progress); err != nil {
+			return "", "", release, err
+		}
+	}
+	if len(oldArchives) > 0 {
+		path, err := m.downloader.DownloadFiles(ctx, depotID, mc.old, oldArchives, progress)
+		if err != nil {
+			log.Printf("Delta download of old VPK archives of build %s failed: %v", change.OldGID, err)
+		} else {
+			oldPath = path
+		}
+	}
+
+	newView, err := deltaView(newPath, append(newFiles, newArchives...))
+	if err != nil {
+		return "", "", release, err
+	}
+	release = func() { os.RemoveAll(newView) }
+	if oldPath == "" {
+		return "", newView, release, nil
+	}
+	oldView, err := deltaView(oldPath, append(newFiles, oldArchives...))
+	if err != nil {
+		log.Printf("Failed to set up the old side of the delta of build %s: %v", change.OldGID, err)
+		return "", newView, release, nil
+	}
+	release = func() {
+		os.RemoveAll(newView)
+		os.RemoveAll(oldView)
+	}
+	return oldView, newView, release, nil
+}
+
+// deltaView links the given files of a build, those it has, into a temporary
+// directory. Both sides of a delta are compared through such views, so a
+// file neither side fetched cannot show up as added or removed.
+func deltaView(root string, files []string) (string, error) {
+	view, err := os.MkdirTemp("", "astranet-delta-*")
+	if err != nil {
+		return "", err
+	}
+	for _, f := range files {
+		src := filepath.Join(root, filepath.FromSlash(f))
+		if _, err := os.Stat(src); err != nil {
+			continue
+		}
+		dst := filepath.Join(view, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			os.RemoveAll(view)
+			return "", err
+		}
+		if err := os.Symlink(src, dst); err != nil && !os.IsExist(err) {
+			os.RemoveAll(view)
+			return "", err
+		}
+	}
+	return view, nil
+}
+
+// deltaOldPath fetches the old side of the delta files. Binaries the old
+// build has a string set for are skipped; their artifacts come from the
+// database.
+func (m *Monitor) deltaOldPath(ctx context.Context, change diff.DepotChange, old *depot.Manifest, files []string, progress depot.ProgressFunc) string {
+	depotID := mustAtoi(change.ID)
+	if path, ok := m.downloader.CachedPath(depotID, change.OldGID); ok {
+		return path
+	}
+	indexed, err := m.db.StringFiles(m.appID, depotID, change.OldGID)
+	if err != nil {
+		log.Printf("Failed to check string index for build %s: %v", change.OldGID, err)
+	}
+
+	inOld := make(map[string]bool, len(old.Files))
+	for _, f := range old.Files {
+		inOld[strings.ToLower(f.Name)] = true
+	}
+	var oldFiles []string
+	for _, f := range files {
+		if !inOld[strings.ToLower(f)] || (indexed[f] && isBinaryFile(f)) {
+			continue
+		}
+		oldFiles = append(oldFiles, f)
+	}
+	if len(oldFiles) == 0 {
+		return ""
+	}
+
+	oldPath, err := m.downloader.DownloadFiles(ctx, depotID, old, oldFiles, progress)
+	if err != nil {
+		log.Printf("Delta download of old build %s failed: %v", change.OldGID, err)
+		return ""
+	}
+	return oldPath
+}
+
+// carryForwardIndex gives the new build the old build's string sets and
+// binary artifacts for the binaries the manifest diff reports unchanged,
+// which a delta download never fetches. The new build is marked indexed once
+// every one of its binaries has a string set, so the next delta can take the
+// old side of any binary from the database.
+func (m *Monitor) carryForwardIndex(result *diff.DiffResult, change diff.DepotChange, mc *manifestChange) {
+	depotID := mustAtoi(change.ID)
+	changed := make(map[string]bool)
+	for _, f := range append(append([]string{}, mc.diff.Added...), mc.diff.Changed...) {
+		changed[strings.ToLower(f)] = true
+	}
+
+	var binaries []string
+	for _, f := range mc.new.Files {
+		if f.IsDir() || !isBinaryFile(f.Name) {
+			continue
+		}
+		binaries = append(binaries, f.Name)
+		if changed[strings.ToLower(f.Name)] {
+			continue
+		}
+		if _, err := m.db.CopyFileIndex(m.appID, depotID, change.OldGID, change.NewGID, f.Name, changeNumber(result.NewVersion)); err != nil {
+			log.Printf("Failed to carry the index of %s forward to build %s: %v", f.Name, change.NewGID, err)
+		}
+	}
+	if len(binaries) == 0 {
+		return
+	}
+
+	indexed, err := m.db.StringFiles(m.appID, depotID, change.NewGID)
+	if err != nil {
+		log.Printf("Failed to check string index for build %s: %v", change.NewGID, err)
+		return
+	}
+	for _, f := range binaries {
+		if !indexed[f] {
+			log.Printf("Build %s of depot %s is partly indexed: %s has no string set", change.NewGID, change.ID, f)
+			return
+		}
+	}
+	m.markIndexed(result, change, len(binaries))
+}
+
+// deltaFiles picks the changed files the analysis reads, plus what they need
+// to be read from a sparse tree: gameinfo.gi files, which mark the mod roots,
+// and the _dir.vpk of every changed VPK. Data archives are left to
+// vpkArchives, which picks them from the directory.
+func deltaFiles(manifest *depot.Manifest, changed []string) []string {
+	want := make(map[string]bool)
+	vpkSets := make(map[string]bool)
+	for _, f := range changed {
+		if !isBinaryFile(f) && !isContentFile(f) {
+			continue
+		}
+		if set, ok := vpkSet(f); ok {
+			vpkSets[set] = true
+			continue
+		}
+		want[strings.ToLower(f)] = true
+	}
+	if len(want) == 0 && len(vpkSets) == 0 {
+		return nil
+	}
+
+	var files []string
+	for _, f := range manifest.Files {
+		if f.IsDir() {
+			continue
+		}
+		lower := strings.ToLower(f.Name)
+		set, isVPK := vpkSet(f.Name)
+		isDir := isVPK && strings.HasSuffix(lower, "_dir.vpk") && vpkSets[set]
+		if want[lower] || path.Base(lower) == "gameinfo.gi" || isDir {
+			files = append(files, f.Name)
+		}
+	}
+	return files
+}
+
+// vpkArchives returns, for each side, the data archives that hold the content
+// entries of the given _dir.vpk files that were added, changed or removed
+// between the builds. The content stages leave out entries that one side
+// lists but cannot read, such as unchanged entries of archives not fetched.
+// Without the old directory every content entry counts as changed; a
+// directory that cannot be read falls back to all of its archives.
+func vpkArchives(newManifest, oldManifest *depot.Manifest, newRoot, oldRoot string, dirs []string) (newFiles, oldFiles []string) {
+	newNames := manifestNames(newManifest)
+	oldNames := manifestNames(oldManifest)
+	newSet := make(map[string]bool)
+	oldSet := make(map[string]bool)
+	add := func(files []string, seen map[string]bool, names map[string]string, root, dataPath string) []string {
+		if dataPath == "" {
+			return files
+		}
+		rel, err := filepath.Rel(root, dataPath)
+		if err != nil {
+			return files
+		}
+		name, ok := names[strings.ToLower(filepath.ToSlash(rel))]
+		if !ok || seen[name] {
+			return files
+		}
+		seen[name] = true
+		return append(files, name)
+	}
+
+	for _, dir := range dirs {
+		newDir, err := vpk.Open(filepath.Join(newRoot, filepath.FromSlash(dir)))
+		if err != nil {
+			log.Printf("Failed to read %s, fetching all of its archives: %v", dir, err)
+			set, _ := vpkSet(dir)
+			for lower, name := range newNames {
+				if s, ok := vpkSet(lower); ok && s == set && !newSet[name] && lower != strings.ToLower(dir) {
+					newSet[name] = true
+					newFiles = append(newFiles, name)
+				}
+			}
+			continue
+		}
+		var oldDir *vpk.Archive
+		if oldRoot != "" {
+			if oldDir, err = vpk.Open(filepath.Join(oldRoot, filepath.FromSlash(dir))); err != nil {
+				oldDir = nil
+			}
+		}
+
+		for _, p := range newDir.Files() {
+			if !isContentFile("/" + p) {
+				continue
+			}
+			e, _ := newDir.Entry(p)
+			if oldDir != nil {
+				if old, ok := oldDir.Entry(p); ok {
+					if old.CRC == e.CRC && old.Size() == e.Size() {
+						continue
+					}
+					oldFiles = add(oldFiles, oldSet, oldNames, oldRoot, oldDir.DataPath(old))
+				}
+			}
+			newFiles = add(newFiles, newSet, newNames, newRoot, newDir.DataPath(e))
+		}
+		if oldDir == nil {
+			continue
+		}
+		for _, p := range oldDir.Files() {
+			if _, ok := newDir.Entry(p); ok || !isContentFile("/"+p) {
+				continue
+			}
+			old, _ := oldDir.Entry(p)
+			oldFiles = add(oldFiles, oldSet, oldNames, oldRoot, oldDir.DataPath(old))
+		}
+	}
+	sort.Strings(newFiles)
+	sort.Strings(oldFiles)
+	return newFiles, oldFiles
+}
+
+// manifestNames maps the lowercased file names of a manifest to their own.
+func manifestNames(m *depot.Manifest) map[string]string {
+	names := make(map[string]string)
+	if m == nil {
+		return names
+	}
+	for _, f := range m.Files {
+		if !f.IsDir() {
+			names[strings.ToLower(f.Name)] = f.Name
+		}
+	}
+	return names
+}
+
+// isContentFile reports the game files the content stages read: VPKs, the
+// item schema, localization tables and Panorama sources.
+func isContentFile(p string) bool {
+	p = strings.ToLower(p)
+	switch {
+	case strings.HasSuffix(p, ".vpk"):
+		return true
+	case path.Base(p) == "items_game.txt":
+		return true
+	case strings.Contains(p, "/resource/") && strings.HasSuffix(p, ".txt"):
+		return true
+	case strings.Contains(p, "/panorama/"):
+		return true
+	}
+	return false
+}
+
+// vpkSet returns the archive set of a VPK file: pak01_dir.vpk and
+// pak01_003.vpk both belong to pak01.
+func vpkSet(p string) (string, bool) {
+	p = strings.ToLower(p)
+	if !strings.HasSuffix(p, ".vpk") {
+		return "", false
+	}
+	i := strings.LastIndex(p, "_")
+	if i < 0 {
+		return "", false
+	}
+	return p[:i], true
+}
@@ -0,0 +1,292 @@
+package monitor
+
+import (
+	"astra_core/database"
+	"astra_core/depot"
+	"astra_core/diff"
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// fakeDownloader serves builds from memory: manifest id -> file -> content.
+// With keepFull, full downloads stay cached like the real cache's.
+type fakeDownloader struct {
+	root       string
+	builds     map[string]map[string]string
+	downloaded map[string][]string // manifest id -> files fetched
+	keepFull   bool
+	full       map[string]string // manifest id -> cached full build
+	pins       map[int][]string  // depot id -> pinned manifest ids
+}
+
+func newFakeDownloader(t *testing.T, builds map[string]map[string]string) *fakeDownloader {
+	return &fakeDownloader{root: t.TempDir(), builds: builds, downloaded: make(map[string][]string), full: make(map[string]string), pins: make(map[int][]string)}
+}
+
+func (f *fakeDownloader) manifest(depotID int, manifestID string) (*depot.Manifest, error) {
+	files, ok := f.builds[manifestID]
+	if !ok {
+		return nil, fmt.Errorf("no build %s", manifestID)
+	}
+	m := &depot.Manifest{DepotID: depotID, ManifestID: manifestID}
+	for name, content := range files {
+		sum := sha1.Sum([]byte(content))
+		m.Files = append(m.Files, depot.ManifestFile{Name: name, Size: uint64(len(content)), SHA1: hex.EncodeToString(sum[:])})
+	}
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Name < m.Files[j].Name })
+	return m, nil
+}
+
+func (f *fakeDownloader) write(dir, manifestID string, names []string) error {
+	for _, name := range names {
+		content, ok := f.builds[manifestID][name]
+		if !ok {
+			return fmt.Errorf("no file %s in build %s", name, manifestID)
+		}
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return err
+		}
+		f.downloaded[manifestID] = append(f.downloaded[manifestID], name)
+	}
+	return nil
+}
+
+func (f *fakeDownloader) DownloadDepot(_ context.Context, depotID int, manifestID string, _ string, _ depot.ProgressFunc) (string, error) {
+	dir := filepath.Join(f.root, fmt.Sprintf("%d_%s", depotID, manifestID))
+	var names []string
+	for name := range f.builds[manifestID] {
+		names = append(names, name)
+	}
+	if err := f.write(dir, manifestID, names); err != nil {
+		return "", err
+	}
+	if f.keepFull {
+		f.full[manifestID] = dir
+	}
+	return dir, nil
+}
+
+func (f *fakeDownloader) DownloadFiles(_ context.Context, depotID int, m *depot.Manifest, files []string, _ depot.ProgressFunc) (string, error) {
+	if dir, ok := f.full[m.ManifestID]; ok {
+		return dir, nil
+	}
+	dir := filepath.Join(f.root, fmt.Sprintf("%d_%s.sparse", depotID, m.ManifestID))
+	return dir, f.write(dir, m.ManifestID, files)
+}
+
+func (f *fakeDownloader) FetchManifest(_ context.Context, depotID int, manifestID string) (*depot.Manifest, error) {
+	return f.manifest(depotID, manifestID)
+}
+
+func (f *fakeDownloader) LoadStoredManifest(depotID int, manifestID string) (*depot.Manifest, error) {
+	return f.manifest(depotID, manifestID)
+}
+
+func (f *fakeDownloader) CachedPath(depotID int, manifestID string) (string, bool) {
+	dir, ok := f.full[manifestID]
+	return dir, ok
+}
+
+func (f *fakeDownloader) Import(int, string, string, depot.ImportOptions) (*depot.CacheEntry, error) {
+	return nil, fmt.Errorf("not supported")
+}
+
+func (f *fakeDownloader) PinBuilds(depotID int, manifestIDs ...string) {
+	f.pins[depotID] = manifestIDs
+}
+
+func (f *fakeDownloader) CleanupOldCache() error                     { return nil }
+func (f *fakeDownloader) Usage() depot.CacheUsage                    { return depot.CacheUsage{} }
+func (f *fakeDownloader) Evict(string) (int64, error)                { return 0, depot.ErrNotCached }
+func (f *fakeDownloader) Verify(string) (*depot.VerifyResult, error) { return nil, depot.ErrNotCached }
+func (f *fakeDownloader) VerifyAll() []depot.VerifyResult            { return nil }
+
+func dllContent(strs ...string) string {
+	return "\x00\x00" + strings.Join(strs, "\x00\x00") + "\x00\x00"
+}
+
+// runDepotJob runs the analysis job of one depot change and returns its result.
+func runDepotJob(t *testing.T, m *Monitor, oldChange, newChange, oldGID, newGID string) *diff.DiffResult {
+	t.Helper()
+	change := diff.DepotChange{ID: "11", Name: "test", OldGID: oldGID, NewGID: newGID}
+	result := &diff.DiffResult{OldVersion: oldChange, NewVersion: newChange, ChangedDepots: []diff.DepotChange{change}}
+	u := &pendingUpdate{result: result}
+	u.remaining.Store(1)
+	if err := m.runJob(m.newJob(u, change, true)); err != nil {
+		t.Fatalf("job %s -> %s: %v", oldGID, newGID, err)
+	}
+	return result
+}
+
+func TestDeltaUpdatesInARow(t *testing.T) {
+	alpha := []string{"weapon_alpha_rifle_damage", "weapon_alpha_rifle_spread"}
+	bravo := []string{"weapon_bravo_pistol_damage", "weapon_bravo_pistol_spread"}
+	dl := newFakeDownloader(t, map[string]map[string]string{
+		"100": {"bin/alpha.dll": dllContent(alpha...), "bin/bravo.dll": dllContent(bravo...)},
+		"200": {"bin/alpha.dll": dllContent(append(alpha, "weapon_alpha_rifle_recoil")...), "bin/bravo.dll": dllContent(bravo...)},
+		"300": {"bin/alpha.dll": dllContent(append(alpha, "weapon_alpha_rifle_recoil")...), "bin/bravo.dll": dllContent(append(bravo, "weapon_bravo_pistol_recoil")...)},
+	})
+	db, err := database.NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewMonitorWith(730, db, nil, dl, nil)
+
+	runDepotJob(t, m, "", "1", "", "100")
+
+	result := runDepotJob(t, m, "1", "2", "100", "200")
+	if got := result.NewStrings; !slices.Equal(got, []string{"weapon_alpha_rifle_recoil"}) {
+		t.Errorf("first delta: new strings %q, want only the added one", got)
+	}
+	if slices.Contains(dl.downloaded["200"], "bin/bravo.dll") {
+		t.Errorf("first delta downloaded the unchanged bravo.dll")
+	}
+	if indexed, _ := db.HasStringBuild(730, 11, "200"); !indexed {
+		t.Errorf("build 200 is not marked indexed after carrying its unchanged binary forward")
+	}
+
+	// bravo.dll did not change in the first delta, so its old side must come
+	// from the index carried forward to build 200.
+	result = runDepotJob(t, m, "2", "3", "200", "300")
+	if got := result.NewStrings; !slices.Equal(got, []string{"weapon_bravo_pistol_recoil"}) {
+		t.Errorf("second delta: new strings %q, want only the added one", got)
+	}
+	if slices.Contains(dl.downloaded["200"], "bin/bravo.dll") {
+		t.Errorf("second delta downloaded the old bravo.dll although build 200 is indexed")
+	}
+}
+
+// vpkFile is one entry of a generated VPK: its data archive and content.
+type vpkFile struct {
+	archive uint16
+	data    string
+}
+
+// makeVPK builds a v1 VPK set: <base>_dir.vpk and its numbered data
+// archives, keyed by file name.
+func makeVPK(base string, files map[string]vpkFile) map[string]string {
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var tree []byte
+	archives := make(map[uint16][]byte)
+	le32 := func(v uint32) []byte { return binary.LittleEndian.AppendUint32(nil, v) }
+	le16 := func(v uint16) []byte { return binary.LittleEndian.AppendUint16(nil, v) }
+	for _, name := range names {
+		f := files[name]
+		dir, file := path.Split(name)
+		ext := path.Ext(file)
+		tree = append(tree, ext[1:]+"\x00"+strings.TrimSuffix(dir, "/")+"\x00"+strings.TrimSuffix(file, ext)+"\x00"...)
+		tree = append(tree, le32(crc32.ChecksumIEEE([]byte(f.data)))...)
+		tree = append(tree, le16(0)...)
+		tree = append(tree, le16(f.archive)...)
+		tree = append(tree, le32(uint32(len(archives[f.archive])))...)
+		tree = append(tree, le32(uint32(len(f.data)))...)
+		tree = append(tree, le16(0xffff)...)
+		tree = append(tree, "\x00\x00"...) // end of names, end of directories
+		archives[f.archive] = append(archives[f.archive], f.data...)
+	}
+	tree = append(tree, 0)
+
+	out := map[string]string{
+		base + "_dir.vpk": string(append(append(append(le32(0x55aa1234), le32(1)...), le32(uint32(len(tree)))...), tree...)),
+	}
+	for index, data := range archives {
+		out[fmt.Sprintf("%s_%03d.vpk", base, index)] = string(data)
+	}
+	return out
+}
+
+func TestDeltaFetchesOnlyChangedVPKArchives(t *testing.T) {
+	build := func(english, model string) map[string]string {
+		return makeVPK("game/csgo/pak01", map[string]vpkFile{
+			"resource/csgo_english.txt":   {0, english},
+			"panorama/layout/hud.xml":     {1, "<root><Panel id=\"hud\"/></root>"},
+			"models/weapons/rifle.vmdl_c": {2, model},
+		})
+	}
+	dl := newFakeDownloader(t, map[string]map[string]string{
+		"100": build(`"lang" { "Tokens" { "Rifle" "Rifle" } }`, "model v1"),
+		"200": build(`"lang" { "Tokens" { "Rifle" "Rifle" "Pistol" "Pistol" } }`, "model v2"),
+	})
+	db, err := database.NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewMonitorWith(730, db, nil, dl, nil)
+
+	runDepotJob(t, m, "", "1", "", "100")
+	dl.downloaded = make(map[string][]string)
+	result := runDepotJob(t, m, "1", "2", "100", "200")
+
+	want := []string{"game/csgo/pak01_000.vpk", "game/csgo/pak01_dir.vpk"}
+	for _, manifestID := range []string{"100", "200"} {
+		got := append([]string(nil), dl.downloaded[manifestID]...)
+		sort.Strings(got)
+		if !slices.Equal(got, want) {
+			t.Errorf("build %s: downloaded %q, want %q", manifestID, got, want)
+		}
+	}
+	if result.Localization == nil || len(result.Localization.Languages) != 1 || len(result.Localization.Languages[0].Added) != 1 {
+		t.Errorf("localization diff %+v, want the one added token", result.Localization)
+	}
+}
+
+func TestDeltaAgainstCachedFullBuild(t *testing.T) {
+	build := func(english, layout string) map[string]string {
+		files := makeVPK("game/csgo/pak01", map[string]vpkFile{
+			"panorama/layout/mainmenu.xml": {0, layout},
+			"panorama/layout/hud.xml":      {1, "<root><Panel id=\"hud\"/></root>"},
+		})
+		files["game/csgo/gameinfo.gi"] = `"GameInfo" { FileSystem { SearchPaths { Game csgo } } }`
+		files["game/csgo/resource/csgo_english.txt"] = english
+		files["game/csgo/resource/csgo_german.txt"] = `"lang" { "Tokens" { "Rifle" "Gewehr" } }`
+		files["game/csgo/panorama/scripts/loose.js"] = "function loose() {}"
+		return files
+	}
+	dl := newFakeDownloader(t, map[string]map[string]string{
+		"100": build(`"lang" { "Tokens" { "Rifle" "Rifle" } }`, `<root><Panel id="menu"/></root>`),
+		"200": build(`"lang" { "Tokens" { "Rifle" "Rifle" "Pistol" "Pistol" } }`, `<root><Panel id="menu"/><Panel id="news"/></root>`),
+	})
+	dl.keepFull = true
+	db, err := database.NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewMonitorWith(730, db, nil, dl, nil)
+
+	runDepotJob(t, m, "", "1", "", "100")
+	result := runDepotJob(t, m, "1", "2", "100", "200")
+
+	loc := result.Localization
+	if loc == nil || len(loc.Languages) != 1 || loc.Languages[0].Language != "english" || len(loc.Languages[0].Added) != 1 || len(loc.Languages[0].Removed) != 0 {
+		t.Errorf("localization diff %+v, want one token added in english only", loc)
+	}
+	var files []string
+	if result.Panorama != nil {
+		for _, f := range result.Panorama.Files {
+			files = append(files, f.Path+" "+f.Status)
+		}
+	}
+	if want := []string{"panorama/layout/mainmenu.xml modified"}; !slices.Equal(files, want) {
+		t.Errorf("panorama files %q, want %q", files, want)
+	}
+}
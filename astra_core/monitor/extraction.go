@@ -0,0 +1,339 @@
+package monitor
+
+import (
+	"astra_core/database"
+	"astra_core/depot"
+	"astra_core/diff"
+	"astra_core/extractor"
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ExtractionProgress is the state of the depot extraction currently running.
+type ExtractionProgress struct {
+	DepotID string `json:"depot_id"`
+	extractor.Progress
+}
+
+// resultUpdates collects one file's changes to the shared DiffResult. Workers
+// never touch the result directly; updates are applied in walk order once the
+// pool is done, so the output does not depend on scheduling.
+type resultUpdates []func(*diff.DiffResult)
+
+func (u *resultUpdates) add(f func(*diff.DiffResult)) {
+	*u = append(*u, f)
+}
+
+func (m *Monitor) SetExtractionBudget(b extractor.Budget) {
+	m.budget = b
+}
+
+func (m *Monitor) SetNoiseConfig(c extractor.NoiseConfig) {
+	m.noise = c
+}
+
+func (m *Monitor) GetNoiseConfig() extractor.NoiseConfig {
+	return m.noise
+}
+
+func (m *Monitor) GetExtractionProgress() *ExtractionProgress {
+	m.progressMu.Lock()
+	defer m.progressMu.Unlock()
+	if m.progress == nil {
+		return nil
+	}
+	p := *m.progress
+	return &p
+}
+
+func (m *Monitor) setProgress(depotID string, p extractor.Progress) {
+	m.progressMu.Lock()
+	if m.progress == nil || p.FilesDone > m.progress.FilesDone {
+		log.Printf("Extraction progress for depot %s: %d/%d files, %d/%d MB",
+			depotID, p.FilesDone, p.FilesTotal, p.BytesDone>>20, p.BytesTotal>>20)
+	}
+	m.progress = &ExtractionProgress{DepotID: depotID, Progress: p}
+	m.progressMu.Unlock()
+
+	m.extractionProgress(depotID, p)
+}
+
+func (m *Monitor) clearProgress() {
+	m.progressMu.Lock()
+	m.progress = nil
+	m.progressMu.Unlock()
+}
+
+// fileJob is one binary to extract, with the builds it is compared between.
+type fileJob struct {
+	change     diff.DepotChange
+	relPath    string
+	path       string
+	oldFile    string // may be empty or missing when the old side comes from the database
+	oldVersion string
+	newVersion string
+}
+
+func isBinaryFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".exe", ".dll", ".so", ".dylib":
+		return true
+	}
+	return false
+}
+
+func fileSize(path string) int64 {
+	if path == "" {
+		return 0
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// extractBinaries runs extractFile for every binary on the worker pool and
+// reports whether all of them were indexed. Once ctx is done no further file
+// is started, and the result is left as it was.
+// The memory cost of a file is estimated as the size of both sides, since the
+// structural stages read whole sections of the old and new binary.
+func (m *Monitor) extractBinaries(ctx context.Context, result *diff.DiffResult, change diff.DepotChange, oldPath, newPath string, binaries []string) (bool, error) {
+	start := time.Now()
+	updates := make([]resultUpdates, len(binaries))
+	tasks := make([]extractor.Task, 0, len(binaries))
+	var indexed atomic.Int64
+
+	for i, path := range binaries {
+		relPath, _ := filepath.Rel(newPath, path)
+		job := fileJob{
+			change:     change,
+			relPath:    filepath.ToSlash(relPath),
+			path:       path,
+			oldVersion: result.OldVersion,
+			newVersion: result.NewVersion,
+		}
+		if oldPath != "" {
+			job.oldFile = filepath.Join(oldPath, relPath)
+		}
+		size := fileSize(path)
+		tasks = append(tasks, extractor.Task{
+			Name: job.relPath,
+			Size: size,
+			Cost: size + fileSize(job.oldFile),
+			Run: func() {
+				if m.extractFile(&updates[i], job) {
+					indexed.Add(1)
+				}
+			},
+		})
+	}
+
+	pool := extractor.NewPool(m.budget)
+	err := pool.Run(ctx, tasks, func(p extractor.Progress) { m.setProgress(change.ID, p) })
+	m.clearProgress()
+	if err != nil {
+		log.Printf("Extraction of depot %s stopped: %v", change.ID, err)
+		return false, err
+	}
+
+	for _, u := range updates {
+		for _, apply := range u {
+			apply(result)
+		}
+	}
+	log.Printf("Extracted %d binaries from depot %s in %s", len(binaries), change.ID, time.Since(start).Round(time.Millisecond))
+	return int(indexed.Load()) == len(binaries), nil
+}
+
+// markIndexed records that every binary of the new build has a string set.
+// Only a complete build can stand in for the old download next time.
+func (m *Monitor) markIndexed(result *diff.DiffResult, change diff.DepotChange, binaries int) {
+	if err := m.db.MarkStringBuild(m.appID, mustAtoi(change.ID), change.NewGID, changeNumber(result.NewVersion), binaries); err != nil {
+		log.Printf("Failed to mark build %s as indexed: %v", change.NewGID, err)
+	}
+}
+
+// extractFile runs string extraction and the structural stages for one binary
+// and stores its strings in the index. It reports whether the file was indexed.
+// Both sides use the streaming extractor; the old side prefers the index.
+func (m *Monitor) extractFile(u *resultUpdates, job fileJob) bool {
+	log.Printf("Extracting strings from %s...", job.relPath)
+
+	interesting, err := extractor.ExtractAndFilterStrings(job.path)
+	if err != nil {
+		log.Printf("Extraction failed for %s: %v", job.relPath, err)
+		return false
+	}
+	log.Printf("Extracted %d interesting strings from %s", len(interesting), job.relPath)
+
+	indexed := m.indexStrings(job.change, job.change.NewGID, job.relPath, job.newVersion, interesting)
+
+	fileStrings := make([]string, 0, len(interesting))
+	for _, match := range interesting {
+		fileStrings = append(fileStrings, match.Value)
+	}
+	protos := extractor.ExtractProtobufs(fileStrings)
+
+	// Comparação com versão antiga (se existir)
+	oldStrings, hasOld := m.loadOldStrings(job)
+	var added, removed, newStrings []string
+	var modified []extractor.StringModification
+	var addedProtos, removedProtos []extractor.ProtobufMatch
+	var suppressed diff.Suppression
+	if hasOld {
+		added, removed = extractor.CompareStringSets(oldStrings, fileStrings)
+		// Churn is learned from the unfiltered diff.
+		m.recordChurn(job, added, removed)
+		volatile := m.volatileShapes(job)
+		var addedNoise, removedNoise map[string]int
+		added, addedNoise = extractor.FilterNoise(added, m.noise, volatile)
+		removed, removedNoise = extractor.FilterNoise(removed, m.noise, volatile)
+		suppressed = diff.Suppression(addedNoise)
+		suppressed.Merge(removedNoise)
+
+		modified, added, removed = extractor.PairModifiedStrings(added, removed, extractor.ModificationThreshold)
+		addedProtos, removedProtos = extractor.CompareProtobufs(extractor.ExtractProtobufs(oldStrings), protos)
+	} else {
+		var noise map[string]int
+		newStrings, noise = extractor.FilterNoise(fileStrings, m.noise, m.volatileShapes(job))
+		suppressed = diff.Suppression(noise)
+	}
+
+	u.add(func(result *diff.DiffResult) {
+		m.tracker.EnhanceWithSuppression(result, suppressed)
+
+		// Backwards compatibility: without an old side every string is new.
+		if hasOld {
+			result.NewStrings = append(result.NewStrings, added...)
+		} else {
+			result.NewStrings = append(result.NewStrings, newStrings...)
+			for _, proto := range protos {
+				result.NewProtobufs = append(result.NewProtobufs, proto.Name)
+			}
+		}
+
+		if len(fileStrings) > 0 {
+			result.StringBlocks = append(result.StringBlocks, diff.StringBlock{
+				SourceFile: filepath.Base(job.path),
+				Strings:    fileStrings,
+				Category:   strings.ToLower(filepath.Ext(job.path)), // storing extension or generic category
+			})
+		}
+	})
+
+	m.analyzeBinary(u, job.change, job.relPath, job.path, job.oldFile)
+
+	if hasOld {
+		u.add(func(result *diff.DiffResult) {
+			m.tracker.EnhanceWithStringAnalysis(result, job.relPath, added, removed, modified)
+			m.tracker.EnhanceWithProtobufs(result, job.relPath, addedProtos, removedProtos)
+		})
+	}
+	return indexed
+}
+
+// loadOldStrings returns the old build's strings for the file, from the index if
+// the build was indexed before, otherwise by extracting (and indexing) oldFile.
+func (m *Monitor) loadOldStrings(job fileJob) ([]string, bool) {
+	if job.change.OldGID == "" {
+		return nil, false
+	}
+
+	values, found, err := m.db.GetStringSet(m.appID, mustAtoi(job.change.ID), job.change.OldGID, job.relPath)
+	if err != nil {
+		log.Printf("Failed to load indexed strings for old %s: %v", job.relPath, err)
+	}
+	if found {
+		return values, true
+	}
+
+	if job.oldFile == "" {
+		return nil, false
+	}
+	if _, err := os.Stat(job.oldFile); err != nil {
+		return nil, false
+	}
+	oldMatches, err := extractor.ExtractAndFilterStrings(job.oldFile)
+	if err != nil {
+		log.Printf("Extraction failed for old %s: %v", job.relPath, err)
+		return nil, false
+	}
+	m.indexStrings(job.change, job.change.OldGID, job.relPath, job.oldVersion, oldMatches)
+
+	values = make([]string, len(oldMatches))
+	for i, match := range oldMatches {
+		values[i] = match.Value
+	}
+	return values, true
+}
+
+func (m *Monitor) indexStrings(change diff.DepotChange, manifestID, relPath, version string, matches []extractor.StringMatch) bool {
+	strs := make([]database.IndexedString, len(matches))
+	for i, match := range matches {
+		strs[i] = database.IndexedString{Value: match.Value, Category: match.Category}
+	}
+	if err := m.db.SaveStringSet(m.appID, mustAtoi(change.ID), manifestID, relPath, changeNumber(version), strs); err != nil {
+		log.Printf("Failed to index strings of %s (%s): %v", relPath, manifestID, err)
+		return false
+	}
+	return true
+}
+
+func (m *Monitor) recordChurn(job fileJob, added, removed []string) {
+	shapes := extractor.ChurnedShapes(added, removed)
+	if err := m.db.RecordStringChurn(m.appID, mustAtoi(job.change.ID), job.relPath, changeNumber(job.newVersion), shapes); err != nil {
+		log.Printf("Failed to record string churn of %s: %v", job.relPath, err)
+	}
+}
+
+// volatileShapes returns the learned volatile string shapes of the file.
+func (m *Monitor) volatileShapes(job fileJob) map[string]bool {
+	list, err := m.db.GetVolatileStrings(m.appID, mustAtoi(job.change.ID), job.relPath, m.noise.VolatileRatio, m.noise.VolatileMinBuilds)
+	if err != nil {
+		log.Printf("Failed to load volatile strings of %s: %v", job.relPath, err)
+		return nil
+	}
+	shapes := make(map[string]bool, len(list))
+	for _, v := range list {
+		shapes[v.Shape] = true
+	}
+	return shapes
+}
+
+func changeNumber(version string) int64 {
+	n, _ := strconv.ParseInt(version, 10, 64)
+	return n
+}
+
+// oldDepotPath returns the old build's files, downloading them only when the
+// build has not been indexed. For an indexed build the strings and binary
+// artifacts come from the database and only an existing cache entry is used,
+// for the game-content stages.
+func (m *Monitor) oldDepotPath(ctx context.Context, change diff.DepotChange, progress depot.ProgressFunc) string {
+	depotID := mustAtoi(change.ID)
+	indexed, err := m.db.HasStringBuild(m.appID, depotID, change.OldGID)
+	if err != nil {
+		log.Printf("Failed to check string index for build %s: %v", change.OldGID, err)
+	}
+	if indexed {
+		if path, ok := m.downloader.CachedPath(depotID, change.OldGID); ok {
+			return path
+		}
+		log.Printf("Build %s of depot %s is indexed, skipping old download", change.OldGID, change.ID)
+		return ""
+	}
+
+	oldPath, err := m.downloader.DownloadDepot(ctx, depotID, change.OldGID, "", progress)
+	if err != nil {
+		log.Printf("Failed to download old build %s of depot %s: %v", change.OldGID, change.ID, err)
+		return ""
+	}
+	return oldPath
+}
@@ -0,0 +1,156 @@
+package monitor
+
+import (
+	"astra_core/database"
+	"astra_core/depot"
+	"astra_core/diff"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+// AnalyzeRequest asks for an analysis of imported builds of a depot.
+type AnalyzeRequest struct {
+	DepotID     int
+	OldManifest string // build to compare against, cached or indexed; empty for none
+	NewManifest string
+	OldChange   string // change numbers of the builds, for the string index history; optional
+	NewChange   string
+}
+
+// ImportBuild registers local content as a build of a depot. See
+// depot.Downloader.Import. Replacing a build evicts the cached one, so it is
+// refused while a job of the depot runs, and holds off the depot's queued
+// jobs until it is done.
+func (m *Monitor) ImportBuild(depotID int, manifestID, source string, opts depot.ImportOptions) (*depot.CacheEntry, error) {
+	if opts.Replace {
+		id := strconv.Itoa(depotID)
+		m.jobs.mu.Lock()
+		if m.jobs.busy[id] {
+			m.jobs.mu.Unlock()
+			return nil, ErrDepotBusy
+		}
+		m.jobs.busy[id] = true
+		m.jobs.mu.Unlock()
+		defer func() {
+			m.jobs.mu.Lock()
+			delete(m.jobs.busy, id)
+			m.jobs.cond.Broadcast()
+			m.jobs.mu.Unlock()
+		}()
+	}
+	return m.downloader.Import(depotID, manifestID, source, opts)
+}
+
+// QueueAnalysis queues an analysis of imported builds and returns its job.
+// Like an update's analysis it indexes the builds' strings and artifacts, but
+// it never runs steamcmd and its diff does not replace the last update's.
+func (m *Monitor) QueueAnalysis(req AnalyzeRequest) (int64, error) {
+	u, err := m.localUpdate(req)
+	if err != nil {
+		return 0, err
+	}
+	j := m.newJob(u, u.result.ChangedDepots[0], true)
+	m.queueJob(j)
+	return j.rec.ID, nil
+}
+
+// RunAnalysis analyzes imported builds in the calling goroutine, for one-shot
+// commands that run no job workers, and returns the diff.
+func (m *Monitor) RunAnalysis(req AnalyzeRequest) (*diff.DiffResult, error) {
+	u, err := m.localUpdate(req)
+	if err != nil {
+		return nil, err
+	}
+	j := m.newJob(u, u.result.ChangedDepots[0], true)
+	j.rec.Status = database.JobRunning
+	j.rec.StartedAt = time.Now()
+	m.execute(j)
+	<-u.done
+	if j.rec.Error != "" {
+		return u.result, fmt.Errorf("analysis failed: %s", j.rec.Error)
+	}
+	return u.result, nil
+}
+
+func (m *Monitor) localUpdate(req AnalyzeRequest) (*pendingUpdate, error) {
+	if _, ok := m.downloader.CachedPath(req.DepotID, req.NewManifest); !ok {
+		return nil, fmt.Errorf("build %s of depot %d is not cached; import it first", req.NewManifest, req.DepotID)
+	}
+	if req.OldManifest != "" {
+		_, cached := m.downloader.CachedPath(req.DepotID, req.OldManifest)
+		indexed, err := m.db.HasStringBuild(m.appID, req.DepotID, req.OldManifest)
+		if err != nil {
+			return nil, err
+		}
+		if !cached && !indexed {
+			return nil, fmt.Errorf("build %s of depot %d is neither cached nor indexed", req.OldManifest, req.DepotID)
+		}
+	}
+
+	result := &diff.DiffResult{
+		OldVersion: req.OldChange,
+		NewVersion: req.NewChange,
+		Type:       diff.UpdateTypeUnknown,
+		ChangedDepots: []diff.DepotChange{{
+			ID:     strconv.Itoa(req.DepotID),
+			OldGID: req.OldManifest,
+			NewGID: req.NewManifest,
+			Name:   "imported",
+		}},
+	}
+	u := &pendingUpdate{result: result, local: true, done: make(chan struct{})}
+	u.remaining.Store(1)
+	return u, nil
+}
+
+// runLocalJob analyzes cached builds: manifests come from the cache only and
+// nothing is downloaded. Without the old build in the cache its strings and
+// artifacts come from the index.
+func (m *Monitor) runLocalJob(j *depotJob) error {
+	change := j.change
+	depotID := mustAtoi(change.ID)
+	// Jobs of other depots clean up the cache while this one waits for the
+	// analysis lock.
+	m.downloader.PinBuilds(depotID, change.NewGID, change.OldGID)
+
+	m.setJobStage(j, stageManifest)
+	if newManifest, err := m.downloader.LoadStoredManifest(depotID, change.NewGID); err == nil {
+		var oldManifest *depot.Manifest
+		if change.OldGID != "" {
+			oldManifest, err = m.downloader.LoadStoredManifest(depotID, change.OldGID)
+		}
+		if err == nil {
+			md := depot.CompareManifests(oldManifest, newManifest)
+			m.analyzeMu.Lock()
+			m.tracker.EnhanceWithManifestDiff(j.update.result, change, md)
+			m.analyzeMu.Unlock()
+		}
+	}
+
+	newPath, ok := m.downloader.CachedPath(depotID, change.NewGID)
+	if !ok {
+		return fmt.Errorf("build %s of depot %s is not cached", change.NewGID, change.ID)
+	}
+	var oldPath string
+	if change.OldGID != "" {
+		oldPath, _ = m.downloader.CachedPath(depotID, change.OldGID)
+	}
+
+	m.analyzeMu.Lock()
+	defer m.analyzeMu.Unlock()
+	if err := j.ctx.Err(); err != nil {
+		return err
+	}
+	m.setJobStage(j, stageAnalyze)
+	log.Printf("Analyzing imported build %s of depot %s...", change.NewGID, change.ID)
+	binaries, indexed, err := m.extractAndCompare(j.ctx, j.update.result, change, oldPath, newPath)
+	if err != nil {
+		return err
+	}
+	if indexed {
+		m.markIndexed(j.update.result, change, binaries)
+	}
+	return nil
+}
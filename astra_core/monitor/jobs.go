@@ -0,0 +1,466 @@
+package monitor
+
+import (
+	"astra_core/database"
+	"astra_core/depot"
+	"astra_core/diff"
+	"astra_core/extractor"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Job stages.
+const (
+	stageManifest = "manifest"
+	stageDownload = "download"
+	stageAnalyze  = "analyze"
+)
+
+// jobSaveInterval throttles how often progress is written to the database.
+const jobSaveInterval = 2 * time.Second
+
+var (
+	ErrJobNotFound = errors.New("job not found")
+	ErrJobFinished = errors.New("job already finished")
+	ErrDepotBusy   = errors.New("a job of the depot is running")
+)
+
+// depotJob downloads and analyzes one changed depot of an update. Its record
+// is guarded by the queue lock.
+type depotJob struct {
+	rec    database.Job
+	update *pendingUpdate
+	change diff.DepotChange
+	ctx    context.Context
+	cancel context.CancelFunc
+	saved  time.Time
+}
+
+// pendingUpdate is an update whose depot jobs are still running. Its result
+// is finished once the last job ends. A local update analyzes imported builds:
+// it reads only the cache and its result is not published as the last diff.
+type pendingUpdate struct {
+	result    *diff.DiffResult
+	remaining atomic.Int32
+	local     bool
+	done      chan struct{}
+}
+
+// jobQueue runs depot jobs on a fixed number of workers. Jobs of the same
+// depot never run at once, since they write the same cache entries.
+type jobQueue struct {
+	mu          sync.Mutex
+	cond        *sync.Cond
+	concurrency int
+	queue       []*depotJob
+	active      map[int64]*depotJob // queued and running
+	busy        map[string]bool     // depots with a running job or a replacing import
+}
+
+func newJobQueue() *jobQueue {
+	q := &jobQueue{concurrency: 1, active: make(map[int64]*depotJob), busy: make(map[string]bool)}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// SetJobConcurrency sets how many depot jobs run at once. It takes effect
+// when the monitor starts.
+func (m *Monitor) SetJobConcurrency(n int) {
+	if n > 0 {
+		m.jobs.concurrency = n
+	}
+}
+
+// startJobs fails the jobs an earlier run left behind, queues the updates
+// they belonged to again and starts the workers. The saved change number
+// already counts those updates as seen, so nothing else would finish them.
+func (m *Monitor) startJobs() {
+	if n, err := m.db.FailUnfinishedJobs(m.appID, "interrupted by restart"); err != nil {
+		log.Printf("Failed to clean up unfinished jobs: %v", err)
+	} else if n > 0 {
+		log.Printf("Marked %d unfinished job(s) of the previous run as failed", n)
+	}
+	m.resumeUpdates()
+	log.Printf("Starting %d depot job worker(s)", m.jobs.concurrency)
+	for i := 0; i < m.jobs.concurrency; i++ {
+		go m.jobWorker()
+	}
+}
+
+// resumeUpdates queues the depot jobs of every update a previous run did not
+// finish. Jobs that had finished run again too, since their part of the diff
+// was only kept in memory.
+func (m *Monitor) resumeUpdates() {
+	pending, err := m.db.PendingUpdates(m.appID)
+	if err != nil {
+		log.Printf("Failed to load unfinished updates: %v", err)
+		return
+	}
+	for _, data := range pending {
+		var result diff.DiffResult
+		if err := json.Unmarshal(data, &result); err != nil {
+			log.Printf("Skipping unreadable unfinished update: %v", err)
+			continue
+		}
+		log.Printf("Resuming update %s -> %s: %d depot(s)", result.OldVersion, result.NewVersion, len(result.ChangedDepots))
+		m.analyzeDepotChanges(&result)
+	}
+}
+
+// enqueueUpdate queues a job per changed depot of the update. The result is
+// finished right away when no depot changed.
+func (m *Monitor) enqueueUpdate(result *diff.DiffResult, binaryDepots []string) {
+	u := &pendingUpdate{result: result}
+	if len(result.ChangedDepots) == 0 {
+		m.finishUpdate(result)
+		return
+	}
+	u.remaining.Store(int32(len(result.ChangedDepots)))
+	if data, err := json.Marshal(result); err != nil {
+		log.Printf("Failed to encode update %s: %v", result.NewVersion, err)
+	} else if err := m.db.SavePendingUpdate(m.appID, result.NewVersion, data); err != nil {
+		log.Printf("Failed to save update %s: %v", result.NewVersion, err)
+	}
+
+	for _, change := range result.ChangedDepots {
+		m.queueJob(m.newJob(u, change, contains(binaryDepots, change.ID)))
+	}
+}
+
+func (m *Monitor) newJob(u *pendingUpdate, change diff.DepotChange, analyze bool) *depotJob {
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &depotJob{
+		rec: database.Job{
+			AppID:        m.appID,
+			ChangeNumber: u.result.NewVersion,
+			DepotID:      mustAtoi(change.ID),
+			DepotName:    change.Name,
+			OldManifest:  change.OldGID,
+			NewManifest:  change.NewGID,
+			Analyze:      analyze,
+			Status:       database.JobQueued,
+		},
+		update: u,
+		change: change,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	if err := m.db.CreateJob(&j.rec); err != nil {
+		// The job still runs; it just cannot be listed or canceled.
+		log.Printf("Failed to persist job for depot %s: %v", change.ID, err)
+	}
+	return j
+}
+
+func (m *Monitor) queueJob(j *depotJob) {
+	m.jobs.mu.Lock()
+	m.jobs.queue = append(m.jobs.queue, j)
+	if j.rec.ID != 0 {
+		m.jobs.active[j.rec.ID] = j
+	}
+	m.jobs.cond.Signal()
+	m.jobs.mu.Unlock()
+	log.Printf("Queued job %d: depot %s (%s) %s -> %s", j.rec.ID, j.change.ID, j.change.Name, j.change.OldGID, j.change.NewGID)
+}
+
+// next blocks until a job whose depot is idle is queued, and marks it running.
+func (q *jobQueue) next() *depotJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		for i, j := range q.queue {
+			if q.busy[j.change.ID] {
+				continue
+			}
+			q.queue = append(q.queue[:i], q.queue[i+1:]...)
+			q.busy[j.change.ID] = true
+			j.rec.Status = database.JobRunning
+			j.rec.StartedAt = time.Now()
+			return j
+		}
+		q.cond.Wait()
+	}
+}
+
+func (m *Monitor) jobWorker() {
+	for {
+		m.execute(m.jobs.next())
+	}
+}
+
+// execute runs a job marked running and records how it ended.
+func (m *Monitor) execute(j *depotJob) {
+	m.saveJob(j, true)
+
+	err := m.runJob(j)
+
+	m.jobs.mu.Lock()
+	j.rec.FinishedAt = time.Now()
+	switch {
+	case err == nil:
+		j.rec.Status = database.JobDone
+	case errors.Is(err, context.Canceled):
+		j.rec.Status = database.JobCanceled
+		j.rec.Error = "canceled"
+	default:
+		j.rec.Status = database.JobFailed
+		j.rec.Error = err.Error()
+	}
+	delete(m.jobs.busy, j.change.ID)
+	delete(m.jobs.active, j.rec.ID)
+	m.jobs.cond.Broadcast()
+	m.jobs.mu.Unlock()
+	j.cancel()
+
+	m.saveJob(j, true)
+	log.Printf("Job %d (depot %s) %s in %s", j.rec.ID, j.change.ID, j.rec.Status, j.rec.FinishedAt.Sub(j.rec.StartedAt).Round(time.Second))
+	if err != nil {
+		log.Printf("Job %d: %v", j.rec.ID, err)
+	}
+	m.jobEnded(j)
+}
+
+// jobEnded finishes the job's update once all of its jobs are done.
+func (m *Monitor) jobEnded(j *depotJob) {
+	u := j.update
+	if u.remaining.Add(-1) != 0 {
+		return
+	}
+	if u.local {
+		m.completeDiff(u.result)
+		close(u.done)
+		return
+	}
+	m.finishUpdate(u.result)
+}
+
+// runJob fetches the depot's manifests, downloads the builds and analyzes
+// them. Analysis runs one job at a time: it writes the shared result and the
+// extractor pool has its own worker budget.
+func (m *Monitor) runJob(j *depotJob) error {
+	change := j.change
+	if j.update.local {
+		return m.runLocalJob(j)
+	}
+	m.setJobStage(j, stageManifest)
+	mc := m.fetchManifests(j.ctx, change)
+	if err := j.ctx.Err(); err != nil {
+		return err
+	}
+	if mc != nil {
+		m.analyzeMu.Lock()
+		m.tracker.EnhanceWithManifestDiff(j.update.result, change, mc.diff)
+		m.analyzeMu.Unlock()
+	}
+	if !j.rec.Analyze {
+		return nil
+	}
+
+	// The builds being compared must survive cache cleanup.
+	m.downloader.PinBuilds(mustAtoi(change.ID), change.NewGID, change.OldGID)
+	log.Printf("Analyzing depot %s (%s)...", change.ID, change.Name)
+
+	m.setJobStage(j, stageDownload)
+	progress := func(p depot.DownloadProgress) { m.setJobProgress(j, p.Percent, p.BytesDone, p.BytesTotal) }
+	var oldPath, newPath string
+	var err error
+	delta := mc != nil && mc.old != nil
+	if delta {
+		var release func()
+		oldPath, newPath, release, err = m.deltaDownload(j.ctx, change, mc, progress)
+		defer release()
+		if err != nil && j.ctx.Err() == nil {
+			log.Printf("Delta download failed (%v), downloading the full depot", err)
+			delta = false
+			oldPath, newPath, err = m.downloadDepot(j.ctx, change, progress)
+		}
+	} else {
+		// If OldGID is empty, it means it's a new depot or first run.
+		// We still want to analyze it to extract strings.
+		oldPath, newPath, err = m.downloadDepot(j.ctx, change, progress)
+	}
+	if err != nil {
+		if ctxErr := j.ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return fmt.Errorf("download: %w", err)
+	}
+
+	m.analyzeMu.Lock()
+	defer m.analyzeMu.Unlock()
+	if err := j.ctx.Err(); err != nil {
+		return err
+	}
+	if newPath == "" {
+		if delta {
+			// Nothing of interest changed; the new build still inherits the index.
+			m.carryForwardIndex(j.update.result, change, mc)
+		}
+		return nil
+	}
+	m.setJobStage(j, stageAnalyze)
+	binaries, indexed, err := m.extractAndCompare(j.ctx, j.update.result, change, oldPath, newPath)
+	if err != nil {
+		return err
+	}
+	switch {
+	case delta:
+		// A sparse entry holds only the changed binaries.
+		m.carryForwardIndex(j.update.result, change, mc)
+	case indexed:
+		m.markIndexed(j.update.result, change, binaries)
+	}
+	return nil
+}
+
+func (m *Monitor) setJobStage(j *depotJob, stage string) {
+	m.jobs.mu.Lock()
+	j.rec.Stage = stage
+	j.rec.Progress, j.rec.BytesDone, j.rec.BytesTotal = 0, 0, 0
+	m.jobs.mu.Unlock()
+	m.saveJob(j, true)
+}
+
+func (m *Monitor) setJobProgress(j *depotJob, percent float64, done, total int64) {
+	m.jobs.mu.Lock()
+	j.rec.Progress, j.rec.BytesDone, j.rec.BytesTotal = percent, done, total
+	m.jobs.mu.Unlock()
+	m.saveJob(j, false)
+}
+
+// extractionProgress feeds the extractor's progress into the depot's running
+// analysis job.
+func (m *Monitor) extractionProgress(depotID string, p extractor.Progress) {
+	m.jobs.mu.Lock()
+	var job *depotJob
+	for _, j := range m.jobs.active {
+		if j.change.ID == depotID && j.rec.Stage == stageAnalyze {
+			job = j
+			break
+		}
+	}
+	m.jobs.mu.Unlock()
+	if job == nil {
+		return
+	}
+	var percent float64
+	if p.BytesTotal > 0 {
+		percent = float64(p.BytesDone) * 100 / float64(p.BytesTotal)
+	}
+	m.setJobProgress(job, percent, p.BytesDone, p.BytesTotal)
+}
+
+// saveJob persists the job record; progress-only changes are written at most
+// every jobSaveInterval.
+func (m *Monitor) saveJob(j *depotJob, force bool) {
+	if j.rec.ID == 0 {
+		return
+	}
+	m.jobs.mu.Lock()
+	if !force && time.Since(j.saved) < jobSaveInterval {
+		m.jobs.mu.Unlock()
+		return
+	}
+	j.saved = time.Now()
+	rec := j.rec
+	m.jobs.mu.Unlock()
+
+	if err := m.db.UpdateJob(&rec); err != nil {
+		log.Printf("Failed to save job %d: %v", rec.ID, err)
+	}
+}
+
+// GetJobs returns the newest jobs, optionally of one status. Active jobs
+// carry their live progress rather than the last saved one.
+func (m *Monitor) GetJobs(status string, limit int) ([]database.Job, error) {
+	jobs, err := m.db.GetJobs(m.appID, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	m.jobs.mu.Lock()
+	defer m.jobs.mu.Unlock()
+	for i := range jobs {
+		if j := m.jobs.active[jobs[i].ID]; j != nil {
+			jobs[i] = j.rec
+		}
+	}
+	return jobs, nil
+}
+
+// GetJob returns one job, or ErrJobNotFound.
+func (m *Monitor) GetJob(id int64) (*database.Job, error) {
+	m.jobs.mu.Lock()
+	if j := m.jobs.active[id]; j != nil {
+		rec := j.rec
+		m.jobs.mu.Unlock()
+		return &rec, nil
+	}
+	m.jobs.mu.Unlock()
+
+	job, err := m.db.GetJob(id)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil || job.AppID != m.appID {
+		return nil, ErrJobNotFound
+	}
+	return job, nil
+}
+
+// ActiveJobs returns the queued and running jobs, oldest first.
+func (m *Monitor) ActiveJobs() []database.Job {
+	m.jobs.mu.Lock()
+	defer m.jobs.mu.Unlock()
+	jobs := make([]database.Job, 0, len(m.jobs.active))
+	for _, j := range m.jobs.active {
+		jobs = append(jobs, j.rec)
+	}
+	sort.Slice(jobs, func(i, k int) bool { return jobs[i].ID < jobs[k].ID })
+	return jobs
+}
+
+// CancelJob cancels a queued or running job. A running download is killed;
+// an analysis in progress finishes the files being extracted and starts no
+// other.
+func (m *Monitor) CancelJob(id int64) error {
+	m.jobs.mu.Lock()
+	j := m.jobs.active[id]
+	if j == nil {
+		m.jobs.mu.Unlock()
+		if _, err := m.GetJob(id); err != nil {
+			return err
+		}
+		return ErrJobFinished
+	}
+
+	if j.rec.Status == database.JobQueued {
+		for i, queued := range m.jobs.queue {
+			if queued == j {
+				m.jobs.queue = append(m.jobs.queue[:i], m.jobs.queue[i+1:]...)
+				break
+			}
+		}
+		delete(m.jobs.active, id)
+		j.rec.Status = database.JobCanceled
+		j.rec.Error = "canceled"
+		j.rec.FinishedAt = time.Now()
+		m.jobs.mu.Unlock()
+		j.cancel()
+		m.saveJob(j, true)
+		log.Printf("Job %d (depot %s) canceled before it started", id, j.change.ID)
+		m.jobEnded(j)
+		return nil
+	}
+	m.jobs.mu.Unlock()
+
+	log.Printf("Canceling job %d (depot %s)", id, j.change.ID)
+	j.cancel()
+	return nil
+}
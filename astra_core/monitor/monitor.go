@@ -7,44 +7,100 @@ import (
 	"astra_core/extractor"
 	"astra_core/notifier"
 	"astra_core/steamcmd"
+	"context"
 	"encoding/json"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
+// SteamClient fetches the app info the monitor polls. steamcmd.Client
+// implements it.
+type SteamClient interface {
+	Start() error
+	LoginAnonymous() error
+	AppInfoUpdate(appID int) error
+	AppInfoPrint(appID int) (string, error)
+}
+
+// DepotDownloader fetches and caches depot builds. depot.Downloader
+// implements it.
+type DepotDownloader interface {
+	DownloadDepot(ctx context.Context, depotID int, manifestID string, fileFilter string, progress depot.ProgressFunc) (string, error)
+	DownloadFiles(ctx context.Context, depotID int, manifest *depot.Manifest, files []string, progress depot.ProgressFunc) (string, error)
+	FetchManifest(ctx context.Context, depotID int, manifestID string) (*depot.Manifest, error)
+	LoadStoredManifest(depotID int, manifestID string) (*depot.Manifest, error)
+	CachedPath(depotID int, manifestID string) (string, bool)
+	Import(depotID int, manifestID, source string, opts depot.ImportOptions) (*depot.CacheEntry, error)
+	PinBuilds(depotID int, manifestIDs ...string)
+	CleanupOldCache() error
+	Usage() depot.CacheUsage
+	Evict(name string) (int64, error)
+	Verify(name string) (*depot.VerifyResult, error)
+	VerifyAll() []depot.VerifyResult
+}
+
+// Notifier sends update and service status notifications.
+// notifier.DiscordNotifier implements it.
+type Notifier interface {
+	Notify(result *diff.DiffResult) error
+	NotifyStatus(update notifier.StatusUpdate) error
+}
+
 type Monitor struct {
-	client           *steamcmd.Client
+	client           SteamClient
 	db               *database.DB
 	tracker          *diff.Tracker
-	notifier         *notifier.DiscordNotifier
-	downloader       *depot.Downloader
+	notifier         Notifier
+	notifyUpdates    bool
+	downloader       DepotDownloader
 	statusMon        *StatusMonitor
 	appID            int
 	lastChangeNumber string
 	lastDiff         *diff.DiffResult
+	budget           extractor.Budget
+	noise            extractor.NoiseConfig
+
+	progressMu sync.Mutex
+	progress   *ExtractionProgress
+
+	jobs      *jobQueue
+	analyzeMu sync.Mutex // one depot analysis at a time
+	diffMu    sync.Mutex // guards lastDiff
 }
 
 func NewMonitor(appID int, db *database.DB) *Monitor {
-	client := steamcmd.NewClient()
-
 	// notifier now uses DB for multi-webhook support
-	notif := notifier.NewDiscordNotifier(db)
+	return NewMonitorWith(appID, db, steamcmd.NewClient(""), depot.NewDownloader(appID), notifier.NewDiscordNotifier(db))
+}
+
+// NewMonitorWith returns a monitor using the given steamcmd client, depot
+// downloader and notifier, e.g. ones backed by a fake steamcmd. notif may be
+// nil.
+func NewMonitorWith(appID int, db *database.DB, client SteamClient, downloader DepotDownloader, notif Notifier) *Monitor {
 	statMon := NewStatusMonitor(notif)
 
 	return &Monitor{
 		client:     client,
 		db:         db,
-		tracker:    diff.NewTracker(client),
+		tracker:    diff.NewTracker(),
 		notifier:   notif,
-		downloader: depot.NewDownloader(appID),
+		downloader: downloader,
 		statusMon:  statMon,
 		appID:      appID,
+		budget:     extractor.DefaultBudget(),
+		noise:      extractor.DefaultNoiseConfig(),
+		jobs:       newJobQueue(),
 	}
 }
 
+func (m *Monitor) AppID() int {
+	return m.appID
+}
+
 // Webhook Management Proxies
 
 func (m *Monitor) AddWebhook(url string) error {
@@ -59,6 +115,14 @@ func (m *Monitor) GetWebhooks() ([]string, error) {
 	return m.db.GetAllWebhooks()
 }
 
+func (m *Monitor) SearchStrings(q database.StringSearch) ([]database.StringHit, int, error) {
+	return m.db.SearchStrings(q)
+}
+
+func (m *Monitor) GetVolatileStrings() ([]database.VolatileString, error) {
+	return m.db.GetVolatileStrings(m.appID, 0, "", m.noise.VolatileRatio, m.noise.VolatileMinBuilds)
+}
+
 func (m *Monitor) LoadState() {
 	cn, _, _, _, err := m.db.GetAppState(m.appID)
 	if err != nil {
@@ -75,7 +139,9 @@ func (m *Monitor) LoadState() {
 	if diffData != nil {
 		var loadedDiff diff.DiffResult
 		if err := json.Unmarshal(diffData, &loadedDiff); err == nil {
+			m.diffMu.Lock()
 			m.lastDiff = &loadedDiff
+			m.diffMu.Unlock()
 			log.Printf("Loaded last diff: Type=%s, Strings=%d", loadedDiff.Type, len(loadedDiff.NewStrings))
 		}
 	}
@@ -108,6 +174,10 @@ func (m *Monitor) Start() {
 	m.LoadState()
 	log.Printf("Loaded State: ChangeNumber=%s", m.lastChangeNumber)
 
+	// Downloads and analysis run on the job workers, so polling goes on
+	// while they work.
+	m.startJobs()
+
 	// Start Status Monitor
 	if m.statusMon != nil {
 		m.statusMon.Start()
@@ -150,74 +220,165 @@ func (m *Monitor) check() {
 		diffResult := m.tracker.ProcessUpdate(&oldInfo, info)
 		diffResult.RawDiff = diff.GenerateUnifiedDiff(oldRawVDF, output, "old", "new")
 
-		m.analyzeDepotChanges(diffResult, &oldInfo, info)
+		m.analyzeDepotChanges(diffResult)
+		m.handleUpdate(info, output)
+	} else {
+		log.Printf("No changes. Current: %s", info.ChangeNumber)
+	}
+}
+
+// finishUpdate completes a diff once its depot jobs are done and makes it
+// the last diff, unless a newer update finished first.
+func (m *Monitor) finishUpdate(diffResult *diff.DiffResult) {
+	m.completeDiff(diffResult)
+	if err := m.db.DeletePendingUpdate(m.appID, diffResult.NewVersion); err != nil {
+		log.Printf("Failed to clear update %s: %v", diffResult.NewVersion, err)
+	}
 
-		// Optimize: Categorize strings once at ingestion time
-		diffResult.CategorizedStrings = diff.CategorizeStrings(diffResult.NewStrings)
+	m.diffMu.Lock()
+	defer m.diffMu.Unlock()
+	if m.lastDiff != nil && changeNumber(m.lastDiff.NewVersion) > changeNumber(diffResult.NewVersion) {
+		log.Printf("Update %s finished after the newer %s; keeping the newer diff", diffResult.NewVersion, m.lastDiff.NewVersion)
+		return
+	}
+	m.lastDiff = diffResult
 
-		log.Printf("Diff Result: Type=%s, Reason=%s", diffResult.Type, diffResult.TypeReason)
-		m.lastDiff = diffResult
+	// Persist the diff result
+	if diffData, err := json.Marshal(diffResult); err == nil {
+		if err := m.db.SaveLastDiff(m.appID, diffData); err != nil {
+			log.Printf("Failed to save last diff: %v", err)
+		}
+	}
 
-		// Persist the diff result
-		if diffData, err := json.Marshal(diffResult); err == nil {
-			if err := m.db.SaveLastDiff(m.appID, diffData); err != nil {
-				log.Printf("Failed to save last diff: %v", err)
-			}
+	// Game update notifications are off unless enabled, by user request.
+	if m.notifyUpdates && m.notifier != nil {
+		if err := m.notifier.Notify(diffResult); err != nil {
+			log.Printf("Failed to send notification: %v", err)
 		}
+	}
+}
 
-		// Config: Game Update Webhook Notifications disabled by user request.
-		// if m.notifier != nil {
-		// 	if err := m.notifier.Notify(diffResult); err != nil {
-		// 		log.Printf("Failed to send notification: %v", err)
-		// 	}
-		// }
+// SetUpdateNotifications turns game update notifications on or off. Service
+// status notifications are always sent.
+func (m *Monitor) SetUpdateNotifications(enabled bool) {
+	m.notifyUpdates = enabled
+}
 
-		m.handleUpdate(info, output)
+// completeDiff adds the summaries that need every depot's analysis.
+func (m *Monitor) completeDiff(diffResult *diff.DiffResult) {
+	m.tracker.EnhanceWithFileChanges(diffResult)
+	diffResult.Analysis += "\n" + diffResult.Classification.Markdown(5)
+	if md := diffResult.Suppressed.Markdown(); md != "" {
+		diffResult.Analysis += "\n" + md
+	}
+	if md := diff.BuildsMarkdown(diffResult.Builds); md != "" {
+		diffResult.Analysis += "\n" + md
+	}
+
+	// Optimize: Categorize strings once at ingestion time
+	diffResult.CategorizedStrings = diff.CategorizeStrings(diffResult.NewStrings)
+	diffResult.CategorizedRemoved = diff.CategorizeStrings(diffResult.RemovedStrings)
+
+	if top, ok := diffResult.Classification.Top(); ok {
+		log.Printf("Diff Result: Type=%s (%.0f%%), Reason=%s", diffResult.Type, top.Confidence*100, diffResult.TypeReason)
 	} else {
-		log.Printf("No changes. Current: %s", info.ChangeNumber)
+		log.Printf("Diff Result: Type=%s, Reason=%s", diffResult.Type, diffResult.TypeReason)
 	}
 }
 
-func (m *Monitor) analyzeDepotChanges(result *diff.DiffResult, oldInfo, newInfo *steamcmd.AppInfo) {
+// analyzeDepotChanges queues a job per changed depot. Every depot gets its
+// file list from the manifests; binary depots are downloaded and analyzed.
+func (m *Monitor) analyzeDepotChanges(result *diff.DiffResult) {
 	// Depot 735 (Win64) e 734 (Binaries) são placeholders de 8 bytes na versão atual.
 	// Usando apenas 2347779 (CS2 Dedicated Server) que contém os binários reais.
 	binaryDepots := []string{"2347779"}
 	log.Printf("Configured binary depots for analysis: %v", binaryDepots)
 
-	for _, change := range result.ChangedDepots {
-		if !contains(binaryDepots, change.ID) {
-			continue
-		}
+	m.enqueueUpdate(result, binaryDepots)
+}
+
+// manifestChange is the manifest diff of one depot, kept for delta downloads.
+type manifestChange struct {
+	old, new *depot.Manifest // old is nil for a new depot
+	diff     depot.ManifestDiff
+}
 
-		// If OldGID is empty, it means it's a new depot or first run.
-		// We still want to analyze it to extract strings.
-		log.Printf("Analyzing depot %s (%s)...", change.ID, change.Name)
+// GetCacheUsage reports the depot cache entries and their sizes.
+func (m *Monitor) GetCacheUsage() depot.CacheUsage {
+	return m.downloader.Usage()
+}
+
+// EvictCacheEntry removes a cached build and returns the bytes freed.
+func (m *Monitor) EvictCacheEntry(name string) (int64, error) {
+	return m.downloader.Evict(name)
+}
 
-		m.downloadAndAnalyzeDepot(result, change)
+// VerifyCache re-checks a cached build, or all of them when name is empty,
+// and quarantines the corrupt ones. It waits for a running analysis, which
+// may be reading them.
+func (m *Monitor) VerifyCache(name string) ([]depot.VerifyResult, error) {
+	m.analyzeMu.Lock()
+	defer m.analyzeMu.Unlock()
+	if name == "" {
+		return m.downloader.VerifyAll(), nil
+	}
+	result, err := m.downloader.Verify(name)
+	if result == nil {
+		return nil, err
+	}
+	return []depot.VerifyResult{*result}, err
+}
+
+// fetchManifests loads both manifests of a changed depot and diffs them.
+// It returns nil when the new manifest is unavailable.
+func (m *Monitor) fetchManifests(ctx context.Context, change diff.DepotChange) *manifestChange {
+	if change.NewGID == "" {
+		return nil
 	}
+	depotID := mustAtoi(change.ID)
+	newManifest, err := m.downloader.FetchManifest(ctx, depotID, change.NewGID)
+	if err != nil {
+		log.Printf("Failed to get manifest %s of depot %s: %v", change.NewGID, change.ID, err)
+		return nil
+	}
+
+	var oldManifest *depot.Manifest
+	if change.OldGID != "" {
+		oldManifest, err = m.downloader.FetchManifest(ctx, depotID, change.OldGID)
+		if err != nil {
+			log.Printf("Failed to get manifest %s of depot %s: %v", change.OldGID, change.ID, err)
+			return nil
+		}
+	}
+
+	md := depot.CompareManifests(oldManifest, newManifest)
+	log.Printf("Manifest diff for depot %s: %d new, %d changed, %d removed files", change.ID, len(md.Added), len(md.Changed), len(md.Removed))
+	return &manifestChange{old: oldManifest, new: newManifest, diff: md}
 }
 
-func (m *Monitor) downloadAndAnalyzeDepot(result *diff.DiffResult, change diff.DepotChange) {
+// downloadDepot fetches the whole new build, and the old one unless it was
+// indexed before.
+func (m *Monitor) downloadDepot(ctx context.Context, change diff.DepotChange, progress depot.ProgressFunc) (oldPath, newPath string, err error) {
 	m.downloader.CleanupOldCache()
 
-	newPath, err := m.downloader.DownloadDepot(mustAtoi(change.ID), change.NewGID, "")
+	newPath, err = m.downloader.DownloadDepot(ctx, mustAtoi(change.ID), change.NewGID, "", progress)
 	if err != nil {
-		log.Printf("Failed to download new depot: %v", err)
-		return
+		return "", "", err
 	}
 
-	var oldPath string
 	if change.OldGID != "" {
-		oldPath, _ = m.downloader.DownloadDepot(mustAtoi(change.ID), change.OldGID, "")
+		oldPath = m.oldDepotPath(ctx, change, progress)
 	}
-
-	m.extractAndCompare(result, oldPath, newPath)
+	return oldPath, newPath, nil
 }
 
-func (m *Monitor) extractAndCompare(result *diff.DiffResult, oldPath, newPath string) {
+// extractAndCompare analyzes the binaries and game content of a build. It
+// returns how many binaries it found and whether all of them were indexed,
+// or ctx.Err() when ctx is done before the analysis is.
+func (m *Monitor) extractAndCompare(ctx context.Context, result *diff.DiffResult, change diff.DepotChange, oldPath, newPath string) (binaries int, indexed bool, err error) {
 	log.Printf("Starting extraction in %s", newPath)
-	fileCount := 0
 
+	var paths []string
 	filepath.WalkDir(newPath, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
 			return nil
@@ -229,66 +390,28 @@ func (m *Monitor) extractAndCompare(result *diff.DiffResult, oldPath, newPath st
 		// Log all files found for debugging
 		log.Printf("Found file: %s", path)
 
-		ext := strings.ToLower(filepath.Ext(path))
-		if ext != ".exe" && ext != ".dll" && ext != ".so" && ext != ".dylib" {
+		if !isBinaryFile(path) {
 			// Log skipped files to debug "8 bytes" issues
-			log.Printf("Skipping file with extension %s: %s", ext, path)
-			return nil
-		}
-
-		fileCount++
-
-		log.Printf("Extracting strings from %s...", filepath.Base(path))
-
-		// Use optimized streaming extraction to save memory
-		interesting, err := extractor.ExtractAndFilterStrings(path)
-		if err != nil {
-			log.Printf("Extraction failed for %s: %v", filepath.Base(path), err)
+			log.Printf("Skipping file with extension %s: %s", strings.ToLower(filepath.Ext(path)), path)
 			return nil
 		}
-		log.Printf("Extracted %d interesting strings from %s", len(interesting), filepath.Base(path))
-
-		var fileStrings []string
-		for _, match := range interesting {
-			// Backwards compatibility
-			result.NewStrings = append(result.NewStrings, match.Value)
-			fileStrings = append(fileStrings, match.Value)
-		}
-
-		if len(fileStrings) > 0 {
-			result.StringBlocks = append(result.StringBlocks, diff.StringBlock{
-				SourceFile: filepath.Base(path),
-				Strings:    fileStrings,
-				Category:   ext, // storing extension or generic category
-			})
-		}
-
-		protos := extractor.ExtractProtobufs(fileStrings)
-		for _, proto := range protos {
-			result.NewProtobufs = append(result.NewProtobufs, proto.Name)
-		}
-
-		// Comparação com versão antiga (se existir)
-		if oldPath != "" {
-			relPath, _ := filepath.Rel(newPath, path)
-			oldFile := filepath.Join(oldPath, relPath)
-			if _, err := os.Stat(oldFile); err == nil {
-				oldStrings, err := extractor.ExtractStrings(oldFile)
-				if err == nil {
-					added, removed := extractor.CompareStringSets(oldStrings, fileStrings)
-					m.tracker.EnhanceWithStringAnalysis(result, added, removed)
-				}
-			}
-		}
-
+		paths = append(paths, path)
 		return nil
 	})
 
-	if fileCount == 0 {
+	if len(paths) == 0 {
 		log.Printf("WARNING: No meaningful files found in extracted depot path %s. Download might have failed or depot is validly empty.", newPath)
+	} else if indexed, err = m.extractBinaries(ctx, result, change, oldPath, newPath, paths); err != nil {
+		return len(paths), false, err
 	}
+	if err := ctx.Err(); err != nil {
+		return len(paths), false, err
+	}
+
+	m.analyzeGameContent(result, oldPath, newPath)
 
 	// result.Analysis = generateAnalysisSummary(result) // Function not present/needed here
+	return len(paths), indexed && len(paths) > 0, nil
 }
 
 func generateAnalysisSummary(result *diff.DiffResult) string {
@@ -351,14 +474,21 @@ func mustAtoi(s string) int {
 }
 
 type MonitorState struct {
-	ChangeNumber string           `json:"change_number"`
-	BuildID      string           `json:"build_id"`
-	LastDiff     *diff.DiffResult `json:"last_diff,omitempty"`
+	ChangeNumber string              `json:"change_number"`
+	BuildID      string              `json:"build_id"`
+	LastDiff     *diff.DiffResult    `json:"last_diff,omitempty"`
+	Extraction   *ExtractionProgress `json:"extraction,omitempty"`
+	Jobs         []database.Job      `json:"-"` // queued and running
 }
 
 func (m *Monitor) GetState() MonitorState {
+	m.diffMu.Lock()
+	lastDiff := m.lastDiff
+	m.diffMu.Unlock()
 	return MonitorState{
 		ChangeNumber: m.lastChangeNumber,
-		LastDiff:     m.lastDiff,
+		LastDiff:     lastDiff,
+		Extraction:   m.GetExtractionProgress(),
+		Jobs:         m.ActiveJobs(),
 	}
 }
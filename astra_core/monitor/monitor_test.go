@@ -0,0 +1,232 @@
+package monitor
+
+import (
+	"astra_core/database"
+	"astra_core/depot"
+	"astra_core/diff"
+	"astra_core/notifier"
+	"astra_core/steamcmd"
+	"context"
+	"errors"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingNotifier keeps the notifications instead of sending them.
+type recordingNotifier struct {
+	mu      sync.Mutex
+	updates []*diff.DiffResult
+}
+
+func (r *recordingNotifier) Notify(result *diff.DiffResult) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.updates = append(r.updates, result)
+	return nil
+}
+
+func (r *recordingNotifier) NotifyStatus(notifier.StatusUpdate) error { return nil }
+
+func (r *recordingNotifier) sent() []*diff.DiffResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*diff.DiffResult(nil), r.updates...)
+}
+
+// newFakeSteamMonitor builds cmd/fakesteamcmd and returns a monitor whose
+// steamcmd client and depot downloader both run it against a copy of
+// testdata/fakesteamcmd, with its job workers started and update
+// notifications going to the returned recorder.
+func newFakeSteamMonitor(t *testing.T) (*Monitor, *recordingNotifier) {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("builds the fake steamcmd")
+	}
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "steamcmd", "steamcmd.sh")
+	build := exec.Command("go", "build", "-o", exe, "astra_core/cmd/fakesteamcmd")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("build fake steamcmd: %v\n%s", err, out)
+	}
+
+	// The fake keeps its replay position in the fixtures.
+	fixtures := filepath.Join(dir, "fixtures")
+	if err := os.CopyFS(fixtures, os.DirFS("testdata/fakesteamcmd")); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FAKESTEAMCMD_FIXTURES", fixtures)
+	t.Setenv("STEAMCMD_PATH", exe)
+	t.Setenv("DEPOT_CACHE_PATH", filepath.Join(dir, "cache"))
+	t.Setenv("STEAM_USER", "")
+
+	db, err := database.NewDB(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := &recordingNotifier{}
+	m := NewMonitorWith(730, db, steamcmd.NewClient(exe), depot.NewDownloader(730), rec)
+	m.SetUpdateNotifications(true)
+	m.startJobs()
+	return m, rec
+}
+
+// waitForDiff waits until the diff of the given change is published and no
+// job is left.
+func waitForDiff(t *testing.T, m *Monitor, change string) *diff.DiffResult {
+	t.Helper()
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		if d := m.GetState().LastDiff; d != nil && d.NewVersion == change && len(m.ActiveJobs()) == 0 {
+			return d
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("no diff for change %s", change)
+	return nil
+}
+
+func TestCheckWithFakeSteamCmd(t *testing.T) {
+	m, rec := newFakeSteamMonitor(t)
+
+	m.check()
+	first := waitForDiff(t, m, "1000")
+	if !slices.Contains(first.NewStrings, "CMsgFixtureMatchStart") {
+		t.Errorf("first update: new strings %q, want the strings of the first build", first.NewStrings)
+	}
+
+	m.check()
+	second := waitForDiff(t, m, "1001")
+	if second.OldVersion != "1000" {
+		t.Errorf("second update: old version %q, want 1000", second.OldVersion)
+	}
+	i := slices.IndexFunc(second.ChangedDepots, func(c diff.DepotChange) bool { return c.ID == "2347779" })
+	if i < 0 {
+		t.Fatalf("second update: depot 2347779 not among the changed depots %+v", second.ChangedDepots)
+	}
+	if c := second.ChangedDepots[i]; c.OldGID != "1111111111111111111" || c.NewGID != "2222222222222222222" {
+		t.Errorf("second update: depot change %+v, want manifest 1111111111111111111 -> 2222222222222222222", c)
+	}
+	if !slices.Equal(second.NewStrings, []string{"CMsgFixtureRoundMvp"}) {
+		t.Errorf("second update: new strings %q, want only CMsgFixtureRoundMvp", second.NewStrings)
+	}
+	if len(second.RemovedStrings) != 0 {
+		t.Errorf("second update: removed strings %q, want none", second.RemovedStrings)
+	}
+
+	sent := rec.sent()
+	if len(sent) != 2 || sent[1] != second {
+		t.Fatalf("sent %d notification(s), want one per update ending with the second diff", len(sent))
+	}
+	payload, files := notifier.UpdatePayload(sent[1])
+	if len(payload.Embeds) != 1 {
+		t.Fatalf("payload has %d embeds, want 1", len(payload.Embeds))
+	}
+	embed := payload.Embeds[0]
+	if !strings.Contains(embed.Description, "1000") || !strings.Contains(embed.Description, "1001") {
+		t.Errorf("embed description %q, want both change numbers", embed.Description)
+	}
+	fields := make(map[string]string)
+	for _, f := range embed.Fields {
+		fields[f.Name] = f.Value
+	}
+	if !strings.Contains(fields["Changed Depots"], "`2347779`") {
+		t.Errorf("Changed Depots field %q, want depot 2347779", fields["Changed Depots"])
+	}
+	if _, ok := files["analysis.md"]; !ok {
+		t.Errorf("attachments %v, want analysis.md", slices.Collect(maps.Keys(files)))
+	}
+}
+
+func TestReplacingImportWaitsForDepotJobs(t *testing.T) {
+	db, err := database.NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewMonitorWith(730, db, nil, newFakeDownloader(t, nil), nil)
+
+	m.jobs.busy["11"] = true
+	if _, err := m.ImportBuild(11, "100", t.TempDir(), depot.ImportOptions{Replace: true}); !errors.Is(err, ErrDepotBusy) {
+		t.Errorf("replacing import during a job: %v, want ErrDepotBusy", err)
+	}
+	if _, err := m.ImportBuild(11, "100", t.TempDir(), depot.ImportOptions{}); errors.Is(err, ErrDepotBusy) {
+		t.Errorf("plain import during a job was refused")
+	}
+
+	delete(m.jobs.busy, "11")
+	if _, err := m.ImportBuild(11, "100", t.TempDir(), depot.ImportOptions{Replace: true}); errors.Is(err, ErrDepotBusy) {
+		t.Errorf("replacing import of an idle depot was refused")
+	}
+	if m.jobs.busy["11"] {
+		t.Errorf("replacing import left the depot busy")
+	}
+}
+
+func TestRestartResumesUnfinishedUpdate(t *testing.T) {
+	dl := newFakeDownloader(t, map[string]map[string]string{
+		"100": {"bin/server.dll": dllContent("sv_resume_alpha")},
+		"200": {"bin/server.dll": dllContent("sv_resume_alpha", "sv_resume_bravo")},
+	})
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := database.NewDB(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first run queues the update's job and stops before any worker runs it.
+	m := NewMonitorWith(730, db, nil, dl, nil)
+	m.enqueueUpdate(&diff.DiffResult{
+		OldVersion:    "1000",
+		NewVersion:    "1001",
+		ChangedDepots: []diff.DepotChange{{ID: "2347779", Name: "server", OldGID: "100", NewGID: "200"}},
+	}, []string{"2347779"})
+
+	m = NewMonitorWith(730, db, nil, dl, nil)
+	m.startJobs()
+	result := waitForDiff(t, m, "1001")
+	if !slices.Contains(result.NewStrings, "sv_resume_bravo") {
+		t.Errorf("resumed update: new strings %q, want sv_resume_bravo", result.NewStrings)
+	}
+	if pending, err := db.PendingUpdates(730); err != nil || len(pending) != 0 {
+		t.Errorf("finished update still pending: %d, %v", len(pending), err)
+	}
+	failed, err := db.GetJobs(730, database.JobFailed, 10)
+	if err != nil || len(failed) != 1 {
+		t.Errorf("interrupted jobs: %+v, %v; want the first run's job failed", failed, err)
+	}
+}
+
+func TestLocalAnalysisPinsItsBuilds(t *testing.T) {
+	dl := newFakeDownloader(t, map[string]map[string]string{
+		"100": {"bin/server.dll": dllContent("sv_import_alpha")},
+		"200": {"bin/server.dll": dllContent("sv_import_alpha", "sv_import_bravo")},
+	})
+	dl.keepFull = true
+	for _, manifestID := range []string{"100", "200"} {
+		if _, err := dl.DownloadDepot(context.Background(), 11, manifestID, "", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db, err := database.NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewMonitorWith(730, db, nil, dl, nil)
+
+	result, err := m.RunAnalysis(AnalyzeRequest{DepotID: 11, OldManifest: "100", NewManifest: "200"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(result.NewStrings, []string{"sv_import_bravo"}) {
+		t.Errorf("new strings %q, want sv_import_bravo", result.NewStrings)
+	}
+	if got := dl.pins[11]; !slices.Equal(got, []string{"200", "100"}) {
+		t.Errorf("pinned %q, want both imported builds", got)
+	}
+}
@@ -9,13 +9,13 @@ import (
 
 type StatusMonitor struct {
 	webClient *steam.SteamWebClient
-	notifier  *notifier.DiscordNotifier
+	notifier  Notifier
 
 	lastSteamStatus string
 	lastCS2Status   string
 }
 
-func NewStatusMonitor(notifier *notifier.DiscordNotifier) *StatusMonitor {
+func NewStatusMonitor(notifier Notifier) *StatusMonitor {
 	return &StatusMonitor{
 		webClient:       steam.NewSteamWebClient(),
 		notifier:        notifier,
@@ -3,6 +3,7 @@ package notifier
 import (
 	"astra_core/database"
 	"astra_core/diff"
+	"astra_core/items"
 	"bytes"
 	"encoding/json"
 	"fmt"
@@ -12,6 +13,7 @@ import (
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 )
 
 type DiscordNotifier struct {
@@ -154,7 +156,15 @@ func (n *DiscordNotifier) NotifyStatus(update StatusUpdate) error {
 	return n.broadcast(WebhookPayload{Embeds: []Embed{embed}}, nil)
 }
 
+// Notify sends the update notification of a diff to every webhook.
 func (n *DiscordNotifier) Notify(result *diff.DiffResult) error {
+	payload, files := UpdatePayload(result)
+	return n.broadcast(payload, files)
+}
+
+// UpdatePayload builds the update notification of a diff: its embed, and
+// the raw VDF diff and analysis as attached files.
+func UpdatePayload(result *diff.DiffResult) (WebhookPayload, map[string][]byte) {
 	color := getColorForUpdateType(result.Type)
 
 	embed := Embed{
@@ -186,6 +196,10 @@ func (n *DiscordNotifier) Notify(result *diff.DiffResult) error {
 		})
 	}
 
+	if field, ok := classificationField(result.Classification); ok {
+		embed.Fields = append(embed.Fields, field)
+	}
+
 	if len(result.ChangedDepots) > 0 {
 		var content strings.Builder
 		for i, depot := range result.ChangedDepots {
@@ -207,6 +221,14 @@ func (n *DiscordNotifier) Notify(result *diff.DiffResult) error {
 		})
 	}
 
+	if files := len(result.NewFiles) + len(result.ChangedFiles) + len(result.RemovedFiles); files > 0 {
+		embed.Fields = append(embed.Fields, EmbedField{
+			Name:   "Files",
+			Value:  fmt.Sprintf("%d new, %d changed, %d removed", len(result.NewFiles), len(result.ChangedFiles), len(result.RemovedFiles)),
+			Inline: true,
+		})
+	}
+
 	if len(result.StringBlocks) > 0 {
 		var notable strings.Builder
 		count := 0
@@ -235,6 +257,86 @@ func (n *DiscordNotifier) Notify(result *diff.DiffResult) error {
 		}
 	}
 
+	if len(result.ModifiedStrings) > 0 {
+		var modified []string
+		for _, m := range result.ModifiedStrings {
+			if len(m.Old) < 50 && len(m.New) < 50 {
+				modified = append(modified, m.Old+"` → `"+m.New)
+			}
+		}
+		if len(modified) > 0 {
+			embed.Fields = append(embed.Fields, EmbedField{
+				Name:   fmt.Sprintf("Modified Strings (%d)", len(result.ModifiedStrings)),
+				Value:  codeList(modified, 10),
+				Inline: false,
+			})
+		}
+	}
+
+	if len(result.RemovedProtobufs) > 0 {
+		var short []string
+		for _, name := range result.RemovedProtobufs {
+			if len(name) < 50 {
+				short = append(short, name)
+			}
+		}
+		if len(short) > 0 {
+			embed.Fields = append(embed.Fields, EmbedField{
+				Name:   fmt.Sprintf("Removed Protobufs (%d)", len(result.RemovedProtobufs)),
+				Value:  codeList(short, 10),
+				Inline: false,
+			})
+		}
+	}
+
+	if len(result.RemovedStrings) > 0 {
+		var short []string
+		for _, s := range result.RemovedStrings {
+			if len(s) < 50 {
+				short = append(short, s)
+			}
+		}
+		if len(short) > 0 {
+			embed.Fields = append(embed.Fields, EmbedField{
+				Name:   fmt.Sprintf("Removed Strings (%d)", len(result.RemovedStrings)),
+				Value:  codeList(short, 10),
+				Inline: false,
+			})
+		}
+	}
+
+	if rebuilt := result.RebuiltOnly(); len(rebuilt) > 0 {
+		embed.Fields = append(embed.Fields, EmbedField{
+			Name:   "Rebuilt Without Code Changes",
+			Value:  codeList(rebuilt, 10),
+			Inline: false,
+		})
+	}
+
+	if len(result.FunctionDiffs) > 0 {
+		var lines []string
+		for _, fd := range result.FunctionDiffs {
+			lines = append(lines, fd.File+": "+fd.Summary())
+		}
+		embed.Fields = append(embed.Fields, EmbedField{
+			Name:   "Function Changes",
+			Value:  codeList(lines, 5),
+			Inline: false,
+		})
+	}
+
+	if total := result.Suppressed.Total(); total > 0 {
+		embed.Fields = append(embed.Fields, EmbedField{
+			Name:   "Suppressed Noise",
+			Value:  fmt.Sprintf("%d strings (%s)", total, result.Suppressed.Summary()),
+			Inline: false,
+		})
+	}
+
+	if field, ok := itemSchemaField(result.ItemSchema); ok {
+		embed.Fields = append(embed.Fields, field)
+	}
+
 	files := make(map[string][]byte)
 	if result.RawDiff != "" {
 		files["vdf_diff.txt"] = []byte(result.RawDiff)
@@ -243,7 +345,94 @@ func (n *DiscordNotifier) Notify(result *diff.DiffResult) error {
 		files["analysis.md"] = []byte(result.Analysis)
 	}
 
-	return n.broadcast(WebhookPayload{Embeds: []Embed{embed}}, files)
+	return WebhookPayload{Embeds: []Embed{embed}}, files
+}
+
+// classificationField lists the top candidate types with confidence and their strongest evidence.
+func classificationField(c diff.Classification) (EmbedField, bool) {
+	if len(c) == 0 {
+		return EmbedField{}, false
+	}
+
+	var content strings.Builder
+	for i, ts := range c {
+		if i >= 3 {
+			break
+		}
+		content.WriteString(fmt.Sprintf("**%s** %.0f%%\n", ts.Type, ts.Confidence*100))
+		for j, e := range ts.Evidence {
+			if j >= 2 {
+				break
+			}
+			content.WriteString(fmt.Sprintf("• %s\n", e.Detail))
+		}
+	}
+
+	value := content.String()
+	if len(value) > 1000 {
+		value = value[:1000] + "..."
+	}
+	return EmbedField{Name: "Classification", Value: value, Inline: false}, true
+}
+
+// maxFieldLength is the most characters Discord accepts in an embed field value.
+const maxFieldLength = 1024
+
+// codeList renders up to limit items as inline code, one per line. It stops
+// early when the next item would not leave room for the "... and N more" line
+// within maxFieldLength.
+func codeList(items []string, limit int) string {
+	var b strings.Builder
+	length := 0
+	for i, item := range items {
+		line := fmt.Sprintf("`%s`\n", item)
+		n := utf8.RuneCountInString(line)
+		if i >= limit || length+n+moreLength(len(items)-i-1) > maxFieldLength {
+			b.WriteString(fmt.Sprintf("... and %d more", len(items)-i))
+			break
+		}
+		b.WriteString(line)
+		length += n
+	}
+	return b.String()
+}
+
+// moreLength is the length of the line codeList ends with when rest items are
+// left out.
+func moreLength(rest int) int {
+	if rest == 0 {
+		return 0
+	}
+	return len(fmt.Sprintf("... and %d more", rest))
+}
+
+func itemSchemaField(d *items.SchemaDiff) (EmbedField, bool) {
+	if d.IsEmpty() {
+		return EmbedField{}, false
+	}
+
+	var content strings.Builder
+	for _, section := range d.Sections {
+		content.WriteString(fmt.Sprintf("**%s** +%d / -%d / ~%d\n", section.Kind, len(section.Added), len(section.Removed), len(section.Changed)))
+		for i, e := range section.Added {
+			if i >= 3 {
+				content.WriteString(fmt.Sprintf("... and %d more\n", len(section.Added)-3))
+				break
+			}
+			content.WriteString(fmt.Sprintf("`%s`\n", e.Name))
+		}
+	}
+
+	value := content.String()
+	if len(value) > 1000 {
+		value = value[:1000] + "..."
+	}
+
+	return EmbedField{
+		Name:   "Item Schema",
+		Value:  value,
+		Inline: false,
+	}, true
 }
 
 func getColorForUpdateType(t diff.UpdateType) int {
@@ -0,0 +1,86 @@
+package notifier
+
+import (
+	"astra_core/diff"
+	"astra_core/extractor"
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestUpdatePayloadFieldsFitDiscordLimit(t *testing.T) {
+	result := &diff.DiffResult{OldVersion: "1000", NewVersion: "1001"}
+	for i := 0; i < 10; i++ {
+		prefix := fmt.Sprintf("#SFUI_Settings_Long_Option_%02d_", i)
+		result.ModifiedStrings = append(result.ModifiedStrings, extractor.StringModification{
+			Old: prefix + strings.Repeat("a", 49-len(prefix)),
+			New: prefix + strings.Repeat("b", 49-len(prefix)),
+		})
+	}
+
+	payload, _ := UpdatePayload(result)
+	var modified string
+	for _, f := range payload.Embeds[0].Fields {
+		if strings.HasPrefix(f.Name, "Modified Strings") {
+			modified = f.Value
+		}
+	}
+	if modified == "" {
+		t.Fatal("no Modified Strings field")
+	}
+	if n := utf8.RuneCountInString(modified); n > maxFieldLength {
+		t.Errorf("Modified Strings field is %d characters, want at most %d", n, maxFieldLength)
+	}
+	if !strings.HasSuffix(modified, " more") {
+		t.Errorf("Modified Strings field %q does not say how many were left out", modified)
+	}
+}
+
+func TestUpdatePayloadSkipsLongProtobufNames(t *testing.T) {
+	result := &diff.DiffResult{
+		OldVersion:       "1000",
+		NewVersion:       "1001",
+		RemovedProtobufs: []string{"CMsgGCCStrike15_v2_MatchEnd", strings.Repeat("CMsgGeneratedName", 80)},
+	}
+
+	payload, _ := UpdatePayload(result)
+	var field *EmbedField
+	for i, f := range payload.Embeds[0].Fields {
+		if strings.HasPrefix(f.Name, "Removed Protobufs") {
+			field = &payload.Embeds[0].Fields[i]
+		}
+	}
+	if field == nil {
+		t.Fatal("no Removed Protobufs field")
+	}
+	if field.Name != "Removed Protobufs (2)" || field.Value != "`CMsgGCCStrike15_v2_MatchEnd`\n" {
+		t.Errorf("field %q = %q, want the short name and the count of both", field.Name, field.Value)
+	}
+}
+
+func TestCodeList(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []string
+		limit int
+		want  string
+	}{
+		{"all fit", []string{"a", "b"}, 10, "`a`\n`b`\n"},
+		{"over the item limit", []string{"a", "b", "c"}, 2, "`a`\n`b`\n... and 1 more"},
+		{"over the length limit", []string{strings.Repeat("a", 1000), "b", strings.Repeat("c", 30)}, 10,
+			"`" + strings.Repeat("a", 1000) + "`\n`b`\n... and 1 more"},
+		{"single item too long", []string{strings.Repeat("a", maxFieldLength)}, 10, "... and 1 more"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := codeList(tt.items, tt.limit)
+			if got != tt.want {
+				t.Errorf("codeList = %q, want %q", got, tt.want)
+			}
+			if n := utf8.RuneCountInString(got); n > maxFieldLength {
+				t.Errorf("codeList is %d characters, want at most %d", n, maxFieldLength)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package panorama
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	KindLayout = "layout"
+	KindStyle  = "style"
+	KindScript = "script"
+)
+
+var kindByExt = map[string]string{
+	".xml":    KindLayout,
+	".vxml_c": KindLayout,
+	".css":    KindStyle,
+	".vcss_c": KindStyle,
+	".js":     KindScript,
+	".vjs_c":  KindScript,
+	".ts":     KindScript,
+	".vts_c":  KindScript,
+}
+
+// Kind classifies a game path under panorama/ as layout, style or script.
+func Kind(gamePath string) (string, bool) {
+	p := strings.ToLower(gamePath)
+	if !strings.HasPrefix(p, "panorama/") {
+		return "", false
+	}
+	kind, ok := kindByExt[path.Ext(p)]
+	return kind, ok
+}
+
+// SourcePath maps a compiled resource path to the source name it was built from,
+// so panorama/layout/mainmenu.vxml_c and a loose mainmenu.xml compare as one file.
+func SourcePath(gamePath string) string {
+	p := strings.ToLower(gamePath)
+	ext := path.Ext(p)
+	if strings.HasPrefix(ext, ".v") && strings.HasSuffix(ext, "_c") {
+		return strings.TrimSuffix(p, ext) + "." + strings.TrimSuffix(strings.TrimPrefix(ext, ".v"), "_c")
+	}
+	return p
+}
+
+// Decode returns the source text of a Panorama file. Compiled Source 2 resources
+// (*.vxml_c etc.) keep the original text in their DATA block.
+func Decode(gamePath string, data []byte) (string, error) {
+	if !strings.HasSuffix(strings.ToLower(gamePath), "_c") {
+		return string(data), nil
+	}
+
+	block, err := resourceBlock(data, "DATA")
+	if err != nil {
+		return "", err
+	}
+	return decodePanoramaData(block)
+}
+
+// resourceBlock locates a named block in a compiled Source 2 resource.
+// Offsets in the header are relative to the field that stores them.
+func resourceBlock(data []byte, name string) ([]byte, error) {
+	if len(data) < 16 {
+		return nil, fmt.Errorf("panorama: resource too small")
+	}
+	blockOffset := 8 + int(binary.LittleEndian.Uint32(data[8:]))
+	blockCount := int(binary.LittleEndian.Uint32(data[12:]))
+
+	for i := 0; i < blockCount; i++ {
+		pos := blockOffset + i*12
+		if pos+12 > len(data) {
+			break
+		}
+		typ := string(data[pos : pos+4])
+		start := pos + 4 + int(binary.LittleEndian.Uint32(data[pos+4:]))
+		size := int(binary.LittleEndian.Uint32(data[pos+8:]))
+		if typ != name {
+			continue
+		}
+		if start < 0 || size < 0 || start+size > len(data) {
+			return nil, fmt.Errorf("panorama: %s block out of range", name)
+		}
+		return data[start : start+size], nil
+	}
+	return nil, fmt.Errorf("panorama: no %s block", name)
+}
+
+// Panorama DATA: uint32 CRC, uint16 name count, names (cstring + 2x uint32), then the text.
+func decodePanoramaData(block []byte) (string, error) {
+	if len(block) < 6 {
+		return "", fmt.Errorf("panorama: DATA block too small")
+	}
+	crc := binary.LittleEndian.Uint32(block)
+	count := int(binary.LittleEndian.Uint16(block[4:]))
+
+	pos := 6
+	for i := 0; i < count; i++ {
+		end := bytes.IndexByte(block[pos:], 0)
+		if end < 0 {
+			return "", fmt.Errorf("panorama: truncated name table")
+		}
+		pos += end + 1 + 8
+		if pos > len(block) {
+			return "", fmt.Errorf("panorama: truncated name table")
+		}
+	}
+
+	text := block[pos:]
+	if crc32.ChecksumIEEE(text) != crc {
+		return "", fmt.Errorf("panorama: DATA checksum mismatch")
+	}
+	return string(text), nil
+}
+
+// Symbols are the UI identifiers worth calling out in an update summary.
+type Symbols struct {
+	Panels []string `json:"panels,omitempty"`
+	IDs    []string `json:"ids,omitempty"`
+	Events []string `json:"events,omitempty"`
+}
+
+var (
+	xmlTagRegex   = regexp.MustCompile(`<([A-Z][A-Za-z0-9_]*)[\s/>]`)
+	xmlIDRegex    = regexp.MustCompile(`\bid="([A-Za-z0-9_\-]+)"`)
+	cssIDRegex    = regexp.MustCompile(`#([A-Za-z][A-Za-z0-9_\-]*)`)
+	eventRegex    = regexp.MustCompile(`(?:RegisterForUnhandledEvent|RegisterEventHandler|DispatchEvent|DispatchEventAsync)\(\s*['"]([A-Za-z0-9_]+)['"]`)
+	cssColorRegex = regexp.MustCompile(`^[0-9a-fA-F]{3,8}$`)
+)
+
+// ExtractSymbols collects panel types and ids from layouts, ids from styles
+// and event names from anything that registers or dispatches them.
+func ExtractSymbols(kind, text string) Symbols {
+	var panels, ids []string
+	switch kind {
+	case KindLayout:
+		panels = submatches(xmlTagRegex, text)
+		ids = submatches(xmlIDRegex, text)
+	case KindStyle:
+		for _, id := range submatches(cssIDRegex, text) {
+			if !cssColorRegex.MatchString(id) { // #fff is a colour, not an id
+				ids = append(ids, id)
+			}
+		}
+	}
+	return Symbols{
+		Panels: panels,
+		IDs:    ids,
+		Events: submatches(eventRegex, text),
+	}
+}
+
+func submatches(re *regexp.Regexp, text string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, m := range re.FindAllStringSubmatch(text, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			out = append(out, m[1])
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// File is one decoded Panorama source, keyed by its source path.
+type File struct {
+	Path string
+	Kind string
+	Text string
+}
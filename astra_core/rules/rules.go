@@ -0,0 +1,346 @@
+package rules
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//go:embed default.json
+var defaultRules []byte
+
+//go:embed corpus.txt
+var DefaultCorpus []byte
+
+const (
+	MatchPrefix   = "prefix"
+	MatchContains = "contains"
+	MatchExact    = "exact"
+	MatchRegex    = "regex"
+
+	// CategoryOther is used for strings no rule matched.
+	CategoryOther = "other"
+)
+
+// Rule assigns a category to strings it matches. Rules are evaluated in file
+// order and the first match wins, so more specific rules go first.
+type Rule struct {
+	Name          string  `json:"name"`
+	Match         string  `json:"match"`
+	Pattern       string  `json:"pattern"`
+	CaseSensitive bool    `json:"case_sensitive,omitempty"`
+	Category      string  `json:"category"`
+	Weight        float64 `json:"weight"`
+	Notable       bool    `json:"notable,omitempty"`
+	Votes         string  `json:"votes,omitempty"` // diff.UpdateType this rule counts towards
+}
+
+type Category struct {
+	Name string `json:"name"`
+	Icon string `json:"icon"`
+}
+
+// RuleSet is the on-disk format of a rule file.
+type RuleSet struct {
+	Categories []Category `json:"categories"`
+	// Thresholds is the summed vote weight at which string evidence for an update type
+	// counts as one full signal. Types without a threshold use 1.
+	Thresholds map[string]float64 `json:"thresholds"`
+	Rules      []Rule             `json:"rules"`
+}
+
+type compiledRule struct {
+	Rule
+	re *regexp.Regexp
+}
+
+type Engine struct {
+	set    RuleSet
+	source string
+	rules  []compiledRule
+}
+
+var (
+	activeMu sync.RWMutex
+	active   *Engine
+)
+
+// Active returns the engine used by the extractor and diff packages.
+// It falls back to the embedded default rules.
+func Active() *Engine {
+	activeMu.RLock()
+	e := active
+	activeMu.RUnlock()
+	if e != nil {
+		return e
+	}
+
+	activeMu.Lock()
+	defer activeMu.Unlock()
+	if active == nil {
+		active = Default()
+	}
+	return active
+}
+
+func SetActive(e *Engine) {
+	activeMu.Lock()
+	active = e
+	activeMu.Unlock()
+}
+
+// Default builds the engine from the embedded rule file.
+func Default() *Engine {
+	e, err := Parse(defaultRules, "embedded")
+	if err != nil {
+		panic("rules: invalid embedded default rules: " + err.Error())
+	}
+	return e
+}
+
+func Load(path string) (*Engine, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data, path)
+}
+
+func Parse(data []byte, source string) (*Engine, error) {
+	var set RuleSet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("rules: %s: %w", source, err)
+	}
+
+	known := make(map[string]bool)
+	for _, c := range set.Categories {
+		known[c.Name] = true
+	}
+	if !known[CategoryOther] {
+		set.Categories = append(set.Categories, Category{Name: CategoryOther})
+	}
+
+	e := &Engine{set: set, source: source}
+	for i, r := range set.Rules {
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule-%d", i)
+		}
+		if !known[r.Category] {
+			return nil, fmt.Errorf("rules: %s: rule %q uses undeclared category %q", source, r.Name, r.Category)
+		}
+
+		cr := compiledRule{Rule: r}
+		switch r.Match {
+		case MatchRegex:
+			pattern := r.Pattern
+			if !r.CaseSensitive {
+				pattern = "(?i)" + pattern
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("rules: %s: rule %q: %w", source, r.Name, err)
+			}
+			cr.re = re
+		case MatchPrefix, MatchContains, MatchExact:
+			if !r.CaseSensitive {
+				cr.Pattern = strings.ToLower(r.Pattern)
+			}
+		default:
+			return nil, fmt.Errorf("rules: %s: rule %q has unknown match type %q", source, r.Name, r.Match)
+		}
+		e.rules = append(e.rules, cr)
+	}
+	return e, nil
+}
+
+func (r *compiledRule) matches(s, lower string) bool {
+	subject := s
+	if !r.CaseSensitive {
+		subject = lower
+	}
+	switch r.Match {
+	case MatchPrefix:
+		return strings.HasPrefix(subject, r.Pattern)
+	case MatchContains:
+		return strings.Contains(subject, r.Pattern)
+	case MatchExact:
+		return subject == r.Pattern
+	default:
+		return r.re.MatchString(s)
+	}
+}
+
+// Match returns the first rule matching s.
+func (e *Engine) Match(s string) (Rule, bool) {
+	lower := strings.ToLower(s)
+	for i := range e.rules {
+		if e.rules[i].matches(s, lower) {
+			return e.rules[i].Rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// Category returns the category of the first matching rule, or "other".
+func (e *Engine) Category(s string) string {
+	if r, ok := e.Match(s); ok {
+		return r.Category
+	}
+	return CategoryOther
+}
+
+func (e *Engine) IsNotable(s string) bool {
+	r, ok := e.Match(s)
+	return ok && r.Notable
+}
+
+func (e *Engine) Categories() []Category {
+	return e.set.Categories
+}
+
+func (e *Engine) RuleSet() RuleSet {
+	return e.set
+}
+
+func (e *Engine) Source() string {
+	return e.source
+}
+
+// VoteScore is the summed weight of the rules voting for one update type.
+type VoteScore struct {
+	Type      string         `json:"type"`
+	Score     float64        `json:"score"`
+	Threshold float64        `json:"threshold"`
+	Hits      map[string]int `json:"hits"` // rule name -> matched strings
+}
+
+// Ratio is Score relative to the type's threshold; 1 means the threshold was reached.
+func (v VoteScore) Ratio() float64 {
+	return v.Score / v.Threshold
+}
+
+// Summary formats the contributing rules as "name×count", sorted by name.
+func (v VoteScore) Summary() string {
+	var names []string
+	for name, n := range v.Hits {
+		names = append(names, fmt.Sprintf("%s×%d", name, n))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// Scores sums rule weights per update type over strs, highest ratio first.
+func (e *Engine) Scores(strs []string) []VoteScore {
+	byType := make(map[string]*VoteScore)
+	for _, s := range strs {
+		r, ok := e.Match(s)
+		if !ok || r.Votes == "" || r.Weight == 0 {
+			continue
+		}
+		v := byType[r.Votes]
+		if v == nil {
+			threshold := e.set.Thresholds[r.Votes]
+			if threshold <= 0 {
+				threshold = 1
+			}
+			v = &VoteScore{Type: r.Votes, Threshold: threshold, Hits: make(map[string]int)}
+			byType[r.Votes] = v
+		}
+		v.Score += r.Weight
+		v.Hits[r.Name]++
+	}
+
+	scores := make([]VoteScore, 0, len(byType))
+	for _, v := range byType {
+		scores = append(scores, *v)
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Ratio() != scores[j].Ratio() {
+			return scores[i].Ratio() > scores[j].Ratio()
+		}
+		return scores[i].Type < scores[j].Type
+	})
+	return scores
+}
+
+// CorpusCase is one line of a rule test corpus: an optional expected category and the string.
+type CorpusCase struct {
+	Expected string `json:"expected,omitempty"`
+	Value    string `json:"value"`
+}
+
+type CaseResult struct {
+	Value    string `json:"value"`
+	Expected string `json:"expected,omitempty"`
+	Category string `json:"category"`
+	Rule     string `json:"rule,omitempty"`
+	Notable  bool   `json:"notable"`
+	Pass     bool   `json:"pass"`
+}
+
+type TestReport struct {
+	Source     string         `json:"source"`
+	Total      int            `json:"total"`
+	Failed     int            `json:"failed"`
+	Categories map[string]int `json:"categories"`
+	RuleHits   map[string]int `json:"rule_hits"`
+	UnusedRule []string       `json:"unused_rules,omitempty"`
+	Results    []CaseResult   `json:"results"`
+}
+
+// ParseCorpus reads "expected<TAB>string" or bare "string" lines; '#' starts a comment.
+func ParseCorpus(data []byte) []CorpusCase {
+	var cases []CorpusCase
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if expected, value, ok := strings.Cut(line, "\t"); ok {
+			cases = append(cases, CorpusCase{Expected: expected, Value: value})
+		} else {
+			cases = append(cases, CorpusCase{Value: line})
+		}
+	}
+	return cases
+}
+
+// Test runs every corpus string through the engine and reports which rule
+// claimed it, whether that matches the expectation, and which rules never fired.
+func (e *Engine) Test(cases []CorpusCase) TestReport {
+	report := TestReport{
+		Source:     e.source,
+		Categories: make(map[string]int),
+		RuleHits:   make(map[string]int),
+	}
+
+	for _, c := range cases {
+		res := CaseResult{Value: c.Value, Expected: c.Expected, Category: CategoryOther, Pass: true}
+		if r, ok := e.Match(c.Value); ok {
+			res.Category, res.Rule, res.Notable = r.Category, r.Name, r.Notable
+			report.RuleHits[r.Name]++
+		}
+		if c.Expected != "" && c.Expected != res.Category {
+			res.Pass = false
+			report.Failed++
+		}
+		report.Categories[res.Category]++
+		report.Results = append(report.Results, res)
+	}
+	report.Total = len(cases)
+
+	for _, r := range e.rules {
+		if report.RuleHits[r.Name] == 0 {
+			report.UnusedRule = append(report.UnusedRule, r.Name)
+		}
+	}
+	return report
+}
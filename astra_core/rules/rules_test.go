@@ -0,0 +1,26 @@
+package rules
+
+import "testing"
+
+// TestDefaultRulesCorpus checks every line of the bundled corpus against the
+// shipped rule file.
+func TestDefaultRulesCorpus(t *testing.T) {
+	engine, err := Load("default.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := ParseCorpus(DefaultCorpus)
+	if len(cases) == 0 {
+		t.Fatal("corpus is empty")
+	}
+	for _, c := range cases {
+		if c.Expected == "" {
+			t.Errorf("%q has no expected category", c.Value)
+			continue
+		}
+		if got := engine.Category(c.Value); got != c.Expected {
+			rule, _ := engine.Match(c.Value)
+			t.Errorf("%q: category %s (rule %q), want %s", c.Value, got, rule.Name, c.Expected)
+		}
+	}
+}
@@ -4,17 +4,35 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"os"
 	"os/exec"
 	"strings"
 	"time"
 )
 
+// DefaultPath is where the Docker image installs steamcmd.
+const DefaultPath = "/opt/steamcmd/steamcmd.sh"
+
+// Executable returns the steamcmd to run: STEAMCMD_PATH, or DefaultPath.
+func Executable() string {
+	if path := os.Getenv("STEAMCMD_PATH"); path != "" {
+		return path
+	}
+	return DefaultPath
+}
+
 type Client struct {
 	initialized bool
+	path        string
 }
 
-func NewClient() *Client {
-	return &Client{}
+// NewClient returns a client running the steamcmd at path, or Executable()
+// when path is empty.
+func NewClient(path string) *Client {
+	if path == "" {
+		path = Executable()
+	}
+	return &Client{path: path}
 }
 
 func (c *Client) Start() error {
@@ -31,7 +49,7 @@ func (c *Client) runCommand(args ...string) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, "/opt/steamcmd/steamcmd.sh", fullArgs...)
+	cmd := exec.CommandContext(ctx, c.path, fullArgs...)
 	output, err := cmd.CombinedOutput()
 
 	if ctx.Err() != nil {
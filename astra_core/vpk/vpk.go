@@ -0,0 +1,246 @@
+package vpk
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	signature      = 0x55aa1234
+	entryTerm      = 0xffff
+	dirArchiveIdx  = 0x7fff
+	headerSizeV1   = 12
+	headerSizeV2   = 28
+	maxEntryLength = 512 * 1024 * 1024
+)
+
+// Entry describes one file stored in a VPK package.
+type Entry struct {
+	Path         string
+	CRC          uint32
+	ArchiveIndex uint16
+	Offset       uint32
+	Length       uint32
+	preload      []byte
+}
+
+// Size is the full uncompressed size of the file, preload bytes included.
+func (e *Entry) Size() int64 {
+	return int64(len(e.preload)) + int64(e.Length)
+}
+
+// Archive is an opened *_dir.vpk together with its numbered data archives.
+type Archive struct {
+	dirPath  string
+	dataBase int64 // offset of embedded file data inside the _dir.vpk
+	entries  map[string]*Entry
+}
+
+// Open parses the directory tree of a VPK v1/v2 _dir.vpk file.
+func Open(dirPath string) (*Archive, error) {
+	f, err := os.Open(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+
+	var hdr struct {
+		Signature uint32
+		Version   uint32
+		TreeSize  uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return nil, fmt.Errorf("vpk: read header: %w", err)
+	}
+	if hdr.Signature != signature {
+		return nil, fmt.Errorf("vpk: %s is not a VPK directory file", filepath.Base(dirPath))
+	}
+
+	headerSize := int64(headerSizeV1)
+	switch hdr.Version {
+	case 1:
+	case 2:
+		// FileDataSectionSize, ArchiveMD5SectionSize, OtherMD5SectionSize, SignatureSectionSize
+		if _, err := r.Discard(16); err != nil {
+			return nil, fmt.Errorf("vpk: read v2 header: %w", err)
+		}
+		headerSize = headerSizeV2
+	default:
+		return nil, fmt.Errorf("vpk: unsupported version %d", hdr.Version)
+	}
+
+	a := &Archive{
+		dirPath:  dirPath,
+		dataBase: headerSize + int64(hdr.TreeSize),
+		entries:  make(map[string]*Entry),
+	}
+	if err := a.readTree(r); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *Archive) readTree(r *bufio.Reader) error {
+	for {
+		ext, err := readCString(r)
+		if err != nil {
+			return err
+		}
+		if ext == "" {
+			return nil
+		}
+		for {
+			dir, err := readCString(r)
+			if err != nil {
+				return err
+			}
+			if dir == "" {
+				break
+			}
+			for {
+				name, err := readCString(r)
+				if err != nil {
+					return err
+				}
+				if name == "" {
+					break
+				}
+				entry, err := readEntry(r)
+				if err != nil {
+					return fmt.Errorf("vpk: entry %s/%s.%s: %w", dir, name, ext, err)
+				}
+				entry.Path = joinEntryPath(dir, name, ext)
+				a.entries[entry.Path] = entry
+			}
+		}
+	}
+}
+
+func readEntry(r *bufio.Reader) (*Entry, error) {
+	var raw struct {
+		CRC          uint32
+		PreloadBytes uint16
+		ArchiveIndex uint16
+		Offset       uint32
+		Length       uint32
+		Terminator   uint16
+	}
+	if err := binary.Read(r, binary.LittleEndian, &raw); err != nil {
+		return nil, err
+	}
+	if raw.Terminator != entryTerm {
+		return nil, fmt.Errorf("bad terminator 0x%x", raw.Terminator)
+	}
+	if raw.Length > maxEntryLength {
+		return nil, fmt.Errorf("entry length %d exceeds limit", raw.Length)
+	}
+
+	e := &Entry{
+		CRC:          raw.CRC,
+		ArchiveIndex: raw.ArchiveIndex,
+		Offset:       raw.Offset,
+		Length:       raw.Length,
+	}
+	if raw.PreloadBytes > 0 {
+		e.preload = make([]byte, raw.PreloadBytes)
+		if _, err := io.ReadFull(r, e.preload); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+func readCString(r *bufio.Reader) (string, error) {
+	s, err := r.ReadString(0)
+	if err != nil {
+		return "", fmt.Errorf("vpk: truncated directory tree: %w", err)
+	}
+	return s[:len(s)-1], nil
+}
+
+// VPK stores a single space for "no directory" and "no extension".
+func joinEntryPath(dir, name, ext string) string {
+	path := name
+	if ext != " " && ext != "" {
+		path += "." + ext
+	}
+	if dir != " " && dir != "" {
+		path = dir + "/" + path
+	}
+	return strings.ToLower(path)
+}
+
+// Files returns every entry path in the package, sorted.
+func (a *Archive) Files() []string {
+	files := make([]string, 0, len(a.entries))
+	for p := range a.entries {
+		files = append(files, p)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func (a *Archive) Entry(path string) (*Entry, bool) {
+	e, ok := a.entries[strings.ToLower(filepath.ToSlash(path))]
+	return e, ok
+}
+
+// ReadFile returns the contents of a packed file, reading from the
+// _dir.vpk or the matching pakNN_XXX.vpk data archive.
+func (a *Archive) ReadFile(path string) ([]byte, error) {
+	e, ok := a.Entry(path)
+	if !ok {
+		return nil, fmt.Errorf("vpk: %s: %w", path, os.ErrNotExist)
+	}
+
+	buf := make([]byte, e.Size())
+	copy(buf, e.preload)
+	if e.Length == 0 {
+		return buf, nil
+	}
+
+	archivePath := a.dirPath
+	offset := int64(e.Offset)
+	if e.ArchiveIndex == dirArchiveIdx {
+		offset += a.dataBase
+	} else {
+		archivePath = a.dataArchivePath(e.ArchiveIndex)
+	}
+
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if _, err := f.ReadAt(buf[len(e.preload):], offset); err != nil {
+		return nil, fmt.Errorf("vpk: read %s from %s: %w", path, filepath.Base(archivePath), err)
+	}
+	return buf, nil
+}
+
+// DataPath returns the file holding an entry's data past its preload bytes:
+// a pakNN_XXX.vpk data archive, or the _dir.vpk itself. It is empty when the
+// entry is preloaded whole.
+func (a *Archive) DataPath(e *Entry) string {
+	switch {
+	case e.Length == 0:
+		return ""
+	case e.ArchiveIndex == dirArchiveIdx:
+		return a.dirPath
+	}
+	return a.dataArchivePath(e.ArchiveIndex)
+}
+
+func (a *Archive) dataArchivePath(index uint16) string {
+	base := strings.TrimSuffix(a.dirPath, "_dir.vpk")
+	return fmt.Sprintf("%s_%03d.vpk", base, index)
+}